@@ -53,6 +53,18 @@ func (err ErrBlobMounted) Error() string {
 		err.From, err.Descriptor)
 }
 
+// ErrBlobReferenced returned when a blob cannot be deleted because manifests
+// in the repository still reference it.
+type ErrBlobReferenced struct {
+	Digest    digest.Digest
+	Manifests []digest.Digest
+}
+
+func (err ErrBlobReferenced) Error() string {
+	return fmt.Sprintf("blob %v is referenced by manifests: %v",
+		err.Digest, err.Manifests)
+}
+
 // Descriptor describes targeted content. Used in conjunction with a blob
 // store, a descriptor can be used to fetch, store and target any kind of
 // blob. The struct also describes the wire protocol format. Fields should
@@ -94,7 +106,20 @@ type BlobStatter interface {
 
 // BlobDeleter enables deleting blobs from storage.
 type BlobDeleter interface {
-	Delete(ctx context.Context, dgst digest.Digest) error
+	Delete(ctx context.Context, dgst digest.Digest, options ...BlobDeleteOption) error
+}
+
+// BlobDeleteOption is a general extensible function argument for blob
+// deletion methods. A BlobDeleter may choose to honor any or none of the
+// given BlobDeleteOptions, which can be specific to the implementation of
+// the BlobDeleter receiving them.
+type BlobDeleteOption interface {
+	Apply(interface{}) error
+}
+
+// BlobEnumerator enables iterating over blobs from storage
+type BlobEnumerator interface {
+	Enumerate(ctx context.Context, ingester func(dgst digest.Digest) error) error
 }
 
 // BlobDescriptorService manages metadata about a blob by digest. Most
@@ -216,6 +241,17 @@ type BlobWriter interface {
 	Reader() (io.ReadCloser, error)
 }
 
+// BlobChunkWriter is implemented by BlobWriters which accept chunks of the
+// blob at arbitrary offsets, possibly from several writers of the same
+// upload at once. The chunks are assembled in offset order by Commit, which
+// then verifies the digest of the assembled data.
+type BlobChunkWriter interface {
+	// WriteChunk stores the size bytes read from r as the chunk of the blob
+	// starting at offset. If r holds fewer bytes, nothing is stored and
+	// ErrBlobInvalidLength is returned.
+	WriteChunk(ctx context.Context, offset, size int64, r io.Reader) error
+}
+
 // BlobService combines the operations to access, read and write blobs. This
 // can be used to describe remote blob services.
 type BlobService interface {
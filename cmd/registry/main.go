@@ -13,6 +13,11 @@ import (
 	_ "github.com/docker/distribution/registry/storage/driver/gcs"
 	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
 	_ "github.com/docker/distribution/registry/storage/driver/middleware/cloudfront"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/diskcache"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/encryption"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/faultinjection"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/instrumentation"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/mirror"
 	_ "github.com/docker/distribution/registry/storage/driver/oss"
 	_ "github.com/docker/distribution/registry/storage/driver/s3"
 	_ "github.com/docker/distribution/registry/storage/driver/swift"
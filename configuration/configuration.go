@@ -145,6 +145,13 @@ type Configuration struct {
 	Health Health `yaml:"health,omitempty"`
 
 	Proxy Proxy `yaml:"proxy,omitempty"`
+
+	// Catalog configures the catalog API.
+	Catalog Catalog `yaml:"catalog,omitempty"`
+
+	// Admin configures the administrative API, served on a separate
+	// listener from the registry API.
+	Admin Admin `yaml:"admin,omitempty"`
 }
 
 // LogHook is composed of hook Level and Type.
@@ -325,6 +332,10 @@ func (storage Storage) Type() string {
 			// allow configuration of delete
 		case "redirect":
 			// allow configuration of redirect
+		case "quota":
+			// allow configuration of quotas
+		case "tags":
+			// allow configuration of tag policies
 		default:
 			storageType = append(storageType, k)
 		}
@@ -366,6 +377,10 @@ func (storage *Storage) UnmarshalYAML(unmarshal func(interface{}) error) error {
 					// allow configuration of delete
 				case "redirect":
 					// allow configuration of redirect
+				case "quota":
+					// allow configuration of quotas
+				case "tags":
+					// allow configuration of tag policies
 				default:
 					types = append(types, k)
 				}
@@ -529,6 +544,24 @@ type Proxy struct {
 	Password string `yaml:"password"`
 }
 
+// Catalog configures the catalog API.
+type Catalog struct {
+	// AuthorizedOnly restricts the catalog to the repositories the caller
+	// may pull, as checked by the configured access controller.
+	AuthorizedOnly bool `yaml:"authorizedonly,omitempty"`
+}
+
+// Admin configures the administrative API.
+type Admin struct {
+	// Addr specifies the bind address for the admin server. The admin API
+	// is disabled if it is not set.
+	Addr string `yaml:"addr,omitempty"`
+
+	// Net specifies the net portion of the bind address. A default empty
+	// value means tcp.
+	Net string `yaml:"net,omitempty"`
+}
+
 // Parse parses an input configuration yaml document into a Configuration struct
 // This should generally be capable of handling old configuration format versions
 //
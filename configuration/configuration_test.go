@@ -458,6 +458,41 @@ func checkStructs(c *C, t reflect.Type, structsChecked map[string]struct{}) {
 	}
 }
 
+// TestRedacted validates that secrets are replaced in a redacted
+// configuration, leaving the original configuration untouched.
+func (suite *ConfigSuite) TestRedacted(c *C) {
+	suite.expectedConfig.HTTP.Secret = "httpsecret"
+	suite.expectedConfig.Storage.setParameter("nested", map[interface{}]interface{}{
+		"password": "nestedpassword",
+		"user":     "nesteduser",
+	})
+	original := copyConfig(*suite.expectedConfig)
+	original.HTTP.Secret = suite.expectedConfig.HTTP.Secret
+
+	config := suite.expectedConfig.Redacted()
+
+	parameters := config.Storage.Parameters()
+	c.Assert(parameters["accesskey"], Equals, redacted)
+	c.Assert(parameters["secretkey"], Equals, redacted)
+	c.Assert(parameters["region"], Equals, "us-east-1")
+	c.Assert(parameters["nested"], DeepEquals, map[interface{}]interface{}{
+		"password": redacted,
+		"user":     "nesteduser",
+	})
+	c.Assert(config.Auth.Parameters(), DeepEquals, suite.expectedConfig.Auth.Parameters())
+	c.Assert(config.Reporting.Bugsnag.APIKey, Equals, redacted)
+	c.Assert(config.HTTP.Secret, Equals, redacted)
+	c.Assert(config.Notifications.Endpoints[0].Headers, DeepEquals, http.Header{
+		"Authorization": []string{redacted},
+	})
+	c.Assert(config.Notifications.Endpoints[0].URL, Equals, "http://example.com")
+
+	c.Assert(suite.expectedConfig.Storage.Parameters()["secretkey"], Equals, "SUPERSECRET")
+	c.Assert(suite.expectedConfig.Reporting.Bugsnag.APIKey, Equals, original.Reporting.Bugsnag.APIKey)
+	c.Assert(suite.expectedConfig.HTTP.Secret, Equals, "httpsecret")
+	c.Assert(suite.expectedConfig.Notifications.Endpoints, DeepEquals, original.Notifications.Endpoints)
+}
+
 // TestValidateConfigStruct makes sure that the config struct has no members
 // with yaml tags that would be ambiguous to the environment variable parser.
 func (suite *ConfigSuite) TestValidateConfigStruct(c *C) {
@@ -0,0 +1,139 @@
+package configuration
+
+import (
+	"net/http"
+	"strings"
+)
+
+// redacted replaces the secrets of a redacted configuration.
+const redacted = "<redacted>"
+
+// secretParameterNames are the substrings of the names of the driver,
+// access controller and middleware parameters which hold secrets.
+var secretParameterNames = []string{"secret", "password", "key", "token", "credential"}
+
+// Redacted returns a copy of the configuration in which secrets, such as
+// passwords, keys and notification headers, are replaced, so that it can be
+// displayed. The parameters of storage drivers, access controllers and
+// middlewares are replaced if their name suggests they hold a secret.
+func (config *Configuration) Redacted() *Configuration {
+	c := *config
+
+	c.Log.Hooks = make([]LogHook, len(config.Log.Hooks))
+	for i, hook := range config.Log.Hooks {
+		hook.MailOptions.SMTP.Password = redactString(hook.MailOptions.SMTP.Password)
+		c.Log.Hooks[i] = hook
+	}
+
+	if config.Storage != nil {
+		c.Storage = make(Storage, len(config.Storage))
+		for k, v := range config.Storage {
+			c.Storage[k] = redactParameters(v)
+		}
+	}
+
+	if config.Auth != nil {
+		c.Auth = make(Auth, len(config.Auth))
+		for k, v := range config.Auth {
+			c.Auth[k] = redactParameters(v)
+		}
+	}
+
+	if config.Middleware != nil {
+		c.Middleware = make(map[string][]Middleware, len(config.Middleware))
+		for k, middlewares := range config.Middleware {
+			c.Middleware[k] = make([]Middleware, len(middlewares))
+			for i, middleware := range middlewares {
+				middleware.Options = redactParameters(middleware.Options)
+				c.Middleware[k][i] = middleware
+			}
+		}
+	}
+
+	c.Reporting.Bugsnag.APIKey = redactString(config.Reporting.Bugsnag.APIKey)
+	c.Reporting.NewRelic.LicenseKey = redactString(config.Reporting.NewRelic.LicenseKey)
+	c.HTTP.Secret = redactString(config.HTTP.Secret)
+	c.Redis.Password = redactString(config.Redis.Password)
+	c.Proxy.Password = redactString(config.Proxy.Password)
+
+	c.Notifications.Endpoints = make([]Endpoint, len(config.Notifications.Endpoints))
+	for i, endpoint := range config.Notifications.Endpoints {
+		endpoint.Headers = redactHeaders(endpoint.Headers)
+		c.Notifications.Endpoints[i] = endpoint
+	}
+
+	c.Health.HTTPCheckers = make([]HTTPChecker, len(config.Health.HTTPCheckers))
+	for i, checker := range config.Health.HTTPCheckers {
+		checker.Headers = redactHeaders(checker.Headers)
+		c.Health.HTTPCheckers[i] = checker
+	}
+
+	return &c
+}
+
+func redactString(s string) string {
+	if s == "" {
+		return s
+	}
+	return redacted
+}
+
+// redactHeaders returns a copy of the headers with every value replaced, as
+// headers commonly carry credentials.
+func redactHeaders(headers http.Header) http.Header {
+	if headers == nil {
+		return nil
+	}
+
+	r := make(http.Header, len(headers))
+	for k, values := range headers {
+		r[k] = make([]string, len(values))
+		for i := range values {
+			r[k][i] = redacted
+		}
+	}
+	return r
+}
+
+// redactParameters returns a copy of the parameters, replacing those whose
+// name suggests they hold a secret, including in nested maps.
+func redactParameters(parameters Parameters) Parameters {
+	if parameters == nil {
+		return nil
+	}
+
+	r := make(Parameters, len(parameters))
+	for k, v := range parameters {
+		r[k] = redactParameter(k, v)
+	}
+	return r
+}
+
+func redactParameter(name string, value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+
+	name = strings.ToLower(name)
+	for _, secret := range secretParameterNames {
+		if strings.Contains(name, secret) {
+			return redacted
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return map[string]interface{}(redactParameters(v))
+	case map[interface{}]interface{}:
+		r := make(map[interface{}]interface{}, len(v))
+		for k, nested := range v {
+			if s, ok := k.(string); ok {
+				r[k] = redactParameter(s, nested)
+			} else {
+				r[k] = nested
+			}
+		}
+		return r
+	}
+	return value
+}
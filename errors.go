@@ -35,6 +35,16 @@ func (err ErrRepositoryUnknown) Error() string {
 	return fmt.Sprintf("unknown repository name=%s", err.Name)
 }
 
+// ErrRepositoryExists is returned if the named repository already exists
+// where a new repository was expected.
+type ErrRepositoryExists struct {
+	Name string
+}
+
+func (err ErrRepositoryExists) Error() string {
+	return fmt.Sprintf("repository name=%s already exists", err.Name)
+}
+
 // ErrRepositoryNameInvalid should be used to denote an invalid repository
 // name. Reason may set, indicating the cause of invalidity.
 type ErrRepositoryNameInvalid struct {
@@ -46,6 +56,49 @@ func (err ErrRepositoryNameInvalid) Error() string {
 	return fmt.Sprintf("repository name %q invalid: %v", err.Name, err.Reason)
 }
 
+// ErrQuotaExceeded is returned when storing content would take the bytes
+// linked into a repository, or into the repositories of a namespace, over
+// the configured limit.
+type ErrQuotaExceeded struct {
+	// Name is the repository or namespace subject to the quota.
+	Name string `json:"name"`
+
+	// Namespace is true if Name is a namespace.
+	Namespace bool `json:"namespace"`
+
+	// Limit is the maximum number of bytes which may be linked.
+	Limit int64 `json:"limit"`
+
+	// Usage is the number of bytes already linked.
+	Usage int64 `json:"usage"`
+
+	// Size is the size of the content which was refused.
+	Size int64 `json:"size"`
+}
+
+func (err ErrQuotaExceeded) Error() string {
+	scope := "repository"
+	if err.Namespace {
+		scope = "namespace"
+	}
+	return fmt.Sprintf("quota exceeded for %s %s: usage=%d size=%d limit=%d", scope, err.Name, err.Usage, err.Size, err.Limit)
+}
+
+// ErrTagImmutable is returned when a tag subject to an immutable tag policy
+// would be moved to a different manifest or deleted, or the manifest it
+// refers to would be deleted.
+type ErrTagImmutable struct {
+	// Tag is the immutable tag.
+	Tag string `json:"tag"`
+
+	// Digest is the digest of the manifest the tag refers to.
+	Digest digest.Digest `json:"digest"`
+}
+
+func (err ErrTagImmutable) Error() string {
+	return fmt.Sprintf("tag=%s is immutable and refers to %s", err.Tag, err.Digest)
+}
+
 // ErrManifestUnknown is returned if the manifest is not known by the
 // registry.
 type ErrManifestUnknown struct {
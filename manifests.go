@@ -61,6 +61,19 @@ type ManifestService interface {
 	//Enumerate(ctx context.Context, manifests []Manifest, last Manifest) (n int, err error)
 }
 
+// ManifestEnumerator enables iterating over manifests
+type ManifestEnumerator interface {
+	// Enumerate calls ingester for each manifest revision in the service.
+	Enumerate(ctx context.Context, ingester func(digest.Digest) error) error
+}
+
+// SignaturesGetter provides an interface for getting the signatures of a
+// schema1 manifest. If the digest referred to is not a schema1 manifest, an
+// empty list should be returned.
+type SignaturesGetter interface {
+	GetSignatures(ctx context.Context, manifestDigest digest.Digest) ([]digest.Digest, error)
+}
+
 // Describable is an interface for descriptors
 type Describable interface {
 	Descriptor() Descriptor
@@ -2,6 +2,7 @@ package notifications
 
 import (
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/docker/distribution"
@@ -23,7 +24,7 @@ var _ Listener = &bridge{}
 // URLBuilder defines a subset of url builder to be used by the event listener.
 type URLBuilder interface {
 	BuildManifestURL(name reference.Named) (string, error)
-	BuildBlobURL(ref reference.Canonical) (string, error)
+	BuildBlobURL(ref reference.Canonical, values ...url.Values) (string, error)
 }
 
 // NewBridge returns a notification listener that writes records to sink,
@@ -85,6 +86,24 @@ func (b *bridge) BlobDeleted(repo reference.Named, desc distribution.Descriptor)
 	return b.createBlobEventAndWrite(EventActionDelete, repo, desc)
 }
 
+func (b *bridge) TagDeleted(repo reference.Named, tag string) error {
+	event := b.createEvent(EventActionDelete)
+	event.Target.Repository = repo.Name()
+	event.Target.Tag = tag
+
+	ref, err := reference.WithTag(repo, tag)
+	if err != nil {
+		return err
+	}
+
+	event.Target.URL, err = b.ub.BuildManifestURL(ref)
+	if err != nil {
+		return err
+	}
+
+	return b.sink.Write(*event)
+}
+
 func (b *bridge) createManifestEventAndWrite(action string, repo reference.Named, sm distribution.Manifest) error {
 	manifestEvent, err := b.createManifestEvent(action, repo, sm)
 	if err != nil {
@@ -74,6 +74,42 @@ func TestEventBridgeManifestDeleted(t *testing.T) {
 	}
 }
 
+func TestEventBridgeTagDeleted(t *testing.T) {
+	l := createTestEnv(t, testSinkFn(func(events ...Event) error {
+		if len(events) != 1 {
+			t.Fatalf("unexpected number of events: %v != 1", len(events))
+		}
+
+		event := events[0]
+		if event.Action != EventActionDelete {
+			t.Fatalf("unexpected event action: %q != %q", event.Action, EventActionDelete)
+		}
+		if event.Target.Repository != repo || event.Target.Tag != "latest" {
+			t.Fatalf("unexpected event target: %#v", event.Target)
+		}
+		if event.Source != source || event.Actor != actor {
+			t.Fatalf("unexpected event source or actor: %#v, %#v", event.Source, event.Actor)
+		}
+
+		repoRef, _ := reference.ParseNamed(repo)
+		ref, _ := reference.WithTag(repoRef, "latest")
+		u, err := ub.BuildManifestURL(ref)
+		if err != nil {
+			t.Fatalf("error building expected url: %v", err)
+		}
+		if event.Target.URL != u {
+			t.Fatalf("incorrect url passed: \n%q != \n%q", event.Target.URL, u)
+		}
+
+		return nil
+	}))
+
+	repoRef, _ := reference.ParseNamed(repo)
+	if err := l.TagDeleted(repoRef, "latest"); err != nil {
+		t.Fatalf("unexpected error notifying tag delete: %v", err)
+	}
+}
+
 func createTestEnv(t *testing.T, fn testSinkFn) Listener {
 	pk, err := libtrust.GenerateECP256PrivateKey()
 	if err != nil {
@@ -66,6 +66,10 @@ type Event struct {
 		// from if appropriate.
 		FromRepository string `json:"fromRepository,omitempty"`
 
+		// Tag identifies the tag the event is about, for events on tags
+		// rather than content, such as the deletion of a tag.
+		Tag string `json:"tag,omitempty"`
+
 		// URL provides a direct link to the content.
 		URL string `json:"url,omitempty"`
 	} `json:"target,omitempty"`
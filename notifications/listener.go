@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/Sirupsen/logrus"
@@ -33,10 +34,16 @@ type BlobListener interface {
 	BlobDeleted(repo reference.Named, desc distribution.Descriptor) error
 }
 
+// TagListener describes a listener that can respond to tag related events.
+type TagListener interface {
+	TagDeleted(repo reference.Named, tag string) error
+}
+
 // Listener combines all repository events into a single interface.
 type Listener interface {
 	ManifestListener
 	BlobListener
+	TagListener
 }
 
 type repositoryListener struct {
@@ -70,6 +77,13 @@ func (rl *repositoryListener) Blobs(ctx context.Context) distribution.BlobStore
 	}
 }
 
+func (rl *repositoryListener) Tags(ctx context.Context) distribution.TagService {
+	return &tagServiceListener{
+		TagService: rl.Repository.Tags(ctx),
+		parent:     rl,
+	}
+}
+
 type manifestServiceListener struct {
 	distribution.ManifestService
 	parent *repositoryListener
@@ -190,6 +204,15 @@ type blobWriterListener struct {
 	parent *blobServiceListener
 }
 
+func (bwl *blobWriterListener) WriteChunk(ctx context.Context, offset, size int64, r io.Reader) error {
+	chunkWriter, ok := bwl.BlobWriter.(distribution.BlobChunkWriter)
+	if !ok {
+		return distribution.ErrUnsupported
+	}
+
+	return chunkWriter.WriteChunk(ctx, offset, size, r)
+}
+
 func (bwl *blobWriterListener) Commit(ctx context.Context, desc distribution.Descriptor) (distribution.Descriptor, error) {
 	committed, err := bwl.BlobWriter.Commit(ctx, desc)
 	if err == nil {
@@ -200,3 +223,19 @@ func (bwl *blobWriterListener) Commit(ctx context.Context, desc distribution.Des
 
 	return committed, err
 }
+
+type tagServiceListener struct {
+	distribution.TagService
+	parent *repositoryListener
+}
+
+func (tsl *tagServiceListener) Untag(ctx context.Context, tag string) error {
+	err := tsl.TagService.Untag(ctx, tag)
+	if err == nil {
+		if err := tsl.parent.listener.TagDeleted(tsl.parent.Repository.Name(), tag); err != nil {
+			context.GetLogger(ctx).Errorf("error dispatching tag delete to listener: %v", err)
+		}
+	}
+
+	return err
+}
@@ -38,6 +38,10 @@ func TestListener(t *testing.T) {
 	// Now take the registry through a number of operations
 	checkExerciseRepository(t, repository)
 
+	if err := repository.Tags(ctx).Untag(ctx, "thetag"); err != nil {
+		t.Fatalf("unexpected error untagging: %v", err)
+	}
+
 	expectedOps := map[string]int{
 		"manifest:push": 1,
 		"manifest:pull": 1,
@@ -45,6 +49,7 @@ func TestListener(t *testing.T) {
 		"layer:push": 2,
 		"layer:pull": 2,
 		// "layer:delete":    0, // deletes not supported for now
+		"tag:delete": 1,
 	}
 
 	if !reflect.DeepEqual(tl.ops, expectedOps) {
@@ -93,6 +98,11 @@ func (tl *testListener) BlobDeleted(repo reference.Named, desc distribution.Desc
 	return nil
 }
 
+func (tl *testListener) TagDeleted(repo reference.Named, tag string) error {
+	tl.ops["tag:delete"]++
+	return nil
+}
+
 // checkExerciseRegistry takes the registry through all of its operations,
 // carrying out generic checks.
 func checkExerciseRepository(t *testing.T, repository distribution.Repository) {
@@ -183,4 +193,8 @@ func checkExerciseRepository(t *testing.T, repository distribution.Repository) {
 		t.Fatalf("unexpected error fetching manifest: %v", err)
 	}
 
+	if err := repository.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+
 }
@@ -2,6 +2,7 @@ package distribution
 
 import (
 	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/reference"
 )
 
@@ -42,6 +43,71 @@ type Namespace interface {
 	Repositories(ctx context.Context, repos []string, last string) (n int, err error)
 }
 
+// RepositoryEnumerator describes an operation to enumerate repositories
+type RepositoryEnumerator interface {
+	// Enumerate calls ingester for each repository name known to the
+	// registry, in lexical order. Enumeration stops at the first error
+	// returned by ingester.
+	Enumerate(ctx context.Context, ingester func(name string) error) error
+}
+
+// RepositoryUsage describes the storage used by a repository.
+type RepositoryUsage struct {
+	// LinkedBytes is the size of the blobs linked into the repository,
+	// counting each blob once.
+	LinkedBytes int64 `json:"linkedBytes"`
+
+	// UniqueBytes is the size of the linked blobs which are not linked into
+	// any other repository.
+	UniqueBytes int64 `json:"uniqueBytes"`
+
+	// Manifests is the number of manifest revisions in the repository.
+	Manifests int `json:"manifests"`
+
+	// Tags is the number of tags in the repository.
+	Tags int `json:"tags"`
+}
+
+// UsageReporter is implemented by namespaces which account for the storage
+// used by their repositories.
+type UsageReporter interface {
+	// Usage returns the storage used by the named repository.
+	// ErrRepositoryUnknown is returned if the repository is unknown.
+	Usage(ctx context.Context, name reference.Named) (RepositoryUsage, error)
+}
+
+// BlobReferrer describes a repository referencing a blob.
+type BlobReferrer struct {
+	// Name is the name of the repository.
+	Name string `json:"name"`
+
+	// Linked is true if the blob is linked into the repository.
+	Linked bool `json:"linked"`
+
+	// Manifests are the manifest revisions of the repository referencing
+	// the blob as a layer, a configuration or a manifest list entry.
+	Manifests []digest.Digest `json:"manifests"`
+}
+
+// BlobReferrerIndexer is implemented by namespaces which index the
+// repositories and manifests referencing each blob.
+type BlobReferrerIndexer interface {
+	// Referrers returns the repositories which link the blob or have
+	// manifests referencing it, sorted by name. ErrBlobUnknown is returned
+	// if no repository references the blob.
+	Referrers(ctx context.Context, dgst digest.Digest) ([]BlobReferrer, error)
+}
+
+// RepositoryRenamer is implemented by namespaces which can rename
+// repositories in place, without copying their content.
+type RepositoryRenamer interface {
+	// Rename moves the manifests, tags and layer links of the repository
+	// from to the repository to, then removes from. ErrRepositoryUnknown is
+	// returned if from does not exist, ErrRepositoryExists if to does and
+	// ErrUnsupported if from may not be removed.
+	Rename(ctx context.Context, from, to reference.Named) error
+}
+
 // ManifestServiceOption is a function argument for Manifest Service methods
 type ManifestServiceOption interface {
 	Apply(ManifestService) error
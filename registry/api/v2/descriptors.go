@@ -26,6 +26,14 @@ var (
 		Description: `Tag or digest of the target manifest.`,
 	}
 
+	tagParameterDescriptor = ParameterDescriptor{
+		Name:        "tag",
+		Type:        "string",
+		Format:      reference.TagRegexp.String(),
+		Required:    true,
+		Description: `Tag of the target manifest.`,
+	}
+
 	uuidParameterDescriptor = ParameterDescriptor{
 		Name:        "uuid",
 		Type:        "opaque",
@@ -112,6 +120,14 @@ var (
 		},
 	}
 
+	catalogPrefixParameter = ParameterDescriptor{
+		Name:        "prefix",
+		Type:        "string",
+		Description: "Only include repositories whose name starts with prefix, such as a namespace followed by a slash.",
+		Format:      "<prefix>",
+		Required:    false,
+	}
+
 	unauthorizedResponseDescriptor = ResponseDescriptor{
 		Name:        "Authentication Required",
 		StatusCode:  http.StatusUnauthorized,
@@ -134,6 +150,19 @@ var (
 		},
 	}
 
+	tagUnknownResponseDescriptor = ResponseDescriptor{
+		Name:        "Unknown Tag",
+		StatusCode:  http.StatusNotFound,
+		Description: "The tag is not known to the registry.",
+		Body: BodyDescriptor{
+			ContentType: "application/json; charset=utf-8",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeManifestUnknown,
+		},
+	}
+
 	repositoryNotFoundResponseDescriptor = ResponseDescriptor{
 		Name:        "No Such Repository Error",
 		StatusCode:  http.StatusNotFound,
@@ -175,6 +204,40 @@ var (
 			errcode.ErrorCodeDenied,
 		},
 	}
+
+	quotaExceededResponseDescriptor = ResponseDescriptor{
+		Name:        "Quota Exceeded",
+		StatusCode:  http.StatusForbidden,
+		Description: "Storing the content would exceed the storage quota of the repository or of its namespace.",
+		Headers: []ParameterDescriptor{
+			{
+				Name:        "Content-Length",
+				Type:        "integer",
+				Description: "Length of the JSON response body.",
+				Format:      "<length>",
+			},
+		},
+		Body: BodyDescriptor{
+			ContentType: "application/json; charset=utf-8",
+			Format: `{
+    "errors:" [{
+            "code": "QUOTA_EXCEEDED",
+            "message": "storage quota exceeded",
+            "detail": {
+                "name": "<repository or namespace>",
+                "namespace": <true if the namespace quota was exceeded>,
+                "limit": <bytes>,
+                "usage": <bytes>,
+                "size": <bytes>
+            }
+        }
+    ]
+}`,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeQuotaExceeded,
+		},
+	}
 )
 
 const (
@@ -487,6 +550,362 @@ var routeDescriptors = []RouteDescriptor{
 			},
 		},
 	},
+	{
+		Name:        RouteNameTagHistory,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/tags/{tag:" + reference.TagRegexp.String() + "}/history",
+		Entity:      "Tag History",
+		Description: "List and restore the manifests a tag has referred to.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the manifests the tag identified by `name` and `tag` has referred to, most recently tagged first. The `tagged` field holds the last time the tag was made to refer to the manifest and is zero for tags created before the registry recorded tag history.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							tagParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The history of the tag.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "name": <name>,
+    "tag": <tag>,
+    "history": [
+        {
+            "digest": <digest>,
+            "tagged": <RFC3339 time>,
+            "current": <bool>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							tagUnknownResponseDescriptor,
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "POST",
+				Description: "Roll the tag identified by `name` and `tag` back to a manifest it has previously referred to.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							tagParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "digest",
+								Type:        "query",
+								Format:      "<digest>",
+								Regexp:      digest.DigestRegexp,
+								Required:    true,
+								Description: "Digest of the manifest to restore. It must appear in the history of the tag.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusNoContent,
+								Description: "The tag refers to the manifest identified by `digest`.",
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Digest",
+								Description: "The digest is missing, invalid or not in the history of the tag.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							tagUnknownResponseDescriptor,
+							{
+								Name:        "Tag Immutable",
+								Description: "The tag is immutable and cannot be moved.",
+								StatusCode:  http.StatusConflict,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeTagImmutable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameUsage,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/usage",
+		Entity:      "Usage",
+		Description: "Retrieve the storage used by a repository.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the storage used by the repository identified by `name`.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The storage used by the named repository. `linkedBytes` is the size of the blobs linked into the repository, counting each blob once. `uniqueBytes` is the size of the linked blobs which are not linked into any other repository, according to the referrer index. `manifests` and `tags` are the number of manifest revisions and tags in the repository. These figures are kept in storage and updated as content is linked and unlinked and as tags are added and removed.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "name": <name>,
+    "linkedBytes": <bytes>,
+    "uniqueBytes": <bytes>,
+    "manifests": <count>,
+    "tags": <count>
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							{
+								Name:        "Not allowed",
+								Description: "Usage accounting is not supported because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameReferrers,
+		Path:        "/v2/_referrers/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Referrers",
+		Description: "Find the repositories and manifests referencing a blob across the registry.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the repositories which link the blob identified by `digest` or have manifests referencing it. Requires the same access as the catalog. Content pushed before the registry indexed referrers is only reported once the index has been rebuilt with `registry index-referrers`.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							digestPathParameter,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "The repositories referencing the blob, sorted by name. `linked` is true if the blob is linked into the repository, as a layer or a manifest. `manifests` are the manifest revisions of the repository referencing the blob as a layer, a configuration or a manifest list entry.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "digest": <digest>,
+    "repositories": [
+        {
+            "name": <name>,
+            "linked": <true|false>,
+            "manifests": [
+                <digest>,
+                ...
+            ]
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid digest",
+								Description: "The digest is not valid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Unknown blob",
+								Description: "No repository references the blob.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							{
+								Name:        "Not allowed",
+								Description: "Referrers are not indexed because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRename,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/rename",
+		Entity:      "Rename",
+		Description: "Rename a repository without copying its content.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Rename the repository identified by `name` to the name given by the `to` parameter. Manifests, tags and layers are moved to the new name and the old name ceases to exist. Uploads in progress are discarded. Requires full access to `name` and push access to `to`.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "to",
+								Type:        "query",
+								Format:      "<name>",
+								Regexp:      reference.NameRegexp,
+								Required:    true,
+								Description: "New name of the repository.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusNoContent,
+								Description: "The repository has been renamed.",
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Name",
+								Description: "The new name is missing or invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Name Exists",
+								Description: "A repository with the new name already exists.",
+								StatusCode:  http.StatusConflict,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameExists,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							{
+								Name:        "Not allowed",
+								Description: "Repository rename is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
 	{
 		Name:        RouteNameManifest,
 		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
@@ -592,6 +1011,29 @@ var routeDescriptors = []RouteDescriptor{
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							quotaExceededResponseDescriptor,
+							{
+								Name:        "Tag Immutable",
+								Description: "The manifest was uploaded by a tag which is immutable and already refers to a different manifest. The manifest is not tagged.",
+								StatusCode:  http.StatusConflict,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeTagImmutable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "errors:" [{
+            "code": "TAG_IMMUTABLE",
+            "message": "tag is immutable",
+            "detail": {
+                "tag": "<tag>",
+                "digest": "<digest of the manifest the tag refers to>"
+            }
+        }
+    ]
+}`,
+								},
+							},
 							{
 								Name:        "Missing Layer(s)",
 								Description: "One or more layers may be missing during a manifest upload. If so, the missing layers will be enumerated in the error response.",
@@ -628,7 +1070,7 @@ var routeDescriptors = []RouteDescriptor{
 			},
 			{
 				Method:      "DELETE",
-				Description: "Delete the manifest identified by `name` and `reference`. Note that a manifest can _only_ be deleted by `digest`.",
+				Description: "Delete the manifest or tag identified by `name` and `reference`. Deleting by `digest` removes the manifest along with every tag referring to it, while deleting by `tag` only removes that tag.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -663,7 +1105,7 @@ var routeDescriptors = []RouteDescriptor{
 							deniedResponseDescriptor,
 							{
 								Name:        "Unknown Manifest",
-								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest was already deleted if this response is returned.",
+								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest or tag was already deleted if this response is returned.",
 								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameUnknown,
@@ -674,9 +1116,21 @@ var routeDescriptors = []RouteDescriptor{
 									Format:      errorsBody,
 								},
 							},
+							{
+								Name:        "Tag Immutable",
+								Description: "The tag, or a tag referring to the manifest, is immutable and cannot be deleted.",
+								StatusCode:  http.StatusConflict,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeTagImmutable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
 							{
 								Name:        "Not allowed",
-								Description: "Manifest delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								Description: "Manifest or tag delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
 								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
 									errcode.ErrorCodeUnsupported,
@@ -849,7 +1303,7 @@ var routeDescriptors = []RouteDescriptor{
 			},
 			{
 				Method:      "DELETE",
-				Description: "Delete the blob identified by `name` and `digest`",
+				Description: "Delete the blob identified by `name` and `digest`. The delete is refused while manifests in the repository reference the blob, unless `force` is set.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -860,6 +1314,15 @@ var routeDescriptors = []RouteDescriptor{
 							nameParameterDescriptor,
 							digestPathParameter,
 						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "force",
+								Type:        "query",
+								Format:      "<bool>",
+								Required:    false,
+								Description: "Delete the blob even if manifests in the repository reference it, breaking those manifests.",
+							},
+						},
 						Successes: []ResponseDescriptor{
 							{
 								StatusCode: http.StatusAccepted,
@@ -895,6 +1358,18 @@ var routeDescriptors = []RouteDescriptor{
 									ErrorCodeBlobUnknown,
 								},
 							},
+							{
+								Name:        "Blob Referenced",
+								Description: "The blob is referenced by manifests in the repository and `force` is not set.",
+								StatusCode:  http.StatusConflict,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobReferenced,
+								},
+							},
 							{
 								Description: "Blob delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled",
 								StatusCode:  http.StatusMethodNotAllowed,
@@ -1103,6 +1578,7 @@ var routeDescriptors = []RouteDescriptor{
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							quotaExceededResponseDescriptor,
 						},
 					},
 				},
@@ -1266,7 +1742,7 @@ var routeDescriptors = []RouteDescriptor{
 								Type:        "header",
 								Format:      "<start of range>-<end of range, inclusive>",
 								Required:    true,
-								Description: "Range of bytes identifying the desired block of content represented by the body. Start must the end offset retrieved via status check plus one. Note that this is a non-standard use of the `Content-Range` header.",
+								Description: "Range of bytes identifying the desired block of content represented by the body. A chunk starting at the end offset retrieved via status check plus one is appended to the upload. A chunk starting elsewhere is stored apart and assembled, in offset order, when the upload is completed, allowing several chunks to be sent in parallel. Note that this is a non-standard use of the `Content-Range` header.",
 							},
 							{
 								Name:        "Content-Length",
@@ -1328,7 +1804,7 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The `Content-Range` specification cannot be accepted, either because it does not overlap with the current progress or it is invalid.",
+								Description: "The `Content-Range` specification cannot be accepted, either because it is invalid or because the registry cannot store chunks out of order.",
 								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
 							},
 							unauthorizedResponseDescriptor,
@@ -1424,6 +1900,7 @@ var routeDescriptors = []RouteDescriptor{
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							quotaExceededResponseDescriptor,
 						},
 					},
 				},
@@ -1497,8 +1974,9 @@ var routeDescriptors = []RouteDescriptor{
 				Description: "Retrieve a sorted, json list of repositories available in the registry.",
 				Requests: []RequestDescriptor{
 					{
-						Name:        "Catalog Fetch Complete",
-						Description: "Request an unabridged list of repositories available.",
+						Name:            "Catalog Fetch Complete",
+						Description:     "Request an unabridged list of repositories available.",
+						QueryParameters: []ParameterDescriptor{catalogPrefixParameter},
 						Successes: []ResponseDescriptor{
 							{
 								Description: "Returns the unabridged list of repositories as a json response.",
@@ -1526,7 +2004,7 @@ var routeDescriptors = []RouteDescriptor{
 					{
 						Name:            "Catalog Fetch Paginated",
 						Description:     "Return the specified portion of repositories.",
-						QueryParameters: paginationParameters,
+						QueryParameters: append(paginationParameters, catalogPrefixParameter),
 						Successes: []ResponseDescriptor{
 							{
 								StatusCode: http.StatusOK,
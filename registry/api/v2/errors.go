@@ -61,6 +61,16 @@ var (
 		HTTPStatusCode: http.StatusNotFound,
 	})
 
+	// ErrorCodeNameExists is returned when a repository is renamed to the
+	// name of an existing repository.
+	ErrorCodeNameExists = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "NAME_EXISTS",
+		Message: "repository name already exists",
+		Description: `This is returned if a repository is renamed to the name
+		of a repository which already exists.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
+
 	// ErrorCodeManifestUnknown returned when image manifest is unknown.
 	ErrorCodeManifestUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:   "MANIFEST_UNKNOWN",
@@ -133,4 +143,42 @@ var (
 		longer proceed.`,
 		HTTPStatusCode: http.StatusNotFound,
 	})
+
+	// ErrorCodeQuotaExceeded is returned when storing a blob or manifest
+	// would exceed the storage quota of the repository or its namespace.
+	ErrorCodeQuotaExceeded = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "QUOTA_EXCEEDED",
+		Message: "storage quota exceeded",
+		Description: `This error is returned when a blob upload, blob mount or
+		manifest upload would take the bytes stored in a repository, or in
+		the repositories of its namespace, over the configured quota. The
+		detail contains the name of the repository or namespace, the limit,
+		the current usage and the size of the refused content, in bytes.`,
+		HTTPStatusCode: http.StatusForbidden,
+	})
+
+	// ErrorCodeTagImmutable is returned when a manifest put would move an
+	// immutable tag to a different manifest, or a delete would remove one.
+	ErrorCodeTagImmutable = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "TAG_IMMUTABLE",
+		Message: "tag is immutable",
+		Description: `This error is returned when a manifest is uploaded by a
+		tag which is subject to an immutable tag policy and already refers to
+		a different manifest, or when such a tag, or the manifest it refers
+		to, is deleted. The detail contains the tag and the digest of the
+		manifest it refers to.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
+
+	// ErrorCodeBlobReferenced is returned when deleting a blob which is
+	// still referenced by manifests in the repository.
+	ErrorCodeBlobReferenced = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_REFERENCED",
+		Message: "blob is referenced by manifests",
+		Description: `This error is returned when a blob delete is refused
+		because manifests in the repository still reference the blob. The
+		detail contains the digests of the referencing manifests. The delete
+		may be forced with the "force" parameter.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
 )
@@ -8,19 +8,27 @@ const (
 	RouteNameBase            = "base"
 	RouteNameManifest        = "manifest"
 	RouteNameTags            = "tags"
+	RouteNameTagHistory      = "tag-history"
 	RouteNameBlob            = "blob"
 	RouteNameBlobUpload      = "blob-upload"
 	RouteNameBlobUploadChunk = "blob-upload-chunk"
 	RouteNameCatalog         = "catalog"
+	RouteNameUsage           = "usage"
+	RouteNameRename          = "rename"
+	RouteNameReferrers       = "referrers"
 )
 
 var allEndpoints = []string{
 	RouteNameManifest,
 	RouteNameCatalog,
 	RouteNameTags,
+	RouteNameTagHistory,
 	RouteNameBlob,
 	RouteNameBlobUpload,
 	RouteNameBlobUploadChunk,
+	RouteNameUsage,
+	RouteNameRename,
+	RouteNameReferrers,
 }
 
 // Router builds a gorilla router with named routes for the various API
@@ -87,6 +87,43 @@ func TestRouter(t *testing.T) {
 				"name": "docker.com/foo/bar/baz",
 			},
 		},
+		{
+			RouteName:  RouteNameTagHistory,
+			RequestURI: "/v2/foo/bar/tags/latest/history",
+			Vars: map[string]string{
+				"name": "foo/bar",
+				"tag":  "latest",
+			},
+		},
+		{
+			// a repository may be named like the history route
+			RouteName:  RouteNameTags,
+			RequestURI: "/v2/foo/tags/v1/history/tags/list",
+			Vars: map[string]string{
+				"name": "foo/tags/v1/history",
+			},
+		},
+		{
+			RouteName:  RouteNameUsage,
+			RequestURI: "/v2/foo/bar/usage",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameRename,
+			RequestURI: "/v2/foo/bar/rename",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameReferrers,
+			RequestURI: "/v2/_referrers/sha256:abcdef0919234",
+			Vars: map[string]string{
+				"digest": "sha256:abcdef0919234",
+			},
+		},
 		{
 			RouteName:  RouteNameBlob,
 			RequestURI: "/v2/foo/bar/blobs/sha256:abcdef0919234",
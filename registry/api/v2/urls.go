@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/reference"
 	"github.com/gorilla/mux"
 )
@@ -112,8 +113,9 @@ func (ub *URLBuilder) BuildCatalogURL(values ...url.Values) (string, error) {
 	return appendValuesURL(catalogURL, values...).String(), nil
 }
 
-// BuildTagsURL constructs a url to list the tags in the named repository.
-func (ub *URLBuilder) BuildTagsURL(name reference.Named) (string, error) {
+// BuildTagsURL constructs a url to list the tags in the named repository,
+// with any url values appended.
+func (ub *URLBuilder) BuildTagsURL(name reference.Named, values ...url.Values) (string, error) {
 	route := ub.cloneRoute(RouteNameTags)
 
 	tagsURL, err := route.URL("name", name.Name())
@@ -121,7 +123,58 @@ func (ub *URLBuilder) BuildTagsURL(name reference.Named) (string, error) {
 		return "", err
 	}
 
-	return tagsURL.String(), nil
+	return appendValuesURL(tagsURL, values...).String(), nil
+}
+
+// BuildTagHistoryURL constructs a url to list the history of the tag
+// identified by ref.
+func (ub *URLBuilder) BuildTagHistoryURL(ref reference.NamedTagged, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameTagHistory)
+
+	historyURL, err := route.URL("name", ref.Name(), "tag", ref.Tag())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(historyURL, values...).String(), nil
+}
+
+// BuildUsageURL constructs a url to retrieve the storage used by the named
+// repository.
+func (ub *URLBuilder) BuildUsageURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameUsage)
+
+	usageURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return usageURL.String(), nil
+}
+
+// BuildReferrersURL constructs a url to find the repositories and manifests
+// referencing the blob identified by dgst.
+func (ub *URLBuilder) BuildReferrersURL(dgst digest.Digest) (string, error) {
+	route := ub.cloneRoute(RouteNameReferrers)
+
+	referrersURL, err := route.URL("digest", dgst.String())
+	if err != nil {
+		return "", err
+	}
+
+	return referrersURL.String(), nil
+}
+
+// BuildRenameURL constructs a url to rename the named repository.
+func (ub *URLBuilder) BuildRenameURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameRename)
+
+	renameURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(renameURL, values...).String(), nil
 }
 
 // BuildManifestURL constructs a url for the manifest identified by name and
@@ -146,7 +199,7 @@ func (ub *URLBuilder) BuildManifestURL(ref reference.Named) (string, error) {
 }
 
 // BuildBlobURL constructs the url for the blob identified by name and dgst.
-func (ub *URLBuilder) BuildBlobURL(ref reference.Canonical) (string, error) {
+func (ub *URLBuilder) BuildBlobURL(ref reference.Canonical, values ...url.Values) (string, error) {
 	route := ub.cloneRoute(RouteNameBlob)
 
 	layerURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
@@ -154,7 +207,7 @@ func (ub *URLBuilder) BuildBlobURL(ref reference.Canonical) (string, error) {
 		return "", err
 	}
 
-	return layerURL.String(), nil
+	return appendValuesURL(layerURL, values...).String(), nil
 }
 
 // BuildBlobUploadURL constructs a url to begin a blob upload in the
@@ -29,6 +29,35 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				return urlBuilder.BuildTagsURL(fooBarRef)
 			},
 		},
+		{
+			description:  "test usage url",
+			expectedPath: "/v2/foo/bar/usage",
+			build: func() (string, error) {
+				return urlBuilder.BuildUsageURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test tag history url",
+			expectedPath: "/v2/foo/bar/tags/latest/history",
+			build: func() (string, error) {
+				ref, _ := reference.WithTag(fooBarRef, "latest")
+				return urlBuilder.BuildTagHistoryURL(ref)
+			},
+		},
+		{
+			description:  "test referrers url",
+			expectedPath: "/v2/_referrers/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			build: func() (string, error) {
+				return urlBuilder.BuildReferrersURL("sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+			},
+		},
+		{
+			description:  "test rename url",
+			expectedPath: "/v2/foo/bar/rename?to=foo%2Fbaz",
+			build: func() (string, error) {
+				return urlBuilder.BuildRenameURL(fooBarRef, url.Values{"to": []string{"foo/baz"}})
+			},
+		},
 		{
 			description:  "test manifest url",
 			expectedPath: "/v2/foo/bar/manifests/tag",
@@ -111,6 +111,26 @@ func (uic userInfoContext) Value(key interface{}) interface{} {
 	return uic.Context.Value(key)
 }
 
+// WithGrantedAccess returns a context recording the access granted to the
+// caller, for access controllers which know it in full, such as the scopes of
+// a bearer token. granted reports whether the given access is included.
+// Handlers listing many resources check it with Granted rather than
+// authorizing the caller once per resource.
+func WithGrantedAccess(ctx context.Context, granted func(Access) bool) context.Context {
+	return context.WithValue(ctx, "auth.granted", granted)
+}
+
+// Granted reports whether the access recorded in the context with
+// WithGrantedAccess includes access. ok is false if the access controller
+// did not record the access granted to the caller.
+func Granted(ctx context.Context, access Access) (granted bool, ok bool) {
+	fn, ok := ctx.Value("auth.granted").(func(Access) bool)
+	if !ok {
+		return false, false
+	}
+	return fn(access), true
+}
+
 // InitFunc is the type of an AccessController factory function and is used
 // to register the constructor for different AccesController backends.
 type InitFunc func(options map[string]interface{}) (AccessController, error)
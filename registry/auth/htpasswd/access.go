@@ -77,6 +77,8 @@ func (ac *accessController) Authorized(ctx context.Context, accessRecords ...aut
 		}
 	}
 
+	// Any authenticated user is granted access to every resource.
+	ctx = auth.WithGrantedAccess(ctx, func(auth.Access) bool { return true })
 	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
 }
 
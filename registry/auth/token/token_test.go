@@ -383,4 +383,14 @@ func TestAccessController(t *testing.T) {
 	if userInfo.Name != "foo" {
 		t.Fatalf("expected user name %q, got %q", "foo", userInfo.Name)
 	}
+
+	// The access granted by the token is recorded, whether requested or not.
+	if granted, ok := auth.Granted(authCtx, testAccess); !ok || !granted {
+		t.Fatalf("token accessController did not record the granted access: %v, %v", granted, ok)
+	}
+	otherAccess := testAccess
+	otherAccess.Action = "qux"
+	if granted, ok := auth.Granted(authCtx, otherAccess); !ok || granted {
+		t.Fatalf("unexpected access granted: %v, %v", granted, ok)
+	}
 }
@@ -202,6 +202,38 @@ func (t *tags) All(ctx context.Context) ([]string, error) {
 	return tags, HandleErrorResponse(resp)
 }
 
+// List fills tags with the tags following last, requesting a page of the
+// size of tags.
+func (t *tags) List(ctx context.Context, tags []string, last string) (int, error) {
+	u, err := t.ub.BuildTagsURL(t.name, buildCatalogValues(len(tags), last))
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := t.client.Get(u)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if !SuccessStatus(resp.StatusCode) {
+		return 0, HandleErrorResponse(resp)
+	}
+
+	tagsResponse := struct {
+		Tags []string `json:"tags"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&tagsResponse); err != nil {
+		return 0, err
+	}
+
+	n := copy(tags, tagsResponse.Tags)
+	if resp.Header.Get("Link") == "" {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
 func descriptorFromResponse(response *http.Response) (distribution.Descriptor, error) {
 	desc := distribution.Descriptor{}
 	headers := response.Header
@@ -284,12 +316,65 @@ func (t *tags) Lookup(ctx context.Context, digest distribution.Descriptor) ([]st
 	panic("not implemented")
 }
 
+// History returns the manifests the tag has referred to.
+func (t *tags) History(ctx context.Context, tag string) ([]distribution.TagHistoryEntry, error) {
+	ref, err := reference.WithTag(t.name, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := t.ub.BuildTagHistoryURL(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if SuccessStatus(resp.StatusCode) {
+		historyResponse := struct {
+			History []distribution.TagHistoryEntry `json:"history"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&historyResponse); err != nil {
+			return nil, err
+		}
+		return historyResponse.History, nil
+	}
+	return nil, HandleErrorResponse(resp)
+}
+
 func (t *tags) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
 	panic("not implemented")
 }
 
+// Untag removes the tag, leaving the manifest it refers to in place.
 func (t *tags) Untag(ctx context.Context, tag string) error {
-	panic("not implemented")
+	ref, err := reference.WithTag(t.name, tag)
+	if err != nil {
+		return err
+	}
+	u, err := t.ub.BuildManifestURL(ref)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if SuccessStatus(resp.StatusCode) {
+		return nil
+	}
+	return HandleErrorResponse(resp)
 }
 
 type manifests struct {
@@ -686,8 +771,47 @@ func (bs *blobs) Resume(ctx context.Context, id string) (distribution.BlobWriter
 	panic("not implemented")
 }
 
-func (bs *blobs) Delete(ctx context.Context, dgst digest.Digest) error {
-	return bs.statter.Clear(ctx, dgst)
+// deleteOptions is a collection of blob deletion modifiers intended to be
+// configured by the BlobDeleteOption.Apply method.
+type deleteOptions struct {
+	Force bool
+}
+
+// WithForce returns a BlobDeleteOption which asks the registry to delete the
+// blob even if manifests in the repository still reference it.
+func WithForce() distribution.BlobDeleteOption {
+	return optionFunc(func(v interface{}) error {
+		opts, ok := v.(*deleteOptions)
+		if !ok {
+			return fmt.Errorf("unexpected options type: %T", v)
+		}
+
+		opts.Force = true
+
+		return nil
+	})
+}
+
+func (bs *blobs) Delete(ctx context.Context, dgst digest.Digest, options ...distribution.BlobDeleteOption) error {
+	var opts deleteOptions
+
+	for _, option := range options {
+		err := option.Apply(&opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !opts.Force {
+		return bs.statter.Clear(ctx, dgst)
+	}
+
+	statter := &blobStatter{
+		name:   bs.name,
+		ub:     bs.ub,
+		client: bs.client,
+	}
+	return statter.delete(ctx, dgst, url.Values{"force": {"true"}})
 }
 
 type blobStatter struct {
@@ -749,11 +873,16 @@ func buildCatalogValues(maxEntries int, last string) url.Values {
 }
 
 func (bs *blobStatter) Clear(ctx context.Context, dgst digest.Digest) error {
+	return bs.delete(ctx, dgst)
+}
+
+// delete issues a DELETE request for the blob identified by dgst.
+func (bs *blobStatter) delete(ctx context.Context, dgst digest.Digest, values ...url.Values) error {
 	ref, err := reference.WithDigest(bs.name, dgst)
 	if err != nil {
 		return err
 	}
-	blobURL, err := bs.ub.BuildBlobURL(ref)
+	blobURL, err := bs.ub.BuildBlobURL(ref, values...)
 	if err != nil {
 		return err
 	}
@@ -807,6 +807,40 @@ func TestManifestDelete(t *testing.T) {
 	// TODO(dmcgowan): Check for specific unknown error
 }
 
+func TestTagDelete(t *testing.T) {
+	repo, _ := reference.ParseNamed("test.example.com/repo/delete")
+	var m testutil.RequestResponseMap
+	m = append(m, testutil.RequestResponseMapping{
+		Request: testutil.Request{
+			Method: "DELETE",
+			Route:  "/v2/" + repo.Name() + "/manifests/latest",
+		},
+		Response: testutil.Response{
+			StatusCode: http.StatusAccepted,
+			Headers: http.Header(map[string][]string{
+				"Content-Length": {"0"},
+			}),
+		},
+	})
+
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(context.Background(), repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tags := r.Tags(ctx)
+
+	if err := tags.Untag(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Untag(ctx, "other"); err == nil {
+		t.Fatal("Expected error deleting unknown tag")
+	}
+}
+
 func TestManifestPut(t *testing.T) {
 	repo, _ := reference.ParseNamed("test.example.com/repo/delete")
 	m1, dgst, _ := newRandomSchemaV1Manifest(repo, "other", 6)
@@ -1026,6 +1060,45 @@ func TestCatalogInParts(t *testing.T) {
 	}
 }
 
+func TestTagsInParts(t *testing.T) {
+	repo, _ := reference.ParseNamed("test.example.com/repo/tags")
+	var m testutil.RequestResponseMap
+	addTestCatalog(
+		"/v2/"+repo.Name()+"/tags/list?n=2",
+		[]byte("{\"name\":\"repo/tags\",\"tags\":[\"a\", \"b\"]}"),
+		"</v2/"+repo.Name()+"/tags/list?last=b&n=2>", &m)
+	addTestCatalog(
+		"/v2/"+repo.Name()+"/tags/list?last=b&n=2",
+		[]byte("{\"name\":\"repo/tags\",\"tags\":[\"c\"]}"),
+		"", &m)
+
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(context.Background(), repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tags := make([]string, 2)
+	numFilled, err := r.Tags(ctx).List(ctx, tags, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numFilled != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Fatalf("Got wrong tags: %v", tags[:numFilled])
+	}
+
+	numFilled, err = r.Tags(ctx).List(ctx, tags, "b")
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if numFilled != 1 || tags[0] != "c" {
+		t.Fatalf("Got wrong tags: %v", tags[:numFilled])
+	}
+}
+
 func TestSanitizeLocation(t *testing.T) {
 	for _, testcase := range []struct {
 		description string
@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fsckVerify bool
+	fsckRepair bool
+)
+
+// FsckCmd is the cobra command that corresponds to the fsck subcommand
+var FsckCmd = &cobra.Command{
+	Use:   "fsck <config>",
+	Short: "`fsck` checks the integrity of the registry storage",
+	Long: "`fsck` reports links pointing at missing blobs, tags pointing at " +
+		"missing manifest revisions and manifests referencing missing blobs. " +
+		"The registry should be stopped or in read-only mode while repairing.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := newStorageDriver(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v\n", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s\n", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v\n", err)
+			os.Exit(1)
+		}
+
+		problems, err := storage.Fsck(ctx, driver, registry, storage.FsckOpts{
+			Verify: fsckVerify,
+			Repair: fsckRepair,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to check storage: %v\n", err)
+			os.Exit(1)
+		}
+
+		remaining := 0
+		for _, problem := range problems {
+			if !problem.Repaired {
+				remaining++
+			}
+		}
+
+		fmt.Printf("\n%d problems found, %d repaired\n", len(problems), len(problems)-remaining)
+		if remaining > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	FsckCmd.Flags().BoolVar(&fsckVerify, "verify", false, "re-hash blob data and report digest mismatches")
+	FsckCmd.Flags().BoolVarP(&fsckRepair, "repair", "r", false, "remove dangling links and tags")
+}
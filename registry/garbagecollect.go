@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dryRun      bool
+	gracePeriod time.Duration
+)
+
+// GCCmd is the cobra command that corresponds to the garbage-collect subcommand
+var GCCmd = &cobra.Command{
+	Use:   "garbage-collect <config>",
+	Short: "`garbage-collect` deletes layers not referenced by any manifests",
+	Long: "`garbage-collect` deletes layers not referenced by any manifests. " +
+		"The registry should be stopped or in read-only mode while it runs, " +
+		"unless a grace period is given.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := newStorageDriver(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v\n", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s\n", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err = storage.MarkAndSweep(ctx, driver, registry, storage.GCOpts{
+			DryRun:      dryRun,
+			GracePeriod: gracePeriod,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to garbage collect: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	GCCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "do everything except remove the blobs")
+	GCCmd.Flags().DurationVarP(&gracePeriod, "grace-period", "g", 0, "collect online, sparing blobs written or linked within this period")
+}
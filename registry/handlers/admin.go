@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/proxy/scheduler"
+	"github.com/docker/distribution/registry/storage"
+	"gopkg.in/yaml.v2"
+)
+
+// scheduledExpirer is implemented by pull through caches, which remove
+// cached objects once they expire.
+type scheduledExpirer interface {
+	ScheduledExpiries() []scheduler.Entry
+}
+
+// adminUploadsResponse lists the uploads in progress.
+type adminUploadsResponse struct {
+	Uploads []storage.Upload `json:"uploads"`
+	Errors  []string         `json:"errors,omitempty"`
+}
+
+// adminPurgeResponse lists the upload directories purged.
+type adminPurgeResponse struct {
+	Deleted []string `json:"deleted"`
+	DryRun  bool     `json:"dryrun,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// adminEndpoint describes a notification endpoint and its metrics.
+type adminEndpoint struct {
+	Name    string                        `json:"name"`
+	URL     string                        `json:"url"`
+	Metrics notifications.EndpointMetrics `json:"metrics"`
+}
+
+// AdminHandler returns the handler of the admin API, which is meant to be
+// served on a separate listener from the registry API, as it is not subject
+// to access control. It serves:
+//
+//	GET /uploads              the uploads in progress
+//	POST /uploads/purge       purges the uploads started before olderthan
+//	GET /config               the configuration, with secrets redacted
+//	GET /proxy/scheduler      the expiries of a pull through cache
+//	GET /notifications        the notification endpoints and their metrics
+//	GET, PUT /readonly        the read-only mode
+func (app *App) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/uploads", adminMethod("GET", app.adminUploads))
+	mux.Handle("/uploads/purge", adminMethod("POST", app.adminPurgeUploads))
+	mux.Handle("/config", adminMethod("GET", app.adminConfig))
+	mux.Handle("/proxy/scheduler", adminMethod("GET", app.adminScheduler))
+	mux.Handle("/notifications", adminMethod("GET", app.adminNotifications))
+	mux.Handle("/readonly", app.readOnlyHandler())
+	return mux
+}
+
+// adminMethod returns a handler serving requests with the method using h and
+// rejecting the others.
+func adminMethod(method string, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	})
+}
+
+// adminUploads lists the uploads in progress, oldest first.
+func (app *App) adminUploads(w http.ResponseWriter, r *http.Request) {
+	uploads, errs := storage.OutstandingUploads(app, app.driver)
+	app.serveAdminJSON(w, adminUploadsResponse{
+		Uploads: uploads,
+		Errors:  errorStrings(errs),
+	})
+}
+
+// adminPurgeUploads purges the uploads started more than the olderthan
+// duration ago. Nothing is removed if dryrun is true.
+func (app *App) adminPurgeUploads(w http.ResponseWriter, r *http.Request) {
+	olderThan, err := time.ParseDuration(r.FormValue("olderthan"))
+	if err != nil {
+		http.Error(w, "invalid olderthan duration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var dryRun bool
+	if v := r.FormValue("dryrun"); v != "" {
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid dryrun value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctxu.GetLogger(app).Infof("upload purge of uploads older than %s requested by %s, dryrun=%t", olderThan, r.RemoteAddr, dryRun)
+
+	deleted, errs := storage.PurgeUploads(app, app.driver, time.Now().Add(-olderThan), !dryRun)
+	if deleted == nil {
+		deleted = []string{}
+	}
+
+	app.serveAdminJSON(w, adminPurgeResponse{
+		Deleted: deleted,
+		DryRun:  dryRun,
+		Errors:  errorStrings(errs),
+	})
+}
+
+// adminConfig returns the configuration in effect, as YAML, with secrets
+// redacted.
+func (app *App) adminConfig(w http.ResponseWriter, r *http.Request) {
+	p, err := yaml.Marshal(app.Config.Redacted())
+	if err != nil {
+		http.Error(w, "error encoding configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-yaml; charset=utf-8")
+	w.Write(p)
+}
+
+// adminScheduler lists the scheduled expiries of the pull through cache,
+// soonest first.
+func (app *App) adminScheduler(w http.ResponseWriter, r *http.Request) {
+	expirer, ok := app.registry.(scheduledExpirer)
+	if !ok {
+		http.Error(w, "registry is not a pull through cache", http.StatusNotFound)
+		return
+	}
+
+	app.serveAdminJSON(w, expirer.ScheduledExpiries())
+}
+
+// adminNotifications lists the enabled notification endpoints and their
+// metrics. Endpoint headers are omitted as they may carry credentials.
+func (app *App) adminNotifications(w http.ResponseWriter, r *http.Request) {
+	endpoints := make([]adminEndpoint, 0, len(app.events.endpoints))
+	for _, endpoint := range app.events.endpoints {
+		e := adminEndpoint{
+			Name: endpoint.Name(),
+			URL:  endpoint.URL(),
+		}
+		endpoint.ReadMetrics(&e.Metrics)
+		endpoints = append(endpoints, e)
+	}
+
+	app.serveAdminJSON(w, endpoints)
+}
+
+func (app *App) serveAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		ctxu.GetLogger(app).Errorf("error encoding admin response: %v", err)
+	}
+}
+
+func errorStrings(errs []error) []string {
+	var s []string
+	for _, err := range errs {
+		s = append(s, err.Error())
+	}
+	return s
+}
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"bytes"
+	"crypto"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -14,9 +17,13 @@ import (
 	"path"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/configuration"
@@ -29,6 +36,10 @@ import (
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/auth/token"
+	"github.com/docker/distribution/registry/proxy/scheduler"
+	"github.com/docker/distribution/registry/storage"
 	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
 	"github.com/docker/distribution/testutil"
 	"github.com/docker/libtrust"
@@ -187,6 +198,370 @@ func TestCatalogAPI(t *testing.T) {
 	}
 }
 
+// TestCatalogAPIPrefix tests the prefix parameter of the /v2/_catalog
+// endpoint.
+func TestCatalogAPIPrefix(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	for _, image := range []string{"foo/cccc", "bar/aaaa", "foo-bar/aaaa", "foo/aaaa", "foobar/aaaa", "foo/bbbb"} {
+		createRepository(env, t, image, "sometag")
+	}
+
+	checkPrefix := func() {
+		repos, link := getCatalog(t, env, url.Values{"n": []string{"2"}, "prefix": []string{"foo/"}}, nil)
+		if !reflect.DeepEqual(repos, []string{"foo/aaaa", "foo/bbbb"}) {
+			t.Fatalf("unexpected repositories: %v", repos)
+		}
+		if link == "" {
+			t.Fatalf("expected a link to more repositories")
+		}
+
+		values := checkLink(t, link, 2, "foo/bbbb")
+		if values.Get("prefix") != "foo/" {
+			t.Fatalf("expected prefix to be kept in link, got %q", link)
+		}
+
+		repos, link = getCatalog(t, env, values, nil)
+		if !reflect.DeepEqual(repos, []string{"foo/cccc"}) {
+			t.Fatalf("unexpected repositories: %v", repos)
+		}
+		if link != "" {
+			t.Fatalf("unexpected link to more repositories: %q", link)
+		}
+
+		repos, _ = getCatalog(t, env, url.Values{"prefix": []string{"baz"}}, nil)
+		if len(repos) != 0 {
+			t.Fatalf("unexpected repositories: %v", repos)
+		}
+
+		// The repositories starting with the prefix are listed in lexical
+		// order, though "foo-bar" is stored before "foo".
+		repos, link = getCatalog(t, env, url.Values{"prefix": []string{"foo"}}, nil)
+		if !reflect.DeepEqual(repos, []string{"foo-bar/aaaa", "foo/aaaa", "foo/bbbb", "foo/cccc", "foobar/aaaa"}) {
+			t.Fatalf("unexpected repositories: %v", repos)
+		}
+		if link != "" {
+			t.Fatalf("unexpected link to more repositories: %q", link)
+		}
+	}
+
+	checkPrefix()
+
+	// Registries unable to enumerate their repositories are listed in
+	// batches.
+	env.app.registry = namespaceOnly{env.app.registry}
+	checkPrefix()
+}
+
+// namespaceOnly hides the optional interfaces of the wrapped namespace, such
+// as distribution.RepositoryEnumerator.
+type namespaceOnly struct {
+	distribution.Namespace
+}
+
+// TestCatalogAPIAuthorizedOnly tests that the catalog lists only the
+// repositories the caller may pull when configured to.
+func TestCatalogAPIAuthorizedOnly(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	for _, image := range []string{"team1/aaaa", "team2/aaaa", "team1/bbbb", "team1/cccc"} {
+		createRepository(env, t, image, "sometag")
+	}
+
+	env.app.accessController = namespaceAccessController{}
+
+	header := http.Header{"Authorization": []string{"team1"}}
+	repos, _ := getCatalog(t, env, url.Values{}, header)
+	if len(repos) != 4 {
+		t.Fatalf("expected all repositories without filtering: %v", repos)
+	}
+
+	env.app.Config.Catalog.AuthorizedOnly = true
+
+	repos, link := getCatalog(t, env, url.Values{"n": []string{"2"}}, header)
+	if !reflect.DeepEqual(repos, []string{"team1/aaaa", "team1/bbbb"}) {
+		t.Fatalf("unexpected repositories: %v", repos)
+	}
+	if link == "" {
+		t.Fatalf("expected a link to more repositories")
+	}
+
+	repos, link = getCatalog(t, env, checkLink(t, link, 2, "team1/bbbb"), header)
+	if !reflect.DeepEqual(repos, []string{"team1/cccc"}) {
+		t.Fatalf("unexpected repositories: %v", repos)
+	}
+	if link != "" {
+		t.Fatalf("unexpected link to more repositories: %q", link)
+	}
+
+	header.Set("Authorization", "team2")
+	repos, _ = getCatalog(t, env, url.Values{}, header)
+	if !reflect.DeepEqual(repos, []string{"team2/aaaa"}) {
+		t.Fatalf("unexpected repositories: %v", repos)
+	}
+}
+
+// TestCatalogAPIAuthorizedOnlyToken tests that with token authentication the
+// catalog lists the repositories which the catalog token grants pull access
+// to, verifying the token once per request.
+func TestCatalogAPIAuthorizedOnlyToken(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	for _, image := range []string{"team1/aaaa", "team2/aaaa", "team1/bbbb", "team1/cccc"} {
+		createRepository(env, t, image, "sometag")
+	}
+
+	key, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := libtrust.GenerateCACert(key, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootCertBundle, err := ioutil.TempFile("", "rootcertbundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(rootCertBundle.Name())
+	err = pem.Encode(rootCertBundle, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	rootCertBundle.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessController, err := auth.GetAccessController("token", map[string]interface{}{
+		"realm":          "https://auth.example.com/token/",
+		"issuer":         "test-issuer",
+		"service":        "test-service",
+		"rootcertbundle": rootCertBundle.Name(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingAccessController{AccessController: accessController}
+	env.app.accessController = counting
+	env.app.Config.Catalog.AuthorizedOnly = true
+
+	catalogAccess := &token.ResourceActions{Type: "registry", Name: "catalog", Actions: []string{"*"}}
+
+	// Without repository scopes in the token, no repository is listed.
+	header := http.Header{"Authorization": []string{"Bearer " + makeTestToken(t, key, catalogAccess)}}
+	repos, _ := getCatalog(t, env, url.Values{}, header)
+	if len(repos) != 0 {
+		t.Fatalf("unexpected repositories: %v", repos)
+	}
+
+	header.Set("Authorization", "Bearer "+makeTestToken(t, key, catalogAccess,
+		&token.ResourceActions{Type: "repository", Name: "team1/aaaa", Actions: []string{"pull"}},
+		&token.ResourceActions{Type: "repository", Name: "team1/bbbb", Actions: []string{"push"}},
+		&token.ResourceActions{Type: "repository", Name: "team1/cccc", Actions: []string{"*"}},
+	))
+	atomic.StoreInt32(&counting.calls, 0)
+	repos, link := getCatalog(t, env, url.Values{}, header)
+	if !reflect.DeepEqual(repos, []string{"team1/aaaa", "team1/cccc"}) {
+		t.Fatalf("unexpected repositories: %v", repos)
+	}
+	if link != "" {
+		t.Fatalf("unexpected link to more repositories: %q", link)
+	}
+	if calls := atomic.LoadInt32(&counting.calls); calls != 1 {
+		t.Fatalf("expected the token to be verified once, got %d", calls)
+	}
+}
+
+// countingAccessController counts the authorization checks of the wrapped
+// access controller.
+type countingAccessController struct {
+	auth.AccessController
+	calls int32
+}
+
+func (ac *countingAccessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	atomic.AddInt32(&ac.calls, 1)
+	return ac.AccessController.Authorized(ctx, accessRecords...)
+}
+
+// makeTestToken returns a bearer token for the test-service audience, signed
+// by key and granting access.
+func makeTestToken(t *testing.T, key libtrust.PrivateKey, access ...*token.ResourceActions) string {
+	rawJWK, err := key.PublicKey().MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	header, err := json.Marshal(token.Header{
+		Type:       "JWT",
+		SigningAlg: "ES256",
+		RawJWK:     json.RawMessage(rawJWK),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := json.Marshal(token.ClaimSet{
+		Issuer:     "test-issuer",
+		Subject:    "foo",
+		Audience:   "test-service",
+		Expiration: now.Add(5 * time.Minute).Unix(),
+		NotBefore:  now.Unix(),
+		IssuedAt:   now.Unix(),
+		JWTID:      "test",
+		Access:     access,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(b []byte) string {
+		return strings.TrimRight(base64.URLEncoding.EncodeToString(b), "=")
+	}
+	payload := encode(header) + "." + encode(claims)
+	signature, _, err := key.Sign(strings.NewReader(payload), crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return payload + "." + encode(signature)
+}
+
+// getCatalog fetches the catalog with the given query values and headers,
+// returning the repositories and the link header.
+func getCatalog(t *testing.T, env *testEnv, values url.Values, header http.Header) ([]string, string) {
+	catalogURL, err := env.builder.BuildCatalogURL(values)
+	if err != nil {
+		t.Fatalf("unexpected error building catalog url: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", catalogURL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "issuing catalog api check", resp, http.StatusOK)
+
+	var ctlg struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+		t.Fatalf("error decoding catalog: %v", err)
+	}
+
+	return ctlg.Repositories, resp.Header.Get("Link")
+}
+
+// namespaceAccessController grants access to the repositories in the
+// namespace given as the Authorization header of the request.
+type namespaceAccessController struct{}
+
+func (namespaceAccessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	req, err := context.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := req.Header.Get("Authorization")
+	for _, access := range accessRecords {
+		if access.Type == "repository" && !strings.HasPrefix(access.Name, namespace+"/") {
+			return nil, namespaceChallenge{}
+		}
+	}
+	return ctx, nil
+}
+
+type namespaceChallenge struct{}
+
+func (namespaceChallenge) SetHeaders(w http.ResponseWriter) {}
+
+func (namespaceChallenge) Error() string {
+	return "access outside of namespace"
+}
+
+func TestTagsAPIPagination(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	imageName, _ := reference.ParseNamed("foo/tags")
+	expected := []string{"a", "b", "c", "d", "e"}
+	for _, tag := range []string{"c", "a", "e", "b", "d"} {
+		createRepository(env, t, imageName.Name(), tag)
+	}
+
+	getTags := func(values url.Values) ([]string, string) {
+		tagsURL, err := env.builder.BuildTagsURL(imageName, values)
+		if err != nil {
+			t.Fatalf("unexpected error building tags url: %v", err)
+		}
+
+		resp, err := http.Get(tagsURL)
+		if err != nil {
+			t.Fatalf("unexpected error issuing request: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "listing tags", resp, http.StatusOK)
+
+		var tagsResponse tagsAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&tagsResponse); err != nil {
+			t.Fatalf("unexpected error decoding tags response: %v", err)
+		}
+		return tagsResponse.Tags, resp.Header.Get("Link")
+	}
+
+	// Without n, every tag is returned at once.
+	tags, link := getTags(nil)
+	sort.Strings(tags)
+	if !reflect.DeepEqual(tags, expected) || link != "" {
+		t.Fatalf("unexpected unpaginated tags: %v, link %q", tags, link)
+	}
+
+	// Follow the Link headers through the pages.
+	var pages [][]string
+	values := url.Values{"n": []string{"2"}}
+	for {
+		tags, link := getTags(values)
+		pages = append(pages, tags)
+		if link == "" {
+			break
+		}
+
+		re := regexp.MustCompile("<(/v2/foo/tags/tags/list.*)>; rel=\"next\"")
+		matches := re.FindStringSubmatch(link)
+		if len(matches) != 2 {
+			t.Fatalf("unexpected link header: %q", link)
+		}
+		linkURL, _ := url.Parse(matches[1])
+		values = linkURL.Query()
+		if values.Get("n") != "2" || values.Get("last") != tags[len(tags)-1] {
+			t.Fatalf("unexpected link header: %q", link)
+		}
+	}
+
+	if !reflect.DeepEqual(pages, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}) {
+		t.Fatalf("unexpected pages: %v", pages)
+	}
+
+	// n=0 requests the default page size, which holds every tag.
+	tags, link = getTags(url.Values{"n": []string{"0"}})
+	if !reflect.DeepEqual(tags, expected) || link != "" {
+		t.Fatalf("unexpected tags with n=0: %v, link %q", tags, link)
+	}
+
+	// Larger values of n are bounded by the default page size.
+	tags, link = getTags(url.Values{"n": []string{"1000000000000"}})
+	if !reflect.DeepEqual(tags, expected) || link != "" {
+		t.Fatalf("unexpected tags with a large n: %v, link %q", tags, link)
+	}
+}
+
 func checkLink(t *testing.T, urlStr string, numEntries int, last string) url.Values {
 	re := regexp.MustCompile("<(/v2/_catalog.*)>; rel=\"next\"")
 	matches := re.FindStringSubmatch(urlStr)
@@ -530,6 +905,195 @@ func testBlobAPI(t *testing.T, env *testEnv, args blobArgs) *testEnv {
 	return env
 }
 
+// TestBlobUploadParallelChunks sends the chunks of a blob to one upload in
+// parallel and out of order, then checks that they are assembled on
+// completion.
+func TestBlobUploadParallelChunks(t *testing.T) {
+	env := newTestEnv(t, false)
+	imageName, _ := reference.ParseNamed("foo/bar")
+
+	data := make([]byte, 4096)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	dgst := digest.FromBytes(data)
+	chunkSize := 1000
+
+	pushChunks := func(uploadURLBase string, skip int) {
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			errs []error
+		)
+
+		for i := 0; i*chunkSize < len(data); i++ {
+			if i == skip {
+				continue
+			}
+
+			start := i * chunkSize
+			end := start + chunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+
+			wg.Add(1)
+			go func(start, end int) {
+				defer wg.Done()
+
+				req, err := http.NewRequest("PATCH", uploadURLBase, bytes.NewReader(data[start:end]))
+				if err == nil {
+					req.Header.Set("Content-Type", "application/octet-stream")
+					req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", start, end-1))
+
+					var resp *http.Response
+					resp, err = http.DefaultClient.Do(req)
+					if err == nil {
+						resp.Body.Close()
+						if resp.StatusCode != http.StatusAccepted {
+							err = fmt.Errorf("unexpected status pushing chunk %d-%d: %v", start, end-1, resp.Status)
+						}
+					}
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}(start, end)
+		}
+
+		wg.Wait()
+		if len(errs) > 0 {
+			t.Fatalf("errors pushing chunks: %v", errs)
+		}
+	}
+
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushChunks(uploadURLBase, -1)
+	layerURL := finishUpload(t, env.builder, imageName, uploadURLBase, dgst)
+
+	resp, err := http.Get(layerURL)
+	checkErr(t, err, "fetching assembled layer")
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching assembled layer", resp, http.StatusOK)
+	body, err := ioutil.ReadAll(resp.Body)
+	checkErr(t, err, "reading assembled layer")
+	if !bytes.Equal(body, data) {
+		t.Fatalf("assembled layer does not match the uploaded data")
+	}
+
+	// A missing chunk fails the upload
+	uploadURLBase, _ = startPushLayer(t, env.builder, imageName)
+	pushChunks(uploadURLBase, 1)
+
+	resp, err = doPushLayer(t, env.builder, imageName, dgst, uploadURLBase, nil)
+	checkErr(t, err, "completing upload with missing chunk")
+	defer resp.Body.Close()
+
+	checkResponse(t, "completing upload with missing chunk", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "completing upload with missing chunk", resp, v2.ErrorCodeBlobUploadInvalid)
+}
+
+// TestBlobUploadChunkLength checks that chunks whose length does not match
+// their Content-Range are refused without being stored.
+func TestBlobUploadChunkLength(t *testing.T) {
+	env := newTestEnv(t, false)
+	imageName, _ := reference.ParseNamed("foo/bar")
+
+	data := make([]byte, 2000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	dgst := digest.FromBytes(data)
+
+	pushChunk := func(uploadURLBase string, start, end int, body []byte, contentLength int64) *http.Response {
+		req, err := http.NewRequest("PATCH", uploadURLBase, bytes.NewReader(body))
+		checkErr(t, err, "creating chunk request")
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", start, end-1))
+		req.ContentLength = contentLength
+
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "pushing chunk")
+		return resp
+	}
+
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+
+	for _, tc := range []struct {
+		description   string
+		start, end    int
+		body          []byte
+		contentLength int64
+	}{
+		{"pushing oversized chunk", 1000, 1400, data[1000:], int64(len(data[1000:]))},
+		// sent without a Content-Length, the chunk is found short once stored
+		{"pushing short chunk", 1000, 2000, data[1000:1400], -1},
+	} {
+		resp := pushChunk(uploadURLBase, tc.start, tc.end, tc.body, tc.contentLength)
+		checkResponse(t, tc.description, resp, http.StatusNotFound)
+		checkBodyHasErrorCodes(t, tc.description, resp, v2.ErrorCodeBlobUploadInvalid)
+		resp.Body.Close()
+	}
+
+	// The refused chunks are not assembled with the other ones, which would
+	// complete the data.
+	resp := pushChunk(uploadURLBase, 1400, 2000, data[1400:], int64(len(data[1400:])))
+	checkResponse(t, "pushing last chunk", resp, http.StatusAccepted)
+	resp.Body.Close()
+
+	resp, err := doPushLayer(t, env.builder, imageName, dgst, uploadURLBase, bytes.NewReader(data[:1000]))
+	checkErr(t, err, "completing upload without the refused chunks")
+	defer resp.Body.Close()
+
+	checkResponse(t, "completing upload without the refused chunks", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "completing upload without the refused chunks", resp, v2.ErrorCodeBlobUploadInvalid)
+}
+
+func TestBlobDeleteReferenced(t *testing.T) {
+	env := newTestEnv(t, true)
+
+	imageName := "foo/bar"
+	dgst := createRepository(env, t, imageName, "latest")
+
+	named, _ := reference.ParseNamed(imageName)
+	repo, err := env.app.registry.Repository(env.ctx, named)
+	checkErr(t, err, "getting repository")
+	manifests, err := repo.Manifests(env.ctx)
+	checkErr(t, err, "getting manifest service")
+	m, err := manifests.Get(env.ctx, dgst)
+	checkErr(t, err, "getting manifest")
+
+	layerRef, _ := reference.WithDigest(named, m.References()[0].Digest)
+	layerURL, err := env.builder.BuildBlobURL(layerRef)
+	checkErr(t, err, "building blob url")
+
+	resp, err := httpDelete(layerURL)
+	checkErr(t, err, "deleting referenced layer")
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting referenced layer", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "deleting referenced layer", resp, v2.ErrorCodeBlobReferenced)
+
+	forceURL, err := env.builder.BuildBlobURL(layerRef, url.Values{"force": []string{"true"}})
+	checkErr(t, err, "building blob url")
+
+	resp, err = httpDelete(forceURL)
+	checkErr(t, err, "forcing delete of referenced layer")
+	defer resp.Body.Close()
+
+	checkResponse(t, "forcing delete of referenced layer", resp, http.StatusAccepted)
+
+	resp, err = http.Head(layerURL)
+	checkErr(t, err, "checking head on deleted layer")
+	defer resp.Body.Close()
+
+	checkResponse(t, "checking head on deleted layer", resp, http.StatusNotFound)
+}
+
 func testBlobDelete(t *testing.T, env *testEnv, args blobArgs) {
 	// Upload a layer
 	imageName := args.imageName
@@ -654,7 +1218,7 @@ func TestDeleteReadOnly(t *testing.T) {
 	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
 	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layerFile)
 
-	env.app.readOnly = true
+	env.app.SetReadOnly(true, "")
 
 	resp, err := httpDelete(layerURL)
 	if err != nil {
@@ -666,7 +1230,7 @@ func TestDeleteReadOnly(t *testing.T) {
 
 func TestStartPushReadOnly(t *testing.T) {
 	env := newTestEnv(t, true)
-	env.app.readOnly = true
+	env.app.SetReadOnly(true, "")
 
 	imageName, _ := reference.ParseNamed("foo/bar")
 
@@ -684,21 +1248,630 @@ func TestStartPushReadOnly(t *testing.T) {
 	checkResponse(t, "starting push in read-only mode", resp, http.StatusMethodNotAllowed)
 }
 
-func httpDelete(url string) (*http.Response, error) {
-	req, err := http.NewRequest("DELETE", url, nil)
+func TestReadOnlyAdminAPI(t *testing.T) {
+	env := newTestEnv(t, true)
+	admin := httptest.NewServer(env.app.AdminHandler())
+	defer admin.Close()
+
+	setReadOnly := func(status string) map[string]interface{} {
+		req, err := http.NewRequest("PUT", admin.URL+"/readonly", strings.NewReader(status))
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error setting read-only mode: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status setting read-only mode: %v", resp.Status)
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("unexpected error decoding read-only status: %v", err)
+		}
+		return body
+	}
+
+	status := setReadOnly(`{"enabled": true, "message": "storage maintenance until 10:00"}`)
+	if status["enabled"] != true || status["message"] != "storage maintenance until 10:00" {
+		t.Fatalf("unexpected read-only status: %v", status)
+	}
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	layerUploadURL, err := env.builder.BuildBlobUploadURL(imageName)
 	if err != nil {
-		return nil, err
+		t.Fatalf("unexpected error building layer upload url: %v", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := http.Post(layerUploadURL, "", nil)
 	if err != nil {
-		return nil, err
+		t.Fatalf("unexpected error starting layer push: %v", err)
 	}
-	//	defer resp.Body.Close()
-	return resp, err
-}
+	defer resp.Body.Close()
 
-type manifestArgs struct {
+	checkResponse(t, "starting push in read-only mode", resp, http.StatusMethodNotAllowed)
+	errs, _, _ := checkBodyHasErrorCodes(t, "starting push in read-only mode", resp, errcode.ErrorCodeUnsupported)
+	if detail := errs[0].(errcode.Error).Detail; detail != "storage maintenance until 10:00" {
+		t.Fatalf("unexpected error detail: %v", detail)
+	}
+
+	// Reads are still served.
+	baseURL, err := env.builder.BuildBaseURL()
+	if err != nil {
+		t.Fatalf("unexpected error building base url: %v", err)
+	}
+	resp, err = http.Get(baseURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "checking base url in read-only mode", resp, http.StatusOK)
+
+	if status := setReadOnly(`{"enabled": false}`); status["enabled"] != false {
+		t.Fatalf("unexpected read-only status: %v", status)
+	}
+	startPushLayer(t, env.builder, imageName)
+}
+
+func TestAdminAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Notifications: configuration.Notifications{
+			Endpoints: []configuration.Endpoint{
+				{
+					Name: "listener",
+					URL:  "http://127.0.0.1:1/events",
+					Headers: http.Header{
+						"Authorization": []string{"Bearer listenertoken"},
+					},
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.Secret = "httpsecret"
+	env := newTestEnvWithConfig(t, &config)
+	admin := httptest.NewServer(env.app.AdminHandler())
+	defer admin.Close()
+
+	getAdmin := func(path string, expectedStatus int) []byte {
+		resp, err := http.Get(admin.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error getting %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("unexpected status getting %s: %v != %v", path, resp.StatusCode, expectedStatus)
+		}
+
+		p, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("unexpected error reading %s: %v", path, err)
+		}
+		return p
+	}
+
+	purgeUploads := func(query string, expectedStatus int) adminPurgeResponse {
+		resp, err := http.Post(admin.URL+"/uploads/purge?"+query, "", nil)
+		if err != nil {
+			t.Fatalf("unexpected error purging uploads: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("unexpected status purging uploads with %q: %v != %v", query, resp.StatusCode, expectedStatus)
+		}
+
+		var purged adminPurgeResponse
+		if expectedStatus == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&purged); err != nil {
+				t.Fatalf("unexpected error decoding purged uploads: %v", err)
+			}
+		}
+		return purged
+	}
+
+	listUploads := func() []storage.Upload {
+		var uploads adminUploadsResponse
+		if err := json.Unmarshal(getAdmin("/uploads", http.StatusOK), &uploads); err != nil {
+			t.Fatalf("unexpected error decoding uploads: %v", err)
+		}
+		if len(uploads.Errors) != 0 {
+			t.Fatalf("unexpected errors listing uploads: %v", uploads.Errors)
+		}
+		return uploads.Uploads
+	}
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	_, uploadUUID := startPushLayer(t, env.builder, imageName)
+
+	uploads := listUploads()
+	if len(uploads) != 1 || uploads[0].Name != "foo/bar" || uploads[0].ID != uploadUUID {
+		t.Fatalf("unexpected uploads: %v", uploads)
+	}
+
+	purgeUploads("", http.StatusBadRequest)
+	purgeUploads("olderthan=1h&dryrun=maybe", http.StatusBadRequest)
+	if purged := purgeUploads("olderthan=1h", http.StatusOK); len(purged.Deleted) != 0 {
+		t.Fatalf("unexpected purged uploads: %v", purged)
+	}
+	if purged := purgeUploads("olderthan=0s&dryrun=true", http.StatusOK); len(purged.Deleted) != 1 || !purged.DryRun {
+		t.Fatalf("unexpected purged uploads: %v", purged)
+	}
+	if uploads := listUploads(); len(uploads) != 1 {
+		t.Fatalf("unexpected uploads after dry run: %v", uploads)
+	}
+	if purged := purgeUploads("olderthan=0s", http.StatusOK); len(purged.Deleted) != 1 {
+		t.Fatalf("unexpected purged uploads: %v", purged)
+	}
+	if uploads := listUploads(); len(uploads) != 0 {
+		t.Fatalf("unexpected uploads after purge: %v", uploads)
+	}
+
+	// Only the documented method is served.
+	getAdmin("/uploads/purge", http.StatusMethodNotAllowed)
+
+	// Secrets are redacted from the configuration.
+	configYAML := string(getAdmin("/config", http.StatusOK))
+	if strings.Contains(configYAML, "httpsecret") || strings.Contains(configYAML, "listenertoken") {
+		t.Fatalf("configuration not redacted: %s", configYAML)
+	}
+	if !strings.Contains(configYAML, "http://127.0.0.1:1/events") {
+		t.Fatalf("unexpected configuration: %s", configYAML)
+	}
+
+	var endpoints []adminEndpoint
+	if err := json.Unmarshal(getAdmin("/notifications", http.StatusOK), &endpoints); err != nil {
+		t.Fatalf("unexpected error decoding notification endpoints: %v", err)
+	}
+	if len(endpoints) != 1 || endpoints[0].Name != "listener" || endpoints[0].URL != "http://127.0.0.1:1/events" {
+		t.Fatalf("unexpected notification endpoints: %v", endpoints)
+	}
+
+	// The scheduler is only available on pull through caches.
+	getAdmin("/proxy/scheduler", http.StatusNotFound)
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer remote.Close()
+	mirror := newTestEnvWithConfig(t, &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Proxy: configuration.Proxy{
+			RemoteURL: remote.URL,
+		},
+	})
+	mirrorAdmin := httptest.NewServer(mirror.app.AdminHandler())
+	defer mirrorAdmin.Close()
+
+	resp, err := http.Get(mirrorAdmin.URL + "/proxy/scheduler")
+	if err != nil {
+		t.Fatalf("unexpected error getting scheduler entries: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status getting scheduler entries: %v", resp.Status)
+	}
+
+	var entries []scheduler.Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatalf("unexpected error decoding scheduler entries: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("unexpected scheduler entries: %v", entries)
+	}
+}
+
+func TestPushLayerQuotaExceeded(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"quota": configuration.Parameters{
+				"repositories": []interface{}{
+					map[interface{}]interface{}{"name": "foo/*", "limit": 10},
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	layer := []byte("more than ten bytes")
+	layerDigest := digest.FromBytes(layer)
+
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	resp, err := doPushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, bytes.NewReader(layer))
+	if err != nil {
+		t.Fatalf("unexpected error pushing layer: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "pushing layer over quota", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "pushing layer over quota", resp, v2.ErrorCodeQuotaExceeded)
+}
+
+func TestPutManifestTagImmutable(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+			"tags": configuration.Parameters{
+				"immutable": []interface{}{
+					map[interface{}]interface{}{"tag": "v*"},
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	immutableDigest := createRepository(env, t, imageName.Name(), "v1")
+	createRepository(env, t, imageName.Name(), "latest")
+	createRepository(env, t, imageName.Name(), "latest")
+
+	rs, dgstStr, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random layer: %v", err)
+	}
+	layerDigest := digest.Digest(dgstStr)
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, rs)
+
+	unsignedManifest := &schema1.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name:     imageName.Name(),
+		Tag:      "v1",
+		FSLayers: []schema1.FSLayer{{BlobSum: layerDigest}},
+		History:  []schema1.History{{V1Compatibility: ""}},
+	}
+	signedManifest, err := schema1.Sign(unsignedManifest, env.pk)
+	if err != nil {
+		t.Fatalf("unexpected error signing manifest: %v", err)
+	}
+
+	tagRef, _ := reference.WithTag(imageName, "v1")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp := putManifest(t, "moving immutable tag", manifestURL, "", signedManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "moving immutable tag", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "moving immutable tag", resp, v2.ErrorCodeTagImmutable)
+
+	// Neither the tag nor the manifest it refers to may be deleted
+	digestRef, _ := reference.WithDigest(imageName, immutableDigest)
+	digestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+
+	for _, u := range []string{manifestURL, digestURL} {
+		resp, err := httpDelete(u)
+		checkErr(t, err, "deleting immutable tag")
+		defer resp.Body.Close()
+		checkResponse(t, "deleting immutable tag", resp, http.StatusConflict)
+		checkBodyHasErrorCodes(t, "deleting immutable tag", resp, v2.ErrorCodeTagImmutable)
+	}
+
+	resp, err = http.Get(manifestURL)
+	checkErr(t, err, "fetching immutable tag")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching immutable tag", resp, http.StatusOK)
+}
+
+func TestUsageAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	imageName, _ := reference.ParseNamed("foo/bar")
+	usageURL, err := env.builder.BuildUsageURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building usage url: %v", err)
+	}
+
+	resp, err := http.Get(usageURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting usage: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "getting usage of unknown repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "getting usage of unknown repository", resp, v2.ErrorCodeNameUnknown)
+
+	layer := []byte("layer data")
+	layerDigest := digest.FromBytes(layer)
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, bytes.NewReader(layer))
+
+	resp, err = http.Get(usageURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting usage: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "getting usage", resp, http.StatusOK)
+
+	var usage usageAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+		t.Fatalf("unexpected error decoding usage response: %v", err)
+	}
+
+	expected := usageAPIResponse{
+		Name: "foo/bar",
+		RepositoryUsage: distribution.RepositoryUsage{
+			LinkedBytes: int64(len(layer)),
+			UniqueBytes: int64(len(layer)),
+		},
+	}
+	if usage != expected {
+		t.Fatalf("unexpected usage: %#v != %#v", usage, expected)
+	}
+}
+
+func TestReferrersAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	layer := []byte("layer data")
+	layerDigest := digest.FromBytes(layer)
+	referrersURL, err := env.builder.BuildReferrersURL(layerDigest)
+	if err != nil {
+		t.Fatalf("unexpected error building referrers url: %v", err)
+	}
+
+	resp, err := http.Get(referrersURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting referrers: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "getting referrers of unknown blob", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "getting referrers of unknown blob", resp, v2.ErrorCodeBlobUnknown)
+
+	for _, name := range []string{"team1/bar", "team2/bar"} {
+		imageName, _ := reference.ParseNamed(name)
+		uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+		pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, bytes.NewReader(layer))
+	}
+
+	getReferrers := func(namespace string) referrersAPIResponse {
+		req, err := http.NewRequest("GET", referrersURL, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		req.Header.Set("Authorization", namespace)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error getting referrers: %v", err)
+		}
+		defer resp.Body.Close()
+
+		checkResponse(t, "getting referrers", resp, http.StatusOK)
+
+		var referrers referrersAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&referrers); err != nil {
+			t.Fatalf("unexpected error decoding referrers response: %v", err)
+		}
+		return referrers
+	}
+
+	expected := referrersAPIResponse{
+		Digest: layerDigest,
+		Repositories: []distribution.BlobReferrer{
+			{Name: "team1/bar", Linked: true, Manifests: []digest.Digest{}},
+			{Name: "team2/bar", Linked: true, Manifests: []digest.Digest{}},
+		},
+	}
+	if referrers := getReferrers(""); !reflect.DeepEqual(referrers, expected) {
+		t.Fatalf("unexpected referrers: %#v != %#v", referrers, expected)
+	}
+
+	// Referrers are filtered like the catalog.
+	env.app.accessController = namespaceAccessController{}
+	env.app.Config.Catalog.AuthorizedOnly = true
+
+	expected.Repositories = expected.Repositories[1:]
+	if referrers := getReferrers("team2"); !reflect.DeepEqual(referrers, expected) {
+		t.Fatalf("unexpected referrers: %#v != %#v", referrers, expected)
+	}
+
+	req, err := http.NewRequest("GET", referrersURL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	req.Header.Set("Authorization", "team3")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error getting referrers: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "getting referrers outside of namespace", resp, http.StatusNotFound)
+}
+
+func TestRenameAPI(t *testing.T) {
+	imageName, _ := reference.ParseNamed("foo/bar")
+	layer := []byte("layer data")
+	layerDigest := digest.FromBytes(layer)
+
+	// Renaming removes the repository, so it requires deletes
+	env := newTestEnv(t, false)
+	uploadURLBase, _ := startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, bytes.NewReader(layer))
+
+	renameURL, err := env.builder.BuildRenameURL(imageName, url.Values{"to": []string{"foo/baz"}})
+	if err != nil {
+		t.Fatalf("unexpected error building rename url: %v", err)
+	}
+
+	resp, err := http.Post(renameURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error renaming repository: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "renaming repository without deletes", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "renaming repository without deletes", resp, errcode.ErrorCodeUnsupported)
+
+	env = newTestEnv(t, true)
+	uploadURLBase, _ = startPushLayer(t, env.builder, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, bytes.NewReader(layer))
+
+	renameURL, err = env.builder.BuildRenameURL(imageName, url.Values{"to": []string{"foo/baz"}})
+	if err != nil {
+		t.Fatalf("unexpected error building rename url: %v", err)
+	}
+
+	resp, err = http.Post(renameURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error renaming repository: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "renaming repository", resp, http.StatusNoContent)
+
+	newName, _ := reference.ParseNamed("foo/baz")
+	ref, _ := reference.WithDigest(newName, layerDigest)
+	layerURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("error building url: %v", err)
+	}
+
+	resp, err = http.Head(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking head on renamed layer: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "checking head on renamed layer", resp, http.StatusOK)
+
+	resp, err = http.Post(renameURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error renaming repository: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "renaming unknown repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "renaming unknown repository", resp, v2.ErrorCodeNameUnknown)
+
+	existingURL, err := env.builder.BuildRenameURL(newName, url.Values{"to": []string{"foo/baz"}})
+	if err != nil {
+		t.Fatalf("unexpected error building rename url: %v", err)
+	}
+
+	resp, err = http.Post(existingURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error renaming repository: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "renaming to existing repository", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "renaming to existing repository", resp, v2.ErrorCodeNameExists)
+}
+
+func TestTagHistoryAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+
+	imageName := "foo/bar"
+	first := createRepository(env, t, imageName, "prod")
+	second := createRepository(env, t, imageName, "prod")
+
+	named, _ := reference.ParseNamed(imageName)
+	ref, _ := reference.WithTag(named, "prod")
+	historyURL, err := env.builder.BuildTagHistoryURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building tag history url: %v", err)
+	}
+
+	resp, err := http.Get(historyURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting tag history: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "getting tag history", resp, http.StatusOK)
+
+	var historyResponse tagHistoryAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&historyResponse); err != nil {
+		t.Fatalf("error decoding tag history response: %v", err)
+	}
+
+	if len(historyResponse.History) != 2 {
+		t.Fatalf("unexpected tag history: %v", historyResponse.History)
+	}
+	if historyResponse.History[0].Digest != second || !historyResponse.History[0].Current {
+		t.Fatalf("unexpected current entry: %v", historyResponse.History[0])
+	}
+	if historyResponse.History[1].Digest != first || historyResponse.History[1].Current {
+		t.Fatalf("unexpected previous entry: %v", historyResponse.History[1])
+	}
+
+	// Roll back to a digest the tag never referred to
+	unknownURL, _ := env.builder.BuildTagHistoryURL(ref, url.Values{"digest": []string{digest.FromBytes([]byte("unknown")).String()}})
+	resp, err = http.Post(unknownURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error rolling back tag: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "rolling back to unknown digest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "rolling back to unknown digest", resp, v2.ErrorCodeDigestInvalid)
+
+	rollbackURL, _ := env.builder.BuildTagHistoryURL(ref, url.Values{"digest": []string{first.String()}})
+	resp, err = http.Post(rollbackURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error rolling back tag: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "rolling back tag", resp, http.StatusNoContent)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{first.String()},
+	})
+
+	manifestURL, _ := env.builder.BuildManifestURL(ref)
+	resp, err = http.Get(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching rolled back manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{first.String()},
+	})
+
+	unknownTag, _ := reference.WithTag(named, "missing")
+	missingURL, _ := env.builder.BuildTagHistoryURL(unknownTag)
+	resp, err = http.Get(missingURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting tag history: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "getting history of unknown tag", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "getting history of unknown tag", resp, v2.ErrorCodeManifestUnknown)
+}
+
+func httpDelete(url string) (*http.Response, error) {
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	//	defer resp.Body.Close()
+	return resp, err
+}
+
+type manifestArgs struct {
 	imageName reference.Named
 	mediaType string
 	manifest  distribution.Manifest
@@ -734,6 +1907,59 @@ func TestManifestDelete(t *testing.T) {
 	testManifestDelete(t, env, schema2Args)
 }
 
+func TestManifestDeleteTag(t *testing.T) {
+	schema2Repo, _ := reference.ParseNamed("foo/schema2")
+
+	env := newTestEnv(t, true)
+	args := testManifestAPISchema2(t, env, schema2Repo)
+
+	// Tag the manifest a second time.
+	otherRef, _ := reference.WithTag(schema2Repo, "othertag")
+	otherURL, err := env.builder.BuildManifestURL(otherRef)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting manifest by tag", otherURL, args.mediaType, args.manifest)
+	checkResponse(t, "putting manifest by tag", resp, http.StatusCreated)
+
+	tagRef, _ := reference.WithTag(schema2Repo, "schema2tag")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp, err = httpDelete(tagURL)
+	checkErr(t, err, "deleting tag")
+	checkResponse(t, "deleting tag", resp, http.StatusAccepted)
+
+	resp, err = http.Get(tagURL)
+	checkErr(t, err, "fetching deleted tag")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching deleted tag", resp, http.StatusNotFound)
+
+	// The manifest and its other tag are left in place.
+	digestRef, _ := reference.WithDigest(schema2Repo, args.dgst)
+	digestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+	for _, u := range []string{digestURL, otherURL} {
+		resp, err = http.Get(u)
+		checkErr(t, err, "fetching manifest")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching manifest after deleting tag", resp, http.StatusOK)
+	}
+
+	resp, err = httpDelete(tagURL)
+	checkErr(t, err, "re-deleting tag")
+	checkResponse(t, "re-deleting tag", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "re-deleting tag", resp, v2.ErrorCodeManifestUnknown)
+
+	// Tags are not deleted when deletes are disabled.
+	env = newTestEnv(t, false)
+	testManifestAPISchema2(t, env, schema2Repo)
+	tagURL, err = env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp, err = httpDelete(tagURL)
+	checkErr(t, err, "deleting tag")
+	checkResponse(t, "deleting tag with delete disabled", resp, http.StatusMethodNotAllowed)
+}
+
 func TestManifestDeleteDisabled(t *testing.T) {
 	schema1Repo, _ := reference.ParseNamed("foo/schema1")
 	deleteEnabled := false
@@ -9,6 +9,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -63,8 +66,9 @@ type App struct {
 
 	// events contains notification related configuration.
 	events struct {
-		sink   notifications.Sink
-		source notifications.SourceRecord
+		sink      notifications.Sink
+		source    notifications.SourceRecord
+		endpoints []*notifications.Endpoint
 	}
 
 	redis *redis.Pool
@@ -77,8 +81,13 @@ type App struct {
 	// isCache is true if this registry is configured as a pull through cache
 	isCache bool
 
-	// readOnly is true if the registry is in a read-only maintenance mode
-	readOnly bool
+	// deleteEnabled is true if deletes are enabled in the storage
+	// configuration
+	deleteEnabled bool
+
+	// readOnly is the read-only maintenance mode, which can be changed at
+	// runtime through the admin API.
+	readOnly readOnlyMode
 }
 
 // NewApp takes a configuration and returns a configured app, ready to serve
@@ -99,6 +108,10 @@ func NewApp(ctx context.Context, configuration *configuration.Configuration) *Ap
 	app.register(v2.RouteNameManifest, imageManifestDispatcher)
 	app.register(v2.RouteNameCatalog, catalogDispatcher)
 	app.register(v2.RouteNameTags, tagsDispatcher)
+	app.register(v2.RouteNameTagHistory, tagHistoryDispatcher)
+	app.register(v2.RouteNameUsage, usageDispatcher)
+	app.register(v2.RouteNameReferrers, referrersDispatcher)
+	app.register(v2.RouteNameRename, renameDispatcher)
 	app.register(v2.RouteNameBlob, blobDispatcher)
 	app.register(v2.RouteNameBlobUpload, blobUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, blobUploadDispatcher)
@@ -113,6 +126,7 @@ func NewApp(ctx context.Context, configuration *configuration.Configuration) *Ap
 	}
 
 	purgeConfig := uploadPurgeDefaultConfig()
+	var retentionConfig map[interface{}]interface{}
 	if mc, ok := configuration.Storage["maintenance"]; ok {
 		if v, ok := mc["uploadpurging"]; ok {
 			purgeConfig, ok = v.(map[interface{}]interface{})
@@ -120,17 +134,29 @@ func NewApp(ctx context.Context, configuration *configuration.Configuration) *Ap
 				panic("uploadpurging config key must contain additional keys")
 			}
 		}
+		if v, ok := mc["retention"]; ok {
+			retentionConfig, ok = v.(map[interface{}]interface{})
+			if !ok {
+				panic("retention config key must contain additional keys")
+			}
+		}
 		if v, ok := mc["readonly"]; ok {
 			readOnly, ok := v.(map[interface{}]interface{})
 			if !ok {
 				panic("readonly config key must contain additional keys")
 			}
 			if readOnlyEnabled, ok := readOnly["enabled"]; ok {
-				app.readOnly, ok = readOnlyEnabled.(bool)
+				app.readOnly.enabled, ok = readOnlyEnabled.(bool)
 				if !ok {
 					panic("readonly's enabled config key must have a boolean value")
 				}
 			}
+			if readOnlyMessage, ok := readOnly["message"]; ok {
+				app.readOnly.message, ok = readOnlyMessage.(string)
+				if !ok {
+					panic("readonly's message config key must have a string value")
+				}
+			}
 		}
 	}
 
@@ -173,6 +199,7 @@ func NewApp(ctx context.Context, configuration *configuration.Configuration) *Ap
 		if ok {
 			if deleteEnabled, ok := e.(bool); ok && deleteEnabled {
 				options = append(options, storage.EnableDelete)
+				app.deleteEnabled = true
 			}
 		}
 	}
@@ -194,6 +221,20 @@ func NewApp(ctx context.Context, configuration *configuration.Configuration) *Ap
 		options = append(options, storage.EnableRedirect)
 	}
 
+	// configure quotas
+	if qc, ok := configuration.Storage["quota"]; ok {
+		repositories := parseQuotaRules(qc["repositories"])
+		namespaces := parseQuotaRules(qc["namespaces"])
+		options = append(options, storage.Quotas(repositories, namespaces))
+	}
+
+	// configure tag policies
+	if tc, ok := configuration.Storage["tags"]; ok {
+		if rules := parseImmutableTagRules(tc["immutable"]); len(rules) > 0 {
+			options = append(options, storage.ImmutableTags(rules))
+		}
+	}
+
 	// configure storage caches
 	if cc, ok := configuration.Storage["cache"]; ok {
 		v, ok := cc["blobdescriptor"]
@@ -237,6 +278,10 @@ func NewApp(ctx context.Context, configuration *configuration.Configuration) *Ap
 		}
 	}
 
+	if retentionConfig != nil {
+		startRetentionEnforcer(app, app.driver, app.registry, app.ReadOnly, ctxu.GetLogger(app), retentionConfig)
+	}
+
 	app.registry, err = applyRegistryMiddleware(app.Context, app.registry, configuration.Middleware["registry"])
 	if err != nil {
 		panic(err)
@@ -251,6 +296,10 @@ func NewApp(ctx context.Context, configuration *configuration.Configuration) *Ap
 		}
 		app.accessController = accessController
 		ctxu.GetLogger(app).Debugf("configured %q access controller", authType)
+
+		if configuration.Catalog.AuthorizedOnly && authType == "token" {
+			ctxu.GetLogger(app).Warnf("catalog: only the repositories granted pull access in the catalog token are listed; the authorization server must include them")
+		}
 	}
 
 	// configure as a pull through cache
@@ -382,6 +431,7 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 		})
 
 		sinks = append(sinks, endpoint)
+		app.events.endpoints = append(app.events.endpoints, endpoint)
 	}
 
 	// NOTE(stevvooe): Moving to a new queueing implementation is as easy as
@@ -688,6 +738,7 @@ func (app *App) context(w http.ResponseWriter, r *http.Request) *Context {
 	ctx = ctxu.WithLogger(ctx, ctxu.GetLogger(ctx,
 		"vars.name",
 		"vars.reference",
+		"vars.tag",
 		"vars.digest",
 		"vars.uuid"))
 
@@ -728,6 +779,14 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 			// access to the source repository.
 			accessRecords = appendAccessRecords(accessRecords, "GET", fromRepo)
 		}
+		if mux.CurrentRoute(r).GetName() == v2.RouteNameRename {
+			// renaming removes the repository, which requires the same
+			// access as a delete, and pushes to the new name.
+			accessRecords = appendAccessRecords(accessRecords, "DELETE", repo)
+			if toRepo := r.FormValue("to"); toRepo != "" {
+				accessRecords = appendAccessRecords(accessRecords, "POST", toRepo)
+			}
+		}
 	} else {
 		// Only allow the name not to be set on the base route.
 		if app.nameRequired(r) {
@@ -789,7 +848,7 @@ func (app *App) eventBridge(ctx *Context, r *http.Request) notifications.Listene
 func (app *App) nameRequired(r *http.Request) bool {
 	route := mux.CurrentRoute(r)
 	routeName := route.GetName()
-	return route == nil || (routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog)
+	return route == nil || (routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog && routeName != v2.RouteNameReferrers)
 }
 
 // apiBase implements a simple yes-man for doing overall checks against the
@@ -844,7 +903,8 @@ func appendCatalogAccessRecord(accessRecords []auth.Access, r *http.Request) []a
 	route := mux.CurrentRoute(r)
 	routeName := route.GetName()
 
-	if routeName == v2.RouteNameCatalog {
+	// Referrers span repositories like the catalog, with the same access.
+	if routeName == v2.RouteNameCatalog || routeName == v2.RouteNameReferrers {
 		resource := auth.Resource{
 			Type: "registry",
 			Name: "catalog",
@@ -975,3 +1035,209 @@ func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageD
 		}
 	}()
 }
+
+// parseQuotaRules parses a list of quota rules from the quota configuration.
+func parseQuotaRules(config interface{}) []storage.QuotaRule {
+	if config == nil {
+		return nil
+	}
+
+	entries, ok := config.([]interface{})
+	if !ok {
+		panic(fmt.Sprintf("invalid type for quota rules: %#v", config))
+	}
+
+	var rules []storage.QuotaRule
+	for _, entry := range entries {
+		params, ok := entry.(map[interface{}]interface{})
+		if !ok {
+			panic(fmt.Sprintf("invalid type for quota rule: %#v", entry))
+		}
+
+		name, ok := params["name"].(string)
+		if !ok {
+			panic(fmt.Sprintf("quota rule name must be a string: %#v", entry))
+		}
+
+		var limit int64
+		switch v := params["limit"].(type) {
+		case int:
+			limit = int64(v)
+		case int64:
+			limit = v
+		default:
+			panic(fmt.Sprintf("quota rule limit must be an integer: %#v", entry))
+		}
+
+		rules = append(rules, storage.QuotaRule{Pattern: name, Limit: limit})
+	}
+
+	return rules
+}
+
+// parseImmutableTagRules parses the immutable parameter of the tags
+// configuration, which is either a boolean applying to every tag or a list
+// of rules.
+func parseImmutableTagRules(config interface{}) []storage.ImmutableTagRule {
+	switch v := config.(type) {
+	case nil:
+		return nil
+	case bool:
+		if v {
+			return []storage.ImmutableTagRule{{}}
+		}
+		return nil
+	case []interface{}:
+		var rules []storage.ImmutableTagRule
+		for _, entry := range v {
+			params, ok := entry.(map[interface{}]interface{})
+			if !ok {
+				panic(fmt.Sprintf("invalid type for immutable tag rule: %#v", entry))
+			}
+
+			var rule storage.ImmutableTagRule
+			for key, dst := range map[string]*string{"repository": &rule.Repository, "tag": &rule.Tag} {
+				switch p := params[key].(type) {
+				case nil:
+				case string:
+					*dst = p
+				default:
+					panic(fmt.Sprintf("immutable tag rule %s must be a string: %#v", key, entry))
+				}
+			}
+
+			rules = append(rules, rule)
+		}
+		return rules
+	default:
+		panic(fmt.Sprintf("invalid type for immutable tags config: %#v", config))
+	}
+}
+
+func badRetentionConfig(reason string) {
+	panic(fmt.Sprintf("Unable to parse retention configuration: %s", reason))
+}
+
+// parseRetentionPolicies parses the policies list of the retention
+// configuration.
+func parseRetentionPolicies(config interface{}) []storage.RetentionPolicy {
+	entries, ok := config.([]interface{})
+	if !ok {
+		badRetentionConfig("policies is not a list")
+	}
+
+	var policies []storage.RetentionPolicy
+	for _, entry := range entries {
+		params, ok := entry.(map[interface{}]interface{})
+		if !ok {
+			badRetentionConfig("policy must contain additional keys")
+		}
+
+		var policy storage.RetentionPolicy
+		policy.Repository, ok = params["repository"].(string)
+		if !ok {
+			badRetentionConfig("policy repository missing")
+		}
+		if _, err := path.Match(policy.Repository, ""); err != nil {
+			badRetentionConfig(fmt.Sprintf("Cannot parse repository pattern: %s", err.Error()))
+		}
+
+		if keepLast, ok := params["keeplast"]; ok {
+			policy.KeepLast, ok = keepLast.(int)
+			if !ok || policy.KeepLast < 0 {
+				badRetentionConfig("keeplast is not a positive integer")
+			}
+		}
+
+		if maxAge, ok := params["maxage"]; ok {
+			maxAgeStr, ok := maxAge.(string)
+			if !ok {
+				badRetentionConfig("maxage is not a string")
+			}
+			var err error
+			policy.MaxAge, err = time.ParseDuration(maxAgeStr)
+			if err != nil {
+				badRetentionConfig(fmt.Sprintf("Cannot parse maxage: %s", err.Error()))
+			}
+		}
+
+		if keep, ok := params["keep"]; ok {
+			keepStr, ok := keep.(string)
+			if !ok {
+				badRetentionConfig("keep is not a string")
+			}
+			var err error
+			policy.Keep, err = regexp.Compile(keepStr)
+			if err != nil {
+				badRetentionConfig(fmt.Sprintf("Cannot parse keep: %s", err.Error()))
+			}
+		}
+
+		policies = append(policies, policy)
+	}
+
+	return policies
+}
+
+// startRetentionEnforcer schedules a goroutine which will periodically
+// remove the tags selected by the configured retention policies, unless the
+// registry is read-only at the time
+func startRetentionEnforcer(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, readOnly func() (bool, string), log ctxu.Logger, config map[interface{}]interface{}) {
+	if config["enabled"] == false {
+		return
+	}
+
+	policies := parseRetentionPolicies(config["policies"])
+
+	var intervalDuration time.Duration
+	interval, ok := config["interval"]
+	if ok {
+		intervalStr, ok := interval.(string)
+		if !ok {
+			badRetentionConfig("interval is not a string")
+		}
+
+		var err error
+		intervalDuration, err = time.ParseDuration(intervalStr)
+		if err != nil {
+			badRetentionConfig(fmt.Sprintf("Cannot parse interval: %s", err.Error()))
+		}
+		if intervalDuration <= 0 {
+			badRetentionConfig("interval is not a positive duration")
+		}
+	} else {
+		badRetentionConfig("interval missing")
+	}
+
+	var dryRunBool bool
+	if dryRun, ok := config["dryrun"]; ok {
+		dryRunBool, ok = dryRun.(bool)
+		if !ok {
+			badRetentionConfig("cannot parse dryrun")
+		}
+	}
+
+	go func() {
+		jitter := time.Duration(rand.Int()%60) * time.Minute
+		log.Infof("Starting retention enforcement in %s", jitter)
+		time.Sleep(jitter)
+
+		for {
+			if enabled, _ := readOnly(); enabled {
+				log.Infof("Skipping retention enforcement in read-only mode")
+			} else {
+				removed, errs := storage.EnforceRetention(ctx, storageDriver, registry, policies, !dryRunBool)
+				if len(removed) > 0 && dryRunBool {
+					log.Infof("Retention would remove tags: %s", strings.Join(removed, ", "))
+				} else if len(removed) > 0 {
+					log.Infof("Retention removed tags: %s", strings.Join(removed, ", "))
+				}
+				for _, err := range errs {
+					log.Errorf("Retention enforcement error: %v", err)
+				}
+			}
+			log.Infof("Starting retention enforcement in %s", intervalDuration)
+			time.Sleep(intervalDuration)
+		}
+	}()
+}
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/docker/distribution/configuration"
@@ -272,3 +273,22 @@ func TestAppendAccessRecords(t *testing.T) {
 	}
 
 }
+
+// TestRetentionIntervalPositive checks that the retention enforcer refuses
+// an interval which would make it run continuously.
+func TestRetentionIntervalPositive(t *testing.T) {
+	for _, interval := range []string{"0s", "-1h"} {
+		func() {
+			defer func() {
+				if reason, _ := recover().(string); !strings.Contains(reason, "interval") {
+					t.Errorf("expected interval %s to be refused, got %q", interval, reason)
+				}
+			}()
+
+			startRetentionEnforcer(context.Background(), inmemory.New(), nil, nil, context.GetLogger(context.Background()), map[interface{}]interface{}{
+				"interval": interval,
+				"policies": []interface{}{map[interface{}]interface{}{"repository": "*", "keeplast": 1}},
+			})
+		}()
+	}
+}
@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
 	"github.com/gorilla/handlers"
 )
 
@@ -32,16 +34,11 @@ func blobDispatcher(ctx *Context, r *http.Request) http.Handler {
 		Digest:  dgst,
 	}
 
-	mhandler := handlers.MethodHandler{
-		"GET":  http.HandlerFunc(blobHandler.GetBlob),
-		"HEAD": http.HandlerFunc(blobHandler.GetBlob),
+	return handlers.MethodHandler{
+		"GET":    http.HandlerFunc(blobHandler.GetBlob),
+		"HEAD":   http.HandlerFunc(blobHandler.GetBlob),
+		"DELETE": ctx.writeHandler(blobHandler.DeleteBlob),
 	}
-
-	if !ctx.readOnly {
-		mhandler["DELETE"] = http.HandlerFunc(blobHandler.DeleteBlob)
-	}
-
-	return mhandler
 }
 
 // blobHandler serves http blob requests.
@@ -77,9 +74,19 @@ func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 func (bh *blobHandler) DeleteBlob(w http.ResponseWriter, r *http.Request) {
 	context.GetLogger(bh).Debug("DeleteBlob")
 
+	var options []distribution.BlobDeleteOption
+	if force, _ := strconv.ParseBool(r.FormValue("force")); force {
+		options = append(options, storage.WithForce())
+	}
+
 	blobs := bh.Repository.Blobs(bh)
-	err := blobs.Delete(bh, bh.Digest)
+	err := blobs.Delete(bh, bh.Digest, options...)
 	if err != nil {
+		if err, ok := err.(distribution.ErrBlobReferenced); ok {
+			bh.Errors = append(bh.Errors, v2.ErrorCodeBlobReferenced.WithDetail(err.Manifests))
+			return
+		}
+
 		switch err {
 		case distribution.ErrUnsupported:
 			bh.Errors = append(bh.Errors, errcode.ErrorCodeUnsupported)
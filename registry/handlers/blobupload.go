@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/docker/distribution"
 	ctxu "github.com/docker/distribution/context"
@@ -25,15 +28,12 @@ func blobUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
 	}
 
 	handler := handlers.MethodHandler{
-		"GET":  http.HandlerFunc(buh.GetUploadStatus),
-		"HEAD": http.HandlerFunc(buh.GetUploadStatus),
-	}
-
-	if !ctx.readOnly {
-		handler["POST"] = http.HandlerFunc(buh.StartBlobUpload)
-		handler["PATCH"] = http.HandlerFunc(buh.PatchBlobData)
-		handler["PUT"] = http.HandlerFunc(buh.PutBlobUploadComplete)
-		handler["DELETE"] = http.HandlerFunc(buh.CancelBlobUpload)
+		"GET":    http.HandlerFunc(buh.GetUploadStatus),
+		"HEAD":   http.HandlerFunc(buh.GetUploadStatus),
+		"POST":   ctx.writeHandler(buh.StartBlobUpload),
+		"PATCH":  ctx.writeHandler(buh.PatchBlobData),
+		"PUT":    ctx.writeHandler(buh.PutBlobUploadComplete),
+		"DELETE": ctx.writeHandler(buh.CancelBlobUpload),
 	}
 
 	if buh.UUID != "" {
@@ -142,6 +142,8 @@ func (buh *blobUploadHandler) StartBlobUpload(w http.ResponseWriter, r *http.Req
 			}
 		} else if err == distribution.ErrUnsupported {
 			buh.Errors = append(buh.Errors, errcode.ErrorCodeUnsupported)
+		} else if eqe, ok := err.(distribution.ErrQuotaExceeded); ok {
+			buh.Errors = append(buh.Errors, v2.ErrorCodeQuotaExceeded.WithDetail(eqe))
 		} else {
 			buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		}
@@ -193,7 +195,25 @@ func (buh *blobUploadHandler) PatchBlobData(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// TODO(dmcgowan): support Content-Range header to seek and write range
+	if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+		start, end, err := parseContentRange(contentRange)
+		if err != nil {
+			ctxu.GetLogger(buh).Infof("invalid Content-Range %q: %v", contentRange, err)
+			buh.rangeNotSatisfiable(w, r)
+			return
+		}
+
+		offset, err := buh.Upload.Seek(0, os.SEEK_CUR)
+		if err != nil {
+			buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+
+		if start != offset {
+			buh.patchBlobChunk(w, r, start, end)
+			return
+		}
+	}
 
 	if err := copyFullPayload(w, r, buh.Upload, buh, "blob PATCH", &buh.Errors); err != nil {
 		// copyFullPayload reports the error if necessary
@@ -208,6 +228,79 @@ func (buh *blobUploadHandler) PatchBlobData(w http.ResponseWriter, r *http.Reque
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// patchBlobChunk stores a chunk which does not continue the data written so
+// far, such as one of several chunks sent in parallel. Chunks are assembled
+// when the upload is completed.
+func (buh *blobUploadHandler) patchBlobChunk(w http.ResponseWriter, r *http.Request, start, end int64) {
+	chunkWriter, ok := buh.Upload.(distribution.BlobChunkWriter)
+	if !ok {
+		buh.rangeNotSatisfiable(w, r)
+		return
+	}
+
+	size := end - start + 1
+	if r.ContentLength >= 0 && r.ContentLength != size {
+		buh.Errors = append(buh.Errors, v2.ErrorCodeBlobUploadInvalid.WithDetail(fmt.Sprintf("chunk length %d does not match Content-Range %d-%d", r.ContentLength, start, end)))
+		return
+	}
+
+	// A body without a Content-Length is read no further than the range.
+	if err := chunkWriter.WriteChunk(buh, start, size, io.LimitReader(r.Body, size)); err != nil {
+		switch err {
+		case distribution.ErrUnsupported:
+			buh.rangeNotSatisfiable(w, r)
+		case distribution.ErrBlobInvalidLength:
+			buh.Errors = append(buh.Errors, v2.ErrorCodeBlobUploadInvalid.WithDetail(fmt.Sprintf("chunk is shorter than Content-Range %d-%d", start, end)))
+		default:
+			ctxu.GetLogger(buh).Errorf("unknown error writing blob chunk: %v", err)
+			buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	if err := buh.blobUploadResponse(w, r, false); err != nil {
+		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// rangeNotSatisfiable responds to a chunk which cannot be accepted with the
+// current progress of the upload.
+func (buh *blobUploadHandler) rangeNotSatisfiable(w http.ResponseWriter, r *http.Request) {
+	if err := buh.blobUploadResponse(w, r, false); err != nil {
+		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+}
+
+// parseContentRange parses the non-standard Content-Range header of a chunk,
+// "<start of range>-<end of range, inclusive>".
+func parseContentRange(contentRange string) (start, end int64, err error) {
+	parts := strings.SplitN(contentRange, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("malformed range")
+	}
+
+	if start, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return 0, 0, err
+	}
+
+	if end, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return 0, 0, err
+	}
+
+	// An empty chunk ends just before it starts.
+	if start < 0 || end < start-1 {
+		return 0, 0, fmt.Errorf("invalid range")
+	}
+
+	return start, end, nil
+}
+
 // PutBlobUploadComplete takes the final request of a blob upload. The
 // request may include all the blob data or no blob data. Any data
 // provided is received and verified. If successful, the blob is linked
@@ -251,6 +344,8 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 		switch err := err.(type) {
 		case distribution.ErrBlobInvalidDigest:
 			buh.Errors = append(buh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		case distribution.ErrQuotaExceeded:
+			buh.Errors = append(buh.Errors, v2.ErrorCodeQuotaExceeded.WithDetail(err))
 		default:
 			switch err {
 			case distribution.ErrUnsupported:
@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
+	"github.com/docker/distribution"
 	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
 	"github.com/gorilla/handlers"
 )
 
@@ -44,7 +48,13 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 
 	repos := make([]string, maxEntries)
 
-	filled, err := ch.App.registry.Repositories(ch.Context, repos, lastEntry)
+	var filled int
+	prefix := q.Get("prefix")
+	if prefix != "" || ch.catalogAuthorizedOnly() {
+		filled, err = ch.filteredRepositories(repos, lastEntry, prefix)
+	} else {
+		filled, err = ch.App.registry.Repositories(ch.Context, repos, lastEntry)
+	}
 	if err == io.EOF {
 		moreEntries = false
 	} else if err != nil {
@@ -74,6 +84,161 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// catalogAuthorizedOnly reports whether listings spanning repositories, such
+// as the catalog, only include the repositories the caller may pull.
+func (ctx *Context) catalogAuthorizedOnly() bool {
+	return ctx.App.Config.Catalog.AuthorizedOnly && ctx.App.accessController != nil
+}
+
+// authorizedToPull reports whether the access controller allows the caller
+// to pull from the named repository. If the access controller recorded the
+// access granted to the caller, such as the scopes of a token, it is checked
+// without authorizing the request again.
+func (ctx *Context) authorizedToPull(name string) (bool, error) {
+	access := auth.Access{
+		Resource: auth.Resource{
+			Type: "repository",
+			Name: name,
+		},
+		Action: "pull",
+	}
+	if granted, ok := auth.Granted(ctx.Context, access); ok {
+		return granted, nil
+	}
+
+	_, err := ctx.App.accessController.Authorized(ctx.Context, access)
+	if _, ok := err.(auth.Challenge); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// catalogBatchSize is the number of repositories listed at once to fill a
+// filtered catalog page from a registry unable to enumerate them.
+const catalogBatchSize = 1000
+
+var (
+	// errCatalogPageFilled stops the enumeration of the repositories once
+	// a filtered catalog page is filled and more repositories follow.
+	errCatalogPageFilled = errors.New("catalog page filled")
+
+	// errCatalogPrefixPassed stops the enumeration of the repositories once
+	// past those starting with the prefix of a filtered catalog page.
+	errCatalogPrefixPassed = errors.New("catalog prefix passed")
+)
+
+// filteredRepositories fills repos with the repositories lexically following
+// last which start with prefix and, if configured, which the caller may pull.
+// Like Repositories, it returns io.EOF when there are no more entries. The
+// repositories are enumerated once, in lexical order, in which those starting
+// with prefix are contiguous: the enumeration stops at the first repository
+// following them.
+func (ch *catalogHandler) filteredRepositories(repos []string, last, prefix string) (int, error) {
+	if len(repos) == 0 {
+		return 0, io.EOF
+	}
+
+	enumerator, ok := ch.App.registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return ch.filteredRepositoryBatches(repos, last, prefix)
+	}
+
+	var filled int
+	err := enumerator.Enumerate(ch.Context, func(repo string) error {
+		if repo <= last || repo < prefix {
+			return nil
+		}
+		if !strings.HasPrefix(repo, prefix) {
+			return errCatalogPrefixPassed
+		}
+		if filled == len(repos) {
+			return errCatalogPageFilled
+		}
+
+		ok, err := ch.catalogIncludes(repo, prefix)
+		if err != nil {
+			return err
+		}
+		if ok {
+			repos[filled] = repo
+			filled++
+		}
+		return nil
+	})
+
+	switch err {
+	case nil, errCatalogPrefixPassed:
+		return filled, io.EOF
+	case errCatalogPageFilled:
+		return filled, nil
+	default:
+		return filled, err
+	}
+}
+
+// filteredRepositoryBatches fills repos like filteredRepositories, from the
+// registry's listing of the repositories, read catalogBatchSize at a time.
+func (ch *catalogHandler) filteredRepositoryBatches(repos []string, last, prefix string) (int, error) {
+	// Every repository starting with prefix follows prefix without its last
+	// byte, so the repositories up to that point need not be listed.
+	if prefix != "" {
+		if start := prefix[:len(prefix)-1]; last < start {
+			last = start
+		}
+	}
+
+	var filled int
+	batch := make([]string, catalogBatchSize)
+	for {
+		n, err := ch.App.registry.Repositories(ch.Context, batch, last)
+		if err != nil && err != io.EOF {
+			return filled, err
+		}
+
+		for i, repo := range batch[:n] {
+			if repo > prefix && !strings.HasPrefix(repo, prefix) {
+				return filled, io.EOF
+			}
+
+			ok, includeErr := ch.catalogIncludes(repo, prefix)
+			if includeErr != nil {
+				return filled, includeErr
+			}
+			if !ok {
+				continue
+			}
+
+			repos[filled] = repo
+			filled++
+			if filled == len(repos) {
+				if i == n-1 && err == io.EOF {
+					return filled, io.EOF
+				}
+				return filled, nil
+			}
+		}
+
+		if err == io.EOF || n == 0 {
+			return filled, io.EOF
+		}
+		last = batch[n-1]
+	}
+}
+
+// catalogIncludes reports whether repo should be listed in the catalog
+// returned to the caller.
+func (ch *catalogHandler) catalogIncludes(repo, prefix string) (bool, error) {
+	if !strings.HasPrefix(repo, prefix) {
+		return false, nil
+	}
+
+	if !ch.catalogAuthorizedOnly() {
+		return true, nil
+	}
+
+	return ch.authorizedToPull(repo)
+}
+
 // Use the original URL from the request to create a new URL for
 // the link header
 func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string, error) {
@@ -82,9 +247,9 @@ func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string,
 		return "", err
 	}
 
-	v := url.Values{}
-	v.Add("n", strconv.Itoa(maxEntries))
-	v.Add("last", lastEntry)
+	v := calledURL.Query()
+	v.Set("n", strconv.Itoa(maxEntries))
+	v.Set("last", lastEntry)
 
 	calledURL.RawQuery = v.Encode()
 
@@ -51,6 +51,10 @@ func getReference(ctx context.Context) (reference string) {
 	return ctxu.GetStringValue(ctx, "vars.reference")
 }
 
+func getTag(ctx context.Context) (tag string) {
+	return ctxu.GetStringValue(ctx, "vars.tag")
+}
+
 var errDigestNotAvailable = fmt.Errorf("digest not available in context")
 
 func getDigest(ctx context.Context) (dgst digest.Digest, err error) {
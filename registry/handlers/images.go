@@ -39,17 +39,12 @@ func imageManifestDispatcher(ctx *Context, r *http.Request) http.Handler {
 		imageManifestHandler.Digest = dgst
 	}
 
-	mhandler := handlers.MethodHandler{
-		"GET":  http.HandlerFunc(imageManifestHandler.GetImageManifest),
-		"HEAD": http.HandlerFunc(imageManifestHandler.GetImageManifest),
+	return handlers.MethodHandler{
+		"GET":    http.HandlerFunc(imageManifestHandler.GetImageManifest),
+		"HEAD":   http.HandlerFunc(imageManifestHandler.GetImageManifest),
+		"PUT":    ctx.writeHandler(imageManifestHandler.PutImageManifest),
+		"DELETE": ctx.writeHandler(imageManifestHandler.DeleteImageManifest),
 	}
-
-	if !ctx.readOnly {
-		mhandler["PUT"] = http.HandlerFunc(imageManifestHandler.PutImageManifest)
-		mhandler["DELETE"] = http.HandlerFunc(imageManifestHandler.DeleteImageManifest)
-	}
-
-	return mhandler
 }
 
 // imageManifestHandler handles http operations on image manifests.
@@ -270,6 +265,8 @@ func (imh *imageManifestHandler) PutImageManifest(w http.ResponseWriter, r *http
 					}
 				}
 			}
+		case distribution.ErrQuotaExceeded:
+			imh.Errors = append(imh.Errors, v2.ErrorCodeQuotaExceeded.WithDetail(err))
 		default:
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		}
@@ -282,7 +279,12 @@ func (imh *imageManifestHandler) PutImageManifest(w http.ResponseWriter, r *http
 		tags := imh.Repository.Tags(imh)
 		err = tags.Tag(imh, imh.Tag, desc)
 		if err != nil {
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			switch err := err.(type) {
+			case distribution.ErrTagImmutable:
+				imh.Errors = append(imh.Errors, v2.ErrorCodeTagImmutable.WithDetail(err))
+			default:
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
 			return
 		}
 
@@ -312,6 +314,11 @@ func (imh *imageManifestHandler) PutImageManifest(w http.ResponseWriter, r *http
 func (imh *imageManifestHandler) DeleteImageManifest(w http.ResponseWriter, r *http.Request) {
 	ctxu.GetLogger(imh).Debug("DeleteImageManifest")
 
+	if imh.Tag != "" {
+		imh.deleteTag(w)
+		return
+	}
+
 	manifests, err := imh.Repository.Manifests(imh)
 	if err != nil {
 		imh.Errors = append(imh.Errors, err)
@@ -320,6 +327,11 @@ func (imh *imageManifestHandler) DeleteImageManifest(w http.ResponseWriter, r *h
 
 	err = manifests.Delete(imh, imh.Digest)
 	if err != nil {
+		if _, ok := err.(distribution.ErrTagImmutable); ok {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeTagImmutable.WithDetail(err))
+			return
+		}
+
 		switch err {
 		case digest.ErrDigestUnsupported:
 		case digest.ErrDigestInvalidFormat:
@@ -353,3 +365,30 @@ func (imh *imageManifestHandler) DeleteImageManifest(w http.ResponseWriter, r *h
 
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// deleteTag removes the tag, leaving the manifest it refers to and the other
+// tags referring to that manifest in place.
+func (imh *imageManifestHandler) deleteTag(w http.ResponseWriter) {
+	if !imh.App.deleteEnabled {
+		imh.Errors = append(imh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	if err := imh.Repository.Tags(imh).Untag(imh, imh.Tag); err != nil {
+		switch err.(type) {
+		case distribution.ErrTagUnknown:
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		case distribution.ErrTagImmutable:
+			imh.Errors = append(imh.Errors, v2.ErrorCodeTagImmutable.WithDetail(err))
+		default:
+			if err == distribution.ErrUnsupported {
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnsupported)
+			} else {
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+// readOnlyMode is the read-only maintenance mode of the registry, which can
+// be changed while serving requests.
+type readOnlyMode struct {
+	sync.RWMutex
+	enabled bool
+	message string // returned to rejected write requests
+}
+
+// readOnlyStatus is the representation of the read-only mode in the admin
+// API.
+type readOnlyStatus struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// ReadOnly reports whether the registry is in read-only mode, along with the
+// message returned to write requests.
+func (app *App) ReadOnly() (bool, string) {
+	app.readOnly.RLock()
+	defer app.readOnly.RUnlock()
+	return app.readOnly.enabled, app.readOnly.message
+}
+
+// SetReadOnly enables or disables the read-only mode. The message, if any,
+// is returned in the detail of the errors of rejected write requests.
+func (app *App) SetReadOnly(enabled bool, message string) {
+	app.readOnly.Lock()
+	defer app.readOnly.Unlock()
+	app.readOnly.enabled = enabled
+	app.readOnly.message = message
+}
+
+// readOnlyHandler returns a handler for the admin API reporting the
+// read-only mode on GET and changing it on PUT, both as JSON objects with
+// "enabled" and "message" fields.
+func (app *App) readOnlyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+		case "PUT":
+			var status readOnlyStatus
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				http.Error(w, "invalid read-only status: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			app.SetReadOnly(status.Enabled, status.Message)
+			ctxu.GetLogger(app).Infof("read-only mode set to %t by %s: %q", status.Enabled, r.RemoteAddr, status.Message)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var status readOnlyStatus
+		status.Enabled, status.Message = app.ReadOnly()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			ctxu.GetLogger(app).Errorf("error encoding read-only status: %v", err)
+		}
+	})
+}
+
+// writeHandler returns a handler serving the request with h, unless the
+// registry is in read-only mode, in which case the request is rejected.
+func (ctx *Context) writeHandler(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readOnly, message := ctx.ReadOnly()
+		if !readOnly {
+			h(w, r)
+			return
+		}
+
+		if message != "" {
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnsupported.WithDetail(message))
+		} else {
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnsupported)
+		}
+	})
+}
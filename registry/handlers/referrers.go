@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// referrersDispatcher constructs the referrers handler api endpoint.
+func referrersDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	referrersHandler := &referrersHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(referrersHandler.GetReferrers),
+	}
+}
+
+// referrersHandler handles requests for the repositories and manifests
+// referencing a blob.
+type referrersHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+type referrersAPIResponse struct {
+	Digest       digest.Digest               `json:"digest"`
+	Repositories []distribution.BlobReferrer `json:"repositories"`
+}
+
+// GetReferrers returns the repositories referencing the blob. If the catalog
+// is restricted to the repositories the caller may pull, so are referrers.
+func (rh *referrersHandler) GetReferrers(w http.ResponseWriter, r *http.Request) {
+	indexer, ok := rh.App.registry.(distribution.BlobReferrerIndexer)
+	if !ok {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	referrers, err := indexer.Referrers(rh, rh.Digest)
+	if err != nil {
+		switch err {
+		case distribution.ErrBlobUnknown:
+			rh.Errors = append(rh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(rh.Digest))
+		default:
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	if rh.catalogAuthorizedOnly() {
+		authorized := referrers[:0]
+		for _, referrer := range referrers {
+			ok, err := rh.authorizedToPull(referrer.Name)
+			if err != nil {
+				rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+				return
+			}
+			if ok {
+				authorized = append(authorized, referrer)
+			}
+		}
+		referrers = authorized
+
+		// Don't disclose that the blob exists elsewhere.
+		if len(referrers) == 0 {
+			rh.Errors = append(rh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(rh.Digest))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(referrersAPIResponse{
+		Digest:       rh.Digest,
+		Repositories: referrers,
+	}); err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// renameDispatcher constructs the rename handler api endpoint.
+func renameDispatcher(ctx *Context, r *http.Request) http.Handler {
+	renameHandler := &renameHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"POST": ctx.writeHandler(renameHandler.RenameRepository),
+	}
+}
+
+// renameHandler handles requests to rename a repository.
+type renameHandler struct {
+	*Context
+}
+
+// RenameRepository moves the repository to the name given by the "to"
+// parameter.
+func (rh *renameHandler) RenameRepository(w http.ResponseWriter, r *http.Request) {
+	ctxu.GetLogger(rh).Debug("RenameRepository")
+
+	renamer, ok := rh.App.registry.(distribution.RepositoryRenamer)
+	if !ok {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	to, err := reference.ParseNamed(r.FormValue("to"))
+	if err != nil {
+		rh.Errors = append(rh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
+		return
+	}
+
+	if err := renamer.Rename(rh, rh.Repository.Name(), to); err != nil {
+		if err == distribution.ErrUnsupported {
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+			return
+		}
+
+		switch err := err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			rh.Errors = append(rh.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": err.Name}))
+		case distribution.ErrRepositoryExists:
+			rh.Errors = append(rh.Errors, v2.ErrorCodeNameExists.WithDetail(map[string]string{"name": err.Name}))
+		default:
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusNoContent)
+}
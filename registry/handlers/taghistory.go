@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// tagHistoryDispatcher constructs the tag history handler api endpoint.
+func tagHistoryDispatcher(ctx *Context, r *http.Request) http.Handler {
+	tagHistoryHandler := &tagHistoryHandler{
+		Context: ctx,
+		Tag:     getTag(ctx),
+	}
+
+	return handlers.MethodHandler{
+		"GET":  http.HandlerFunc(tagHistoryHandler.GetTagHistory),
+		"POST": ctx.writeHandler(tagHistoryHandler.RollbackTag),
+	}
+}
+
+// tagHistoryHandler handles requests for the history of a tag.
+type tagHistoryHandler struct {
+	*Context
+
+	Tag string
+}
+
+type tagHistoryAPIResponse struct {
+	Name    string                         `json:"name"`
+	Tag     string                         `json:"tag"`
+	History []distribution.TagHistoryEntry `json:"history"`
+}
+
+// GetTagHistory returns a json list of the manifests the tag has referred to.
+func (thh *tagHistoryHandler) GetTagHistory(w http.ResponseWriter, r *http.Request) {
+	ctxu.GetLogger(thh).Debug("GetTagHistory")
+
+	history, err := thh.Repository.Tags(thh).History(thh, thh.Tag)
+	if err != nil {
+		thh.appendTagError(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(tagHistoryAPIResponse{
+		Name:    thh.Repository.Name().Name(),
+		Tag:     thh.Tag,
+		History: history,
+	}); err != nil {
+		thh.Errors = append(thh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// RollbackTag makes the tag refer to the manifest given by the "digest"
+// parameter, which must appear in the history of the tag.
+func (thh *tagHistoryHandler) RollbackTag(w http.ResponseWriter, r *http.Request) {
+	ctxu.GetLogger(thh).Debug("RollbackTag")
+
+	dgst, err := digest.ParseDigest(r.FormValue("digest"))
+	if err != nil {
+		thh.Errors = append(thh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		return
+	}
+
+	tags := thh.Repository.Tags(thh)
+	history, err := tags.History(thh, thh.Tag)
+	if err != nil {
+		thh.appendTagError(err)
+		return
+	}
+
+	found := false
+	for _, entry := range history {
+		if entry.Digest == dgst {
+			found = true
+			break
+		}
+	}
+	if !found {
+		thh.Errors = append(thh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(fmt.Sprintf("%s is not in the history of tag %s", dgst, thh.Tag)))
+		return
+	}
+
+	manifests, err := thh.Repository.Manifests(thh)
+	if err != nil {
+		thh.Errors = append(thh.Errors, err)
+		return
+	}
+
+	exists, err := manifests.Exists(thh, dgst)
+	if err != nil {
+		thh.Errors = append(thh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if !exists {
+		thh.Errors = append(thh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(dgst))
+		return
+	}
+
+	if err := tags.Tag(thh, thh.Tag, distribution.Descriptor{Digest: dgst}); err != nil {
+		thh.appendTagError(err)
+		return
+	}
+
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (thh *tagHistoryHandler) appendTagError(err error) {
+	switch err := err.(type) {
+	case distribution.ErrTagUnknown:
+		thh.Errors = append(thh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+	case distribution.ErrRepositoryUnknown:
+		thh.Errors = append(thh.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": thh.Repository.Name().Name()}))
+	case distribution.ErrTagImmutable:
+		thh.Errors = append(thh.Errors, v2.ErrorCodeTagImmutable.WithDetail(err))
+	default:
+		thh.Errors = append(thh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
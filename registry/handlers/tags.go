@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/registry/api/errcode"
@@ -31,12 +33,42 @@ type tagsAPIResponse struct {
 	Tags []string `json:"tags"`
 }
 
-// GetTags returns a json list of tags for a specific image name.
+// GetTags returns a json list of tags for a specific image name. If the "n"
+// parameter is set, at most n tags following the "last" parameter are
+// returned, with a Link header to the next page if there are more. n=0
+// requests the default page size, which also bounds larger values of n.
 func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
+	q := r.URL.Query()
+	lastEntry := q.Get("last")
+	maxEntries, err := strconv.Atoi(q.Get("n"))
+	paginated := err == nil && maxEntries >= 0
+
 	tagService := th.Repository.Tags(th)
-	tags, err := tagService.All(th)
+
+	var tags []string
+	moreEntries := false
+	if paginated {
+		if maxEntries == 0 || maxEntries > maximumReturnedEntries {
+			maxEntries = maximumReturnedEntries
+		}
+		tags = make([]string, maxEntries)
+		var filled int
+		filled, err = tagService.List(th, tags, lastEntry)
+		if err == io.EOF {
+			err = nil
+		} else if err == nil {
+			moreEntries = true
+		}
+		tags = tags[:filled]
+	} else {
+		tags, err = tagService.All(th)
+		if err == nil && lastEntry != "" {
+			tags = tagsAfter(tags, lastEntry)
+		}
+	}
+
 	if err != nil {
 		switch err := err.(type) {
 		case distribution.ErrRepositoryUnknown:
@@ -49,6 +81,19 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
+	// Add a link header if there are more entries to retrieve
+	if moreEntries {
+		if len(tags) > 0 {
+			lastEntry = tags[len(tags)-1]
+		}
+		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, lastEntry)
+		if err != nil {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		w.Header().Set("Link", urlStr)
+	}
+
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(tagsAPIResponse{
 		Name: th.Repository.Name().Name(),
@@ -58,3 +103,14 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// tagsAfter returns the tags lexically following last.
+func tagsAfter(tags []string, last string) []string {
+	after := tags[:0]
+	for _, tag := range tags {
+		if tag > last {
+			after = append(after, tag)
+		}
+	}
+	return after
+}
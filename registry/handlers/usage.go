@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// usageDispatcher constructs the usage handler api endpoint.
+func usageDispatcher(ctx *Context, r *http.Request) http.Handler {
+	usageHandler := &usageHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(usageHandler.GetUsage),
+	}
+}
+
+// usageHandler handles requests for the storage used by a repository.
+type usageHandler struct {
+	*Context
+}
+
+type usageAPIResponse struct {
+	Name string `json:"name"`
+	distribution.RepositoryUsage
+}
+
+// GetUsage returns the storage used by a specific repository.
+func (uh *usageHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	reporter, ok := uh.App.registry.(distribution.UsageReporter)
+	if !ok {
+		uh.Errors = append(uh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	usage, err := reporter.Usage(uh, uh.Repository.Name())
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			uh.Errors = append(uh.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": uh.Repository.Name().Name()}))
+		default:
+			uh.Errors = append(uh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(usageAPIResponse{
+		Name:            uh.Repository.Name().Name(),
+		RepositoryUsage: usage,
+	}); err != nil {
+		uh.Errors = append(uh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
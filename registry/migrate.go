@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/spf13/cobra"
+)
+
+var migrateParallelism int
+
+// MigrateCmd is the cobra command that corresponds to the migrate subcommand
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate <source config> <destination config>",
+	Short: "`migrate` copies the registry storage to another storage driver",
+	Long: "`migrate` copies all blobs and repositories from the storage driver " +
+		"configured in the source configuration to the one configured in the " +
+		"destination configuration. Blobs already present at the destination " +
+		"are skipped, so an interrupted migration may be resumed by running it " +
+		"again. The source registry should be stopped or in read-only mode.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "source and destination configurations are required")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		srcConfig, err := resolveConfiguration(args[:1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "source configuration error: %v\n", err)
+			os.Exit(1)
+		}
+
+		dstConfig, err := resolveConfiguration(args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "destination configuration error: %v\n", err)
+			os.Exit(1)
+		}
+
+		src, err := newStorageDriver(srcConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct source %s driver: %v\n", srcConfig.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		dst, err := newStorageDriver(dstConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct destination %s driver: %v\n", dstConfig.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+		ctx, err = configureLogging(ctx, srcConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s\n", err)
+			os.Exit(1)
+		}
+
+		if err := storage.Migrate(ctx, src, dst, storage.MigrateOpts{
+			Parallelism: migrateParallelism,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	MigrateCmd.Flags().IntVarP(&migrateParallelism, "parallelism", "p", 4, "number of files copied concurrently")
+}
@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/spf13/cobra"
+)
+
+var importRepository string
+
+// ExportCmd is the cobra command that corresponds to the export subcommand
+var ExportCmd = &cobra.Command{
+	Use:   "export <config> <archive> <name[:tag]>...",
+	Short: "`export` writes repositories to an OCI image layout archive",
+	Long: "`export` writes the named images to a tar archive of an OCI image " +
+		"layout. A name without a tag exports every tag of the repository.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "configuration, archive and at least one name are required")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		var refs []reference.Named
+		for _, arg := range args[2:] {
+			named, err := reference.ParseNamed(arg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid name %q: %v\n", arg, err)
+				os.Exit(1)
+			}
+			if _, ok := named.(reference.Canonical); ok {
+				fmt.Fprintf(os.Stderr, "invalid name %q: digest references are not supported\n", arg)
+				os.Exit(1)
+			}
+			refs = append(refs, named)
+		}
+
+		ctx, registry := storageRegistry(cmd, args[:1])
+
+		fp, err := os.Create(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create archive: %v\n", err)
+			os.Exit(1)
+		}
+		defer fp.Close()
+
+		if err := storage.ExportOCILayout(ctx, registry, fp, refs); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to export: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// ImportCmd is the cobra command that corresponds to the import subcommand
+var ImportCmd = &cobra.Command{
+	Use:   "import <config> <archive>",
+	Short: "`import` pushes the images of an OCI image layout archive",
+	Long: "`import` pushes and tags the images listed in the index of a tar " +
+		"archive of an OCI image layout. Images are named after their " +
+		"org.opencontainers.image.ref.name annotation, unless a repository is given.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "configuration and archive are required")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		var repository reference.Named
+		if importRepository != "" {
+			named, err := reference.ParseNamed(importRepository)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid repository %q: %v\n", importRepository, err)
+				os.Exit(1)
+			}
+			repository = named
+		}
+
+		ctx, registry := storageRegistry(cmd, args[:1])
+
+		fp, err := os.Open(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open archive: %v\n", err)
+			os.Exit(1)
+		}
+		defer fp.Close()
+
+		fi, err := fp.Stat()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to stat archive: %v\n", err)
+			os.Exit(1)
+		}
+
+		imported, err := storage.ImportOCILayout(ctx, registry, fp, fi.Size(), repository)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to import: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("\n%d images imported\n", len(imported))
+	},
+}
+
+// storageRegistry constructs the registry stored in the storage driver of
+// the configuration given in args, exiting on failure.
+func storageRegistry(cmd *cobra.Command, args []string) (context.Context, distribution.Namespace) {
+	config, err := resolveConfiguration(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	driver, err := newStorageDriver(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v\n", config.Storage.Type(), err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	ctx, err = configureLogging(ctx, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s\n", err)
+		os.Exit(1)
+	}
+
+	registry, err := storage.NewRegistry(ctx, driver)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to construct registry: %v\n", err)
+		os.Exit(1)
+	}
+
+	return ctx, registry
+}
+
+func init() {
+	ImportCmd.Flags().StringVarP(&importRepository, "repository", "r", "", "import every image into this repository")
+}
@@ -182,6 +182,6 @@ func (pbs *proxyBlobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte,
 	return nil, distribution.ErrUnsupported
 }
 
-func (pbs *proxyBlobStore) Delete(ctx context.Context, dgst digest.Digest) error {
+func (pbs *proxyBlobStore) Delete(ctx context.Context, dgst digest.Digest, options ...distribution.BlobDeleteOption) error {
 	return distribution.ErrUnsupported
 }
@@ -84,12 +84,12 @@ func (sbs statsBlobStore) Stat(ctx context.Context, dgst digest.Digest) (distrib
 	return sbs.blobs.Stat(ctx, dgst)
 }
 
-func (sbs statsBlobStore) Delete(ctx context.Context, dgst digest.Digest) error {
+func (sbs statsBlobStore) Delete(ctx context.Context, dgst digest.Digest, options ...distribution.BlobDeleteOption) error {
 	sbsMu.Lock()
 	sbs.stats["delete"]++
 	sbsMu.Unlock()
 
-	return sbs.blobs.Delete(ctx, dgst)
+	return sbs.blobs.Delete(ctx, dgst, options...)
 }
 
 type testEnv struct {
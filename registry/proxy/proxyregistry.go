@@ -68,6 +68,11 @@ func (pr *proxyingRegistry) Scope() distribution.Scope {
 	return distribution.GlobalScope
 }
 
+// ScheduledExpiries returns the cached objects scheduled for removal.
+func (pr *proxyingRegistry) ScheduledExpiries() []scheduler.Entry {
+	return pr.scheduler.Entries()
+}
+
 func (pr *proxyingRegistry) Repositories(ctx context.Context, repos []string, last string) (n int, err error) {
 	return pr.embedded.Repositories(ctx, repos, last)
 }
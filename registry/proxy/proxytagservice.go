@@ -1,6 +1,8 @@
 package proxy
 
 import (
+	"io"
+
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
 )
@@ -53,6 +55,19 @@ func (pt proxyTagService) All(ctx context.Context) ([]string, error) {
 	return pt.localTags.All(ctx)
 }
 
+func (pt proxyTagService) List(ctx context.Context, tags []string, last string) (int, error) {
+	n, err := pt.remoteTags.List(ctx, tags, last)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	return pt.localTags.List(ctx, tags, last)
+}
+
 func (pt proxyTagService) Lookup(ctx context.Context, digest distribution.Descriptor) ([]string, error) {
 	return []string{}, distribution.ErrUnsupported
 }
+
+// History returns the history of the tag as cached locally.
+func (pt proxyTagService) History(ctx context.Context, tag string) ([]distribution.TagHistoryEntry, error) {
+	return pt.localTags.History(ctx, tag)
+}
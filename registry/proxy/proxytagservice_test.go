@@ -57,10 +57,18 @@ func (m *mockTagStore) All(ctx context.Context) ([]string, error) {
 	return tags, nil
 }
 
+func (m *mockTagStore) List(ctx context.Context, tags []string, last string) (int, error) {
+	panic("not implemented")
+}
+
 func (m *mockTagStore) Lookup(ctx context.Context, digest distribution.Descriptor) ([]string, error) {
 	panic("not implemented")
 }
 
+func (m *mockTagStore) History(ctx context.Context, tag string) ([]distribution.TagHistoryEntry, error) {
+	panic("not implemented")
+}
+
 func testProxyTagService(local, remote map[string]distribution.Descriptor) *proxyTagService {
 	if local == nil {
 		local = make(map[string]distribution.Descriptor)
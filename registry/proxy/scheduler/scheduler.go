@@ -3,6 +3,7 @@ package scheduler
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -31,6 +32,25 @@ type schedulerEntry struct {
 	timer *time.Timer
 }
 
+// Entry describes a scheduled expiry.
+type Entry struct {
+	// Key identifies the expiring object: a blob digest or a repository
+	// name.
+	Key string `json:"key"`
+
+	// Type is "blob" or "manifest".
+	Type string `json:"type"`
+
+	// Expiry is the time the object expires.
+	Expiry time.Time `json:"expiry"`
+}
+
+type entriesByExpiry []Entry
+
+func (e entriesByExpiry) Len() int           { return len(e) }
+func (e entriesByExpiry) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e entriesByExpiry) Less(i, j int) bool { return e[i].Expiry.Before(e[j].Expiry) }
+
 // New returns a new instance of the scheduler
 func New(ctx context.Context, driver driver.StorageDriver, path string) *TTLExpirationScheduler {
 	return &TTLExpirationScheduler{
@@ -106,6 +126,34 @@ func (ttles *TTLExpirationScheduler) AddManifest(repoName reference.Named, ttl t
 	return nil
 }
 
+// Entries returns the scheduled expiries, soonest first.
+func (ttles *TTLExpirationScheduler) Entries() []Entry {
+	ttles.Lock()
+	defer ttles.Unlock()
+
+	entries := make([]Entry, 0, len(ttles.entries))
+	for _, entry := range ttles.entries {
+		var entryType string
+		switch entry.EntryType {
+		case entryTypeBlob:
+			entryType = "blob"
+		case entryTypeManifest:
+			entryType = "manifest"
+		default:
+			entryType = "unknown"
+		}
+
+		entries = append(entries, Entry{
+			Key:    entry.Key,
+			Type:   entryType,
+			Expiry: entry.Expiry,
+		})
+	}
+	sort.Sort(entriesByExpiry(entries))
+
+	return entries
+}
+
 // Start starts the scheduler
 func (ttles *TTLExpirationScheduler) Start() error {
 	ttles.Lock()
@@ -161,3 +161,28 @@ func TestDoubleStart(t *testing.T) {
 		t.Fatalf("Scheduler started twice without error")
 	}
 }
+
+func TestEntries(t *testing.T) {
+	s := New(context.Background(), inmemory.New(), "/ttl")
+	s.onBlobExpire = func(string) error { return nil }
+	s.onManifestExpire = func(string) error { return nil }
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("Error starting ttlExpirationScheduler: %s", err)
+	}
+	defer s.Stop()
+
+	s.add("testBlob1", time.Hour, entryTypeBlob)
+	s.add("library/repo", time.Minute, entryTypeManifest)
+
+	entries := s.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("Unexpected entries: %#v", entries)
+	}
+	if entries[0].Key != "library/repo" || entries[0].Type != "manifest" {
+		t.Errorf("Unexpected first entry: %#v", entries[0])
+	}
+	if entries[1].Key != "testBlob1" || entries[1].Type != "blob" {
+		t.Errorf("Unexpected second entry: %#v", entries[1])
+	}
+}
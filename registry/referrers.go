@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/spf13/cobra"
+)
+
+// IndexReferrersCmd is the cobra command that corresponds to the
+// index-referrers subcommand
+var IndexReferrersCmd = &cobra.Command{
+	Use:   "index-referrers <config>",
+	Short: "`index-referrers` indexes the repositories and manifests referencing each blob",
+	Long: "`index-referrers` records the layer links and manifest revisions of " +
+		"every repository in the index queried by the referrers API. It only " +
+		"needs to be run once, for content pushed before the index existed.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := newStorageDriver(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v\n", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s\n", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := storage.IndexReferrers(ctx, registry); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to index referrers: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
@@ -17,6 +17,9 @@ import (
 	"github.com/docker/distribution/health"
 	"github.com/docker/distribution/registry/handlers"
 	"github.com/docker/distribution/registry/listener"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
 	"github.com/docker/distribution/uuid"
 	"github.com/docker/distribution/version"
 	gorhandlers "github.com/gorilla/handlers"
@@ -68,15 +71,22 @@ var Cmd = &cobra.Command{
 var showVersion bool
 
 func init() {
+	Cmd.AddCommand(GCCmd)
+	Cmd.AddCommand(FsckCmd)
+	Cmd.AddCommand(IndexReferrersCmd)
+	Cmd.AddCommand(MigrateCmd)
+	Cmd.AddCommand(ExportCmd)
+	Cmd.AddCommand(ImportCmd)
 	Cmd.PersistentFlags().BoolVarP(&showVersion, "version", "v", false, "show the version and exit")
 }
 
 // A Registry represents a complete instance of the registry.
 // TODO(aaronl): It might make sense for Registry to become an interface.
 type Registry struct {
-	config *configuration.Configuration
-	app    *handlers.App
-	server *http.Server
+	config      *configuration.Configuration
+	app         *handlers.App
+	server      *http.Server
+	adminServer *http.Server // nil if the admin API is disabled
 }
 
 // NewRegistry creates a new registry from a context and configuration struct.
@@ -105,17 +115,40 @@ func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Reg
 		Handler: handler,
 	}
 
+	var adminServer *http.Server
+	if config.Admin.Addr != "" {
+		adminServer = &http.Server{
+			Handler: gorhandlers.CombinedLoggingHandler(os.Stdout, app.AdminHandler()),
+		}
+	}
+
 	return &Registry{
-		app:    app,
-		config: config,
-		server: server,
+		app:         app,
+		config:      config,
+		server:      server,
+		adminServer: adminServer,
 	}, nil
 }
 
-// ListenAndServe runs the registry's HTTP server.
+// ListenAndServe runs the registry's HTTP server, along with the admin
+// server if configured.
 func (registry *Registry) ListenAndServe() error {
 	config := registry.config
 
+	if registry.adminServer != nil {
+		adminLn, err := listener.NewListener(config.Admin.Net, config.Admin.Addr)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			context.GetLogger(registry.app).Infof("admin server listening on %v", adminLn.Addr())
+			if err := registry.adminServer.Serve(adminLn); err != nil {
+				context.GetLogger(registry.app).Fatalf("error serving admin API: %v", err)
+			}
+		}()
+	}
+
 	ln, err := listener.NewListener(config.HTTP.Net, config.HTTP.Addr)
 	if err != nil {
 		return err
@@ -267,6 +300,25 @@ func configureLogging(ctx context.Context, config *configuration.Configuration)
 	return ctx, nil
 }
 
+// newStorageDriver constructs the storage driver described by the
+// configuration, wrapped by the configured storage middleware, so that
+// commands see the same content as the registry does.
+func newStorageDriver(config *configuration.Configuration) (storagedriver.StorageDriver, error) {
+	driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mw := range config.Middleware["storage"] {
+		driver, err = storagemiddleware.Get(mw.Name, mw.Options, driver)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure storage middleware (%s): %v", mw.Name, err)
+		}
+	}
+
+	return driver, nil
+}
+
 func logLevel(level configuration.Loglevel) log.Level {
 	l, err := log.ParseLevel(string(level))
 	if err != nil {
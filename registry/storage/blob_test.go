@@ -470,6 +470,177 @@ func TestBlobMount(t *testing.T) {
 }
 
 // TestLayerUploadZeroLength uploads zero-length
+// TestDeleteReferencedBlob ensures that a layer referenced by a manifest is
+// only unlinked when the delete is forced.
+func TestDeleteReferencedBlob(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+	blobs := repo.Blobs(env.ctx)
+
+	layers := uploadRandomLayers(t, repo, 3)
+	dgst, manifest := uploadSchema2Manifest(t, repo, layers[:2])
+
+	// An unreferenced layer is deleted
+	if err := blobs.Delete(env.ctx, layers[2].Digest); err != nil {
+		t.Fatalf("unexpected error deleting unreferenced layer: %v", err)
+	}
+
+	for _, referenced := range []digest.Digest{layers[0].Digest, manifest.Config.Digest} {
+		err := blobs.Delete(env.ctx, referenced)
+		switch err := err.(type) {
+		case distribution.ErrBlobReferenced:
+			if len(err.Manifests) != 1 || err.Manifests[0] != dgst {
+				t.Fatalf("unexpected referencing manifests: %v", err.Manifests)
+			}
+		default:
+			t.Fatalf("expected ErrBlobReferenced deleting %s, got %v", referenced, err)
+		}
+
+		if _, err := blobs.Stat(env.ctx, referenced); err != nil {
+			t.Fatalf("referenced blob %s was unlinked: %v", referenced, err)
+		}
+	}
+
+	if err := blobs.Delete(env.ctx, layers[0].Digest, WithForce()); err != nil {
+		t.Fatalf("unexpected error forcing delete: %v", err)
+	}
+	if _, err := blobs.Stat(env.ctx, layers[0].Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected forced delete to unlink layer, got %v", err)
+	}
+
+	// Once the manifest is gone, its layers may be deleted
+	manifests, err := repo.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manifests.Delete(env.ctx, dgst); err != nil {
+		t.Fatal(err)
+	}
+	if err := blobs.Delete(env.ctx, layers[1].Digest); err != nil {
+		t.Fatalf("unexpected error deleting layer of deleted manifest: %v", err)
+	}
+}
+
+// TestDeleteReferencedBlobUnindexed ensures that a layer referenced by a
+// manifest missing from the referrer index, as when pushed before it was
+// introduced, is only unlinked when the delete is forced.
+func TestDeleteReferencedBlobUnindexed(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+	blobs := repo.Blobs(env.ctx)
+
+	layers := uploadRandomLayers(t, repo, 2)
+	dgst, _ := uploadSchema2Manifest(t, repo, layers[:1])
+
+	if err := env.driver.Delete(env.ctx, "/docker/registry/v2/referrers"); err != nil {
+		t.Fatalf("unexpected error removing referrer index: %v", err)
+	}
+
+	switch err := blobs.Delete(env.ctx, layers[0].Digest).(type) {
+	case distribution.ErrBlobReferenced:
+		if len(err.Manifests) != 1 || err.Manifests[0] != dgst {
+			t.Fatalf("unexpected referencing manifests: %v", err.Manifests)
+		}
+	default:
+		t.Fatalf("expected ErrBlobReferenced deleting unindexed layer, got %v", err)
+	}
+
+	// Linking the layer again does not mark it as indexed
+	content, err := blobs.Get(env.ctx, layers[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Put(env.ctx, layers[0].MediaType, content); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := blobs.Delete(env.ctx, layers[0].Digest).(distribution.ErrBlobReferenced); !ok {
+		t.Fatalf("expected ErrBlobReferenced deleting layer linked again")
+	}
+
+	if err := blobs.Delete(env.ctx, layers[1].Digest); err != nil {
+		t.Fatalf("unexpected error deleting unreferenced unindexed layer: %v", err)
+	}
+}
+
+// TestBlobWriterChunks ensures that chunks written out of order are assembled
+// after the sequentially written data on commit.
+func TestBlobWriterChunks(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+	blobs := repo.Blobs(env.ctx)
+
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+
+	upload := func() distribution.BlobWriter {
+		bw, err := blobs.Create(env.ctx)
+		if err != nil {
+			t.Fatalf("unexpected error starting upload: %v", err)
+		}
+		if _, err := bw.Write(data[:100]); err != nil {
+			t.Fatalf("unexpected error writing data: %v", err)
+		}
+		return bw
+	}
+
+	writeChunk := func(bw distribution.BlobWriter, start, end int) {
+		err := bw.(distribution.BlobChunkWriter).WriteChunk(env.ctx, int64(start), int64(end-start), bytes.NewReader(data[start:end]))
+		if err != nil {
+			t.Fatalf("unexpected error writing chunk: %v", err)
+		}
+	}
+
+	bw := upload()
+	writeChunk(bw, 600, 1000)
+	writeChunk(bw, 300, 600)
+	// overlaps the sequential data and the following chunk
+	writeChunk(bw, 50, 350)
+
+	dgst := digest.FromBytes(data)
+	desc, err := bw.Commit(env.ctx, distribution.Descriptor{Digest: dgst})
+	if err != nil {
+		t.Fatalf("unexpected error committing upload: %v", err)
+	}
+	if desc.Size != int64(len(data)) {
+		t.Fatalf("unexpected size: %d != %d", desc.Size, len(data))
+	}
+
+	content, err := blobs.Get(env.ctx, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error getting blob: %v", err)
+	}
+	if !bytes.Equal(content, data) {
+		t.Fatalf("assembled blob does not match the written data")
+	}
+
+	// A gap between the chunks fails the commit
+	bw = upload()
+	writeChunk(bw, 200, 1000)
+	if _, err := bw.Commit(env.ctx, distribution.Descriptor{Digest: dgst}); err != distribution.ErrBlobInvalidLength {
+		t.Fatalf("expected ErrBlobInvalidLength committing upload with a gap, got %v", err)
+	}
+
+	// A short chunk is not stored, and a longer one is stored up to its size
+	bw = upload()
+	chunkWriter := bw.(distribution.BlobChunkWriter)
+	if err := chunkWriter.WriteChunk(env.ctx, 100, 900, bytes.NewReader(data[100:999])); err != distribution.ErrBlobInvalidLength {
+		t.Fatalf("expected ErrBlobInvalidLength writing a short chunk, got %v", err)
+	}
+	if chunks, err := bw.(*blobWriter).getStoredChunks(env.ctx); err != nil || len(chunks) != 0 {
+		t.Fatalf("unexpected chunks stored after a short chunk: %v, %v", chunks, err)
+	}
+
+	bw = upload()
+	if err := bw.(distribution.BlobChunkWriter).WriteChunk(env.ctx, 100, 900, bytes.NewReader(append(data[100:], 0))); err != nil {
+		t.Fatalf("unexpected error writing a longer chunk: %v", err)
+	}
+	if _, err := bw.Commit(env.ctx, distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatalf("unexpected error committing upload with a longer chunk: %v", err)
+	}
+}
+
 func TestLayerUploadZeroLength(t *testing.T) {
 	ctx := context.Background()
 	imageName, _ := reference.ParseNamed("foo/bar")
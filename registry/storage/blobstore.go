@@ -1,6 +1,10 @@
 package storage
 
 import (
+	"fmt"
+	"path"
+	"strings"
+
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/digest"
@@ -85,6 +89,55 @@ func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distr
 	}, bs.driver.PutContent(ctx, bp, p)
 }
 
+// Enumerate calls ingester with the digest of every blob present in the
+// global blob store.
+func (bs *blobStore) Enumerate(ctx context.Context, ingester func(dgst digest.Digest) error) error {
+	specPath, err := pathFor(blobsPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	err = walkAll(ctx, bs.driver, specPath, func(fileInfo driver.FileInfo) error {
+		// skip directories
+		if fileInfo.IsDir() {
+			return nil
+		}
+
+		currentPath := fileInfo.Path()
+		// we only want to parse paths that end with /data
+		_, fileName := path.Split(currentPath)
+		if fileName != "data" {
+			return nil
+		}
+
+		digest, err := digestFromPath(currentPath)
+		if err != nil {
+			return err
+		}
+
+		return ingester(digest)
+	})
+
+	switch err.(type) {
+	case driver.PathNotFoundError:
+		// nothing has been stored yet
+		return nil
+	}
+
+	return err
+}
+
+// present reports whether the data of the blob identified by dgst is in the
+// blob store.
+func (bs *blobStore) present(ctx context.Context, dgst digest.Digest) (bool, error) {
+	bp, err := bs.path(dgst)
+	if err != nil {
+		return false, err
+	}
+
+	return exists(ctx, bs.driver, bp)
+}
+
 // path returns the canonical path for the blob identified by digest. The blob
 // may or may not exist.
 func (bs *blobStore) path(dgst digest.Digest) (string, error) {
@@ -132,6 +185,23 @@ func (bs *blobStore) resolve(ctx context.Context, path string) (string, error) {
 	return bs.path(dgst)
 }
 
+// digestFromPath recovers the digest of a blob from the path of its data
+// file, as laid out by blobDataPathSpec:
+//
+// 	<root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
+func digestFromPath(digestPath string) (digest.Digest, error) {
+	components := strings.Split(strings.TrimSuffix(digestPath, "/data"), "/")
+	if len(components) < 3 {
+		return "", fmt.Errorf("invalid blob data path: %q", digestPath)
+	}
+
+	hex := components[len(components)-1]
+	algorithm := components[len(components)-3]
+
+	dgst := digest.NewDigestFromHex(algorithm, hex)
+	return dgst, dgst.Validate()
+}
+
 type blobStatter struct {
 	driver driver.StorageDriver
 }
@@ -55,11 +55,21 @@ func (bw *blobWriter) Commit(ctx context.Context, desc distribution.Descriptor)
 		return distribution.Descriptor{}, err
 	}
 
+	// Chunks written out of order are appended before validation, so that
+	// the digest is computed over the assembled data.
+	if err := bw.assembleChunks(ctx); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	canonical, err := bw.validateBlob(ctx, desc)
 	if err != nil {
 		return distribution.Descriptor{}, err
 	}
 
+	if err := bw.blobStore.checkQuota(ctx, canonical); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	if err := bw.moveBlob(ctx, canonical); err != nil {
 		return distribution.Descriptor{}, err
 	}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+var _ distribution.BlobChunkWriter = &blobWriter{}
+
+// WriteChunk stores the size bytes read from r as the chunk of the upload
+// starting at offset. Chunks are kept apart from the upload data, so that
+// several writers of the same upload may store chunks concurrently, and are
+// appended to the data in offset order by Commit. A chunk shorter than size
+// is removed, so that Commit cannot append it.
+func (bw *blobWriter) WriteChunk(ctx context.Context, offset, size int64, r io.Reader) error {
+	context.GetLogger(ctx).Debug("(*blobWriter).WriteChunk")
+
+	if offset < 0 {
+		return fmt.Errorf("cannot write chunk at negative offset: %d", offset)
+	}
+
+	chunkPath, err := pathFor(uploadChunkPathSpec{
+		name:   bw.blobStore.repository.Name().Name(),
+		id:     bw.id,
+		offset: offset,
+	})
+	if err != nil {
+		return err
+	}
+
+	// A chunk may be sent again after a failed request. Remove any previous
+	// attempt so that it cannot leave trailing data behind.
+	if err := bw.removeChunk(ctx, chunkPath); err != nil {
+		return err
+	}
+
+	nn, err := bw.blobStore.driver.WriteStream(ctx, chunkPath, 0, io.LimitReader(r, size))
+	if err == nil && nn != size {
+		context.GetLogger(ctx).Errorf("chunk of upload %s at offset %d is %d bytes long, expected %d", bw.id, offset, nn, size)
+		err = distribution.ErrBlobInvalidLength
+	}
+
+	if err != nil {
+		if err := bw.removeChunk(ctx, chunkPath); err != nil {
+			context.GetLogger(ctx).Errorf("error removing chunk of upload %s at offset %d: %v", bw.id, offset, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// removeChunk removes the chunk stored at chunkPath, if any.
+func (bw *blobWriter) removeChunk(ctx context.Context, chunkPath string) error {
+	if err := bw.blobStore.driver.Delete(ctx, chunkPath); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uploadChunk describes a chunk stored by WriteChunk.
+type uploadChunk struct {
+	offset int64
+	size   int64
+	path   string
+}
+
+// getStoredChunks returns the chunks stored for the upload, ordered by
+// offset.
+func (bw *blobWriter) getStoredChunks(ctx context.Context) ([]uploadChunk, error) {
+	chunksPath, err := pathFor(uploadChunkPathSpec{
+		name: bw.blobStore.repository.Name().Name(),
+		id:   bw.id,
+		list: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := bw.blobStore.driver.List(ctx, chunksPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	chunks := make([]uploadChunk, 0, len(paths))
+	for _, p := range paths {
+		offset, err := strconv.ParseInt(path.Base(p), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse offset from upload chunk path %q: %v", p, err)
+		}
+
+		fi, err := bw.blobStore.driver.Stat(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+
+		chunks = append(chunks, uploadChunk{offset: offset, size: fi.Size(), path: p})
+	}
+
+	sort.Sort(uploadChunksByOffset(chunks))
+	return chunks, nil
+}
+
+// assembleChunks appends the chunks stored by WriteChunk to the upload data.
+// Chunks overlapping data already present are trimmed; a gap before a chunk
+// fails the upload with ErrBlobInvalidLength. Once assembled, the chunks are
+// removed.
+func (bw *blobWriter) assembleChunks(ctx context.Context) error {
+	chunks, err := bw.getStoredChunks(ctx)
+	if err != nil || len(chunks) == 0 {
+		return err
+	}
+
+	var size int64
+	if fi, err := bw.blobStore.driver.Stat(ctx, bw.path); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return err
+		}
+	} else {
+		size = fi.Size()
+	}
+
+	for _, chunk := range chunks {
+		if chunk.offset > size {
+			context.GetLogger(ctx).Errorf("upload %s is missing data between offsets %d and %d", bw.id, size, chunk.offset)
+			return distribution.ErrBlobInvalidLength
+		}
+
+		if chunk.offset+chunk.size <= size {
+			continue
+		}
+
+		if err := bw.appendChunk(ctx, chunk, size); err != nil {
+			return err
+		}
+		size = chunk.offset + chunk.size
+	}
+
+	chunksPath := path.Dir(chunks[0].path)
+	if err := bw.blobStore.driver.Delete(ctx, chunksPath); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendChunk writes the part of chunk lying beyond size to the end of the
+// upload data.
+func (bw *blobWriter) appendChunk(ctx context.Context, chunk uploadChunk, size int64) error {
+	rc, err := bw.blobStore.driver.ReadStream(ctx, chunk.path, size-chunk.offset)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	nn, err := bw.blobStore.driver.WriteStream(ctx, bw.path, size, rc)
+	if err != nil {
+		return err
+	}
+
+	if nn != chunk.offset+chunk.size-size {
+		return fmt.Errorf("short write assembling upload chunk at offset %d: %d bytes written", chunk.offset, nn)
+	}
+
+	return nil
+}
+
+// uploadChunksByOffset sorts upload chunks by offset.
+type uploadChunksByOffset []uploadChunk
+
+func (c uploadChunksByOffset) Len() int           { return len(c) }
+func (c uploadChunksByOffset) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c uploadChunksByOffset) Less(i, j int) bool { return c[i].offset < c[j].offset }
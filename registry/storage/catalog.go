@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/docker/distribution/context"
@@ -19,48 +20,114 @@ var ErrFinishedWalk = errors.New("finished walk")
 // Because it's a quite expensive operation, it should only be used when building up
 // an initial set of repositories.
 func (reg *registry) Repositories(ctx context.Context, repos []string, last string) (n int, errVal error) {
-	var foundRepos []string
-
 	if len(repos) == 0 {
 		return 0, errors.New("no space in slice")
 	}
 
+	err := reg.enumerateRepositories(ctx, last, func(repoPath string) error {
+		// a repository past a full slice shows there are more entries
+		if n == len(repos) {
+			return ErrFinishedWalk
+		}
+
+		repos[n] = repoPath
+		n++
+		return nil
+	})
+
+	switch err {
+	case nil:
+		// Signal that we have no more entries by setting EOF
+		errVal = io.EOF
+	case ErrFinishedWalk:
+	default:
+		errVal = err
+	}
+
+	return n, errVal
+}
+
+// Enumerate applies ingester to each repository
+func (reg *registry) Enumerate(ctx context.Context, ingester func(string) error) error {
+	return reg.enumerateRepositories(ctx, "", ingester)
+}
+
+// enumerateRepositories applies ingester to each repository whose name
+// follows last, in lexical order, stopping at the first error it returns.
+// The repositories are found with a single recursive listing when the driver
+// supports it, skipping the files of their reserved directories.
+func (reg *registry) enumerateRepositories(ctx context.Context, last string, ingester func(string) error) error {
 	root, err := pathFor(repositoriesRootPathSpec{})
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	err = Walk(ctx, reg.blobStore.driver, root, func(fileInfo driver.FileInfo) error {
+	// The walk visits "a-b" before "a", so repositories are held back until
+	// no repository preceding them can be found anymore.
+	var pending []string
+
+	err = walkAll(ctx, reg.blobStore.driver, root, func(fileInfo driver.FileInfo) error {
 		filePath := fileInfo.Path()
 
 		// lop the base path off
 		repoPath := filePath[len(root)+1:]
 
+		for len(pending) > 0 && walkedPast(repoPath, pending[0]) {
+			if err := ingester(pending[0]); err != nil {
+				return err
+			}
+			pending = pending[1:]
+		}
+
 		_, file := path.Split(repoPath)
 		if file == "_layers" {
 			repoPath = strings.TrimSuffix(repoPath, "/_layers")
 			if repoPath > last {
-				foundRepos = append(foundRepos, repoPath)
+				i := sort.SearchStrings(pending, repoPath)
+				pending = append(pending, "")
+				copy(pending[i+1:], pending[i:])
+				pending[i] = repoPath
 			}
 			return ErrSkipDir
 		} else if strings.HasPrefix(file, "_") {
 			return ErrSkipDir
 		}
 
-		// if we've filled our array, no need to walk any further
-		if len(foundRepos) == len(repos) {
-			return ErrFinishedWalk
+		// every repository below this directory precedes last
+		if fileInfo.IsDir() && last > repoPath+"/" && !strings.HasPrefix(last, repoPath+"/") {
+			return ErrSkipDir
 		}
 
 		return nil
 	})
 
-	n = copy(repos, foundRepos)
+	switch err.(type) {
+	case nil:
+	case driver.PathNotFoundError:
+		// an empty registry has no repositories to enumerate
+	default:
+		return err
+	}
 
-	// Signal that we have no more entries by setting EOF
-	if len(foundRepos) <= len(repos) && err != ErrFinishedWalk {
-		errVal = io.EOF
+	for _, repoPath := range pending {
+		if err := ingester(repoPath); err != nil {
+			return err
+		}
 	}
 
-	return n, errVal
+	return nil
+}
+
+// walkedPast reports whether a walk of the repositories which visited the
+// given path, relative to their root, found every repository preceding name.
+// The walk visits paths in lexical order, each followed by a slash, so it may
+// only find such a repository after name when its name is a prefix of name
+// followed by a character preceding the slash, as "a" is for "a-b".
+func walkedPast(visited, name string) bool {
+	for i := 1; i < len(name); i++ {
+		if name[i] < '/' && visited+"/" <= name[:i]+"/_layers/" {
+			return false
+		}
+	}
+	return true
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"fmt"
 	"io"
 	"testing"
 
@@ -115,6 +116,112 @@ func TestCatalogInParts(t *testing.T) {
 
 }
 
+// listCountingDriver counts the listings made to the wrapped driver, which
+// must implement driver.RecursiveLister.
+type listCountingDriver struct {
+	driver.StorageDriver
+	lists, recursiveLists int
+}
+
+func (d *listCountingDriver) List(ctx context.Context, path string) ([]string, error) {
+	d.lists++
+	return d.StorageDriver.List(ctx, path)
+}
+
+func (d *listCountingDriver) ListRecursive(ctx context.Context, path string, f func(driver.FileInfo) error) error {
+	d.recursiveLists++
+	return d.StorageDriver.(driver.RecursiveLister).ListRecursive(ctx, path, f)
+}
+
+func TestCatalogRecursiveDriver(t *testing.T) {
+	ctx := context.Background()
+	d := &listCountingDriver{StorageDriver: inmemory.New()}
+	registry, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	rootpath, _ := pathFor(repositoriesRootPathSpec{})
+
+	const repositories, layers = 20, 20
+	for i := 0; i < repositories; i++ {
+		for j := 0; j < layers; j++ {
+			linkPath := fmt.Sprintf("%s/repo%02d/_layers/sha256/%02d/link", rootpath, i, j)
+			if err := d.PutContent(ctx, linkPath, []byte("")); err != nil {
+				t.Fatalf("Unable to put to inmemory fs")
+			}
+		}
+	}
+
+	// A page is found with a single recursive listing.
+	p := make([]string, 2)
+	numFilled, err := registry.Repositories(ctx, p, "repo04")
+	if err != nil {
+		t.Fatalf("unexpected error listing repositories: %v", err)
+	}
+	if !testEq(p, []string{"repo05", "repo06"}, numFilled) {
+		t.Fatalf("unexpected repositories: %v", p[:numFilled])
+	}
+	if d.recursiveLists != 1 || d.lists != 0 {
+		t.Fatalf("unexpected listings: %d recursive, %d directories", d.recursiveLists, d.lists)
+	}
+}
+
+// TestCatalogPrefixedNames checks that repositories whose names are prefixes
+// of others' are listed in lexical order, though a recursive listing finds
+// "a-b" before "a".
+func TestCatalogPrefixedNames(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	rootpath, _ := pathFor(repositoriesRootPathSpec{})
+
+	expected := []string{"a", "a-b", "a-b/c", "a.d", "a/c", "a/c-d", "a0", "b"}
+	for _, repo := range expected {
+		if err := d.PutContent(ctx, rootpath+"/"+repo+"/_layers/sha256/ab/link", []byte("")); err != nil {
+			t.Fatalf("Unable to put to inmemory fs")
+		}
+	}
+
+	for _, sd := range []driver.StorageDriver{d, listOnlyDriver{d}} {
+		registry, err := NewRegistry(ctx, sd)
+		if err != nil {
+			t.Fatalf("error creating registry: %v", err)
+		}
+
+		var enumerated []string
+		err = registry.(distribution.RepositoryEnumerator).Enumerate(ctx, func(repoPath string) error {
+			enumerated = append(enumerated, repoPath)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error enumerating repositories: %v", err)
+		}
+		if fmt.Sprint(enumerated) != fmt.Sprint(expected) {
+			t.Fatalf("unexpected repositories: %v", enumerated)
+		}
+
+		for size := 1; size <= len(expected); size++ {
+			var (
+				listed []string
+				last   string
+			)
+			for {
+				p := make([]string, size)
+				numFilled, err := registry.Repositories(ctx, p, last)
+				listed = append(listed, p[:numFilled]...)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("unexpected error listing repositories: %v", err)
+				}
+				last = p[numFilled-1]
+			}
+			if fmt.Sprint(listed) != fmt.Sprint(expected) {
+				t.Fatalf("unexpected repositories in pages of %d: %v", size, listed)
+			}
+		}
+	}
+}
+
 func testEq(a, b []string, size int) bool {
 	for cnt := 0; cnt < size-1; cnt++ {
 		if a[cnt] != b[cnt] {
@@ -162,6 +162,52 @@ func (base *Base) List(ctx context.Context, path string) ([]string, error) {
 	return str, base.setDriverName(e)
 }
 
+// ListRecursive wraps ListRecursive of underlying storage driver, if it
+// implements storagedriver.RecursiveLister.
+func (base *Base) ListRecursive(ctx context.Context, path string, f func(storagedriver.FileInfo) error) error {
+	ctx, done := context.WithTrace(ctx)
+	defer done("%s.ListRecursive(%q)", base.Name(), path)
+
+	if !storagedriver.PathRegexp.MatchString(path) && path != "/" {
+		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+	}
+
+	lister, ok := base.StorageDriver.(storagedriver.RecursiveLister)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: base.StorageDriver.Name()}
+	}
+
+	// Errors returned by f are passed through as is.
+	var ferr error
+	e := lister.ListRecursive(ctx, path, func(fi storagedriver.FileInfo) error {
+		ferr = f(fi)
+		return ferr
+	})
+	if ferr != nil {
+		return ferr
+	}
+	return base.setDriverName(e)
+}
+
+// ListFrom wraps ListFrom of underlying storage driver, if it implements
+// storagedriver.PagedLister.
+func (base *Base) ListFrom(ctx context.Context, path string, last string, n int) ([]string, error) {
+	ctx, done := context.WithTrace(ctx)
+	defer done("%s.ListFrom(%q, %q, %d)", base.Name(), path, last, n)
+
+	if !storagedriver.PathRegexp.MatchString(path) && path != "/" {
+		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+	}
+
+	lister, ok := base.StorageDriver.(storagedriver.PagedLister)
+	if !ok {
+		return nil, storagedriver.ErrUnsupportedMethod{DriverName: base.StorageDriver.Name()}
+	}
+
+	str, e := lister.ListFrom(ctx, path, last, n)
+	return str, base.setDriverName(e)
+}
+
 // Move wraps Move of underlying storage driver.
 func (base *Base) Move(ctx context.Context, sourcePath string, destPath string) error {
 	ctx, done := context.WithTrace(ctx)
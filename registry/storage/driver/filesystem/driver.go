@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"time"
 
 	"github.com/docker/distribution/context"
@@ -209,6 +210,98 @@ func (d *driver) List(ctx context.Context, subPath string) ([]string, error) {
 	return keys, nil
 }
 
+// ListFrom returns at most n of the direct descendants of the given path
+// whose name follows last, in lexical order. The directory is read in full,
+// as the operating system does not return its entries in order.
+func (d *driver) ListFrom(ctx context.Context, subPath string, last string, n int) ([]string, error) {
+	keys, err := d.List(ctx, subPath)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	var page []string
+	for _, key := range keys {
+		if len(page) == n {
+			break
+		}
+		if path.Base(key) > last {
+			page = append(page, key)
+		}
+	}
+
+	return page, nil
+}
+
+// ListRecursive calls f for each file below the given path, in lexical order
+// of their paths.
+func (d *driver) ListRecursive(ctx context.Context, subPath string, f func(storagedriver.FileInfo) error) error {
+	fullPath := d.fullPath(subPath)
+
+	fi, err := os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return storagedriver.PathNotFoundError{Path: subPath}
+		}
+		return err
+	}
+
+	if !fi.IsDir() {
+		return nil
+	}
+
+	return d.listRecursive(subPath, f)
+}
+
+// listRecursive calls f for each file below the directory subPath. Entries
+// are sorted by name, followed by a slash for directories, so that the paths
+// of the files are listed in lexical order.
+func (d *driver) listRecursive(subPath string, f func(storagedriver.FileInfo) error) error {
+	dir, err := os.Open(d.fullPath(subPath))
+	if err != nil {
+		return err
+	}
+
+	fileInfos, err := dir.Readdir(0)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(byKey(fileInfos))
+
+	for _, fi := range fileInfos {
+		filePath := path.Join(subPath, fi.Name())
+		if fi.IsDir() {
+			if err := d.listRecursive(filePath, f); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := f(fileInfo{path: filePath, FileInfo: fi}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// byKey sorts the entries of a directory by name, followed by a slash for
+// directories.
+type byKey []os.FileInfo
+
+func (k byKey) Len() int           { return len(k) }
+func (k byKey) Less(i, j int) bool { return k.key(i) < k.key(j) }
+func (k byKey) Swap(i, j int)      { k[i], k[j] = k[j], k[i] }
+
+func (k byKey) key(i int) string {
+	if k[i].IsDir() {
+		return k[i].Name() + "/"
+	}
+	return k[i].Name()
+}
+
 // Move moves an object stored at sourcePath to destPath, removing the original
 // object.
 func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
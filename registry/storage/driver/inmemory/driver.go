@@ -222,6 +222,76 @@ func (d *driver) List(ctx context.Context, path string) ([]string, error) {
 	return entries, nil
 }
 
+// ListFrom returns at most n of the direct descendants of the given path
+// whose name follows last, in lexical order.
+func (d *driver) ListFrom(ctx context.Context, path string, last string, n int) ([]string, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	normalized := normalize(path)
+
+	found := d.root.find(normalized)
+
+	if !found.isdir() {
+		return nil, fmt.Errorf("not a directory")
+	}
+
+	entries, err := found.(*dir).listFrom(normalized, last, n)
+
+	if err != nil {
+		switch err {
+		case errNotExists:
+			return nil, storagedriver.PathNotFoundError{Path: path}
+		case errIsNotDir:
+			return nil, fmt.Errorf("not a directory")
+		default:
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// ListRecursive calls f for each file below the given path, in lexical order
+// of their paths.
+func (d *driver) ListRecursive(ctx context.Context, path string, f func(storagedriver.FileInfo) error) error {
+	d.mutex.RLock()
+
+	normalized := normalize(path)
+	found := d.root.find(normalized)
+
+	if found.path() != normalized {
+		d.mutex.RUnlock()
+		return storagedriver.PathNotFoundError{Path: path}
+	}
+
+	if !found.isdir() {
+		d.mutex.RUnlock()
+		return fmt.Errorf("not a directory")
+	}
+
+	// The files are collected before calling f, which may call back into the
+	// driver.
+	var infos []storagedriver.FileInfo
+	for _, file := range found.(*dir).files() {
+		infos = append(infos, storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+			Path:    file.path(),
+			Size:    int64(len(file.data)),
+			ModTime: file.modtime(),
+		}})
+	}
+
+	d.mutex.RUnlock()
+
+	for _, fi := range infos {
+		if err := f(fi); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Move moves an object stored at sourcePath to destPath, removing the original
 // object.
 func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
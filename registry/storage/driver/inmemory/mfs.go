@@ -106,6 +106,48 @@ func (d *dir) list(p string) ([]string, error) {
 	return children, nil
 }
 
+// listFrom returns at most n of the children of the directory p whose name
+// follows last, in lexical order.
+func (d *dir) listFrom(p string, last string, n int) ([]string, error) {
+	children, err := d.list(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var page []string
+	for _, child := range children {
+		if len(page) == n {
+			break
+		}
+		if path.Base(child) > last {
+			page = append(page, child)
+		}
+	}
+
+	return page, nil
+}
+
+// files returns the files below d, in lexical order of their paths.
+func (d *dir) files() []*file {
+	var files []*file
+	for _, child := range d.children {
+		if child.isdir() {
+			files = append(files, child.(*dir).files()...)
+		} else {
+			files = append(files, child.(*file))
+		}
+	}
+
+	sort.Sort(filesByPath(files))
+	return files
+}
+
+type filesByPath []*file
+
+func (f filesByPath) Len() int           { return len(f) }
+func (f filesByPath) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f filesByPath) Less(i, j int) bool { return f[i].path() < f[j].path() }
+
 // mkfile or return the existing one. returns an error if it exists and is a
 // directory. Essentially, this is open or create.
 func (d *dir) mkfile(p string) (*file, error) {
@@ -113,6 +113,26 @@ func (lh *cloudFrontStorageMiddleware) URLFor(ctx context.Context, path string,
 	return cfURL, nil
 }
 
+// ListFrom lists part of a directory of the wrapped driver, if it
+// implements storagedriver.PagedLister.
+func (lh *cloudFrontStorageMiddleware) ListFrom(ctx context.Context, path string, last string, n int) ([]string, error) {
+	lister, ok := lh.StorageDriver.(storagedriver.PagedLister)
+	if !ok {
+		return nil, storagedriver.ErrUnsupportedMethod{DriverName: lh.Name()}
+	}
+	return lister.ListFrom(ctx, path, last, n)
+}
+
+// ListRecursive lists the files of the wrapped driver, if it implements
+// storagedriver.RecursiveLister.
+func (lh *cloudFrontStorageMiddleware) ListRecursive(ctx context.Context, path string, f func(storagedriver.FileInfo) error) error {
+	lister, ok := lh.StorageDriver.(storagedriver.RecursiveLister)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: lh.Name()}
+	}
+	return lister.ListRecursive(ctx, path, f)
+}
+
 // init registers the cloudfront layerHandler backend.
 func init() {
 	storagemiddleware.Register("cloudfront", storagemiddleware.InitFunc(newCloudFrontStorageMiddleware))
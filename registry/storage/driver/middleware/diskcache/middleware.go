@@ -0,0 +1,582 @@
+// Package middleware - local disk read-through cache for storage drivers
+//
+// Blob data is immutable once written, so it can be kept on local disk and
+// served from there instead of from a slow remote storage driver. Every
+// other path is passed through to the wrapped driver.
+package middleware
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+// defaultMaxSize is the default bound on the size of the cache, in bytes.
+const defaultMaxSize = 10 << 30
+
+// tmpDir is the directory of the cache root holding files being filled.
+const tmpDir = "_tmp"
+
+// blobDataPathRegexp matches the paths of blob data in the blob store,
+// capturing the digest algorithm and hex.
+var blobDataPathRegexp = regexp.MustCompile(`/v2/blobs/([a-z0-9]+)/[a-f0-9]{2}/([a-f0-9]+)/data$`)
+
+// blobDigest returns the digest of the blob stored at subPath, if subPath is
+// the data path of a blob.
+func blobDigest(subPath string) (digest.Digest, bool) {
+	m := blobDataPathRegexp.FindStringSubmatch(subPath)
+	if m == nil {
+		return "", false
+	}
+
+	dgst := digest.NewDigestFromHex(m[1], m[2])
+	if err := dgst.Validate(); err != nil {
+		return "", false
+	}
+	return dgst, true
+}
+
+// diskCacheStorageMiddleware serves blob data from a bounded cache on local
+// disk, filled as blobs are read from the wrapped driver.
+type diskCacheStorageMiddleware struct {
+	storagedriver.StorageDriver
+	cache *diskCache
+}
+
+var _ storagedriver.StorageDriver = &diskCacheStorageMiddleware{}
+
+// newDiskCacheStorageMiddleware constructs and returns a new disk cache
+// StorageDriver implementation.
+// Required options: rootdirectory
+// Optional options: maxsize
+func newDiskCacheStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	root, ok := options["rootdirectory"]
+	if !ok {
+		return nil, fmt.Errorf("No rootdirectory provided")
+	}
+	rootDirectory, ok := root.(string)
+	if !ok || rootDirectory == "" {
+		return nil, fmt.Errorf("rootdirectory must be a non-empty string")
+	}
+
+	maxSize := int64(defaultMaxSize)
+	if ms, ok := options["maxsize"]; ok {
+		switch ms := ms.(type) {
+		case int:
+			maxSize = int64(ms)
+		case int64:
+			maxSize = ms
+		case string:
+			var err error
+			maxSize, err = strconv.ParseInt(ms, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid maxsize: %v", err)
+			}
+		default:
+			return nil, fmt.Errorf("invalid type for maxsize: %#v", ms)
+		}
+		if maxSize <= 0 {
+			return nil, fmt.Errorf("maxsize must be positive: %d", maxSize)
+		}
+	}
+
+	cache, err := newDiskCache(rootDirectory, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskCacheStorageMiddleware{
+		StorageDriver: storageDriver,
+		cache:         cache,
+	}, nil
+}
+
+// GetContent serves blob data from the cache, filling it on a miss.
+func (d *diskCacheStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	dgst, ok := blobDigest(path)
+	if !ok {
+		return d.StorageDriver.GetContent(ctx, path)
+	}
+
+	if f, _, err := d.cache.open(path); err == nil {
+		defer f.Close()
+		return ioutil.ReadAll(f)
+	}
+
+	content, err := d.StorageDriver.GetContent(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if digest.FromBytes(content) != dgst {
+		context.GetLogger(ctx).Errorf("diskcache: content of %s does not match its digest, not caching", path)
+		return content, nil
+	}
+
+	if err := d.cache.put(path, content); err != nil {
+		context.GetLogger(ctx).Errorf("diskcache: error caching %s: %v", path, err)
+	}
+
+	return content, nil
+}
+
+// ReadStream serves blob data from the cache. On a miss, a stream read from
+// the start fills the cache as it is consumed.
+func (d *diskCacheStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	dgst, ok := blobDigest(path)
+	if !ok {
+		return d.StorageDriver.ReadStream(ctx, path, offset)
+	}
+
+	if f, size, err := d.cache.open(path); err == nil {
+		if offset < 0 || offset > size {
+			f.Close()
+			return nil, storagedriver.InvalidOffsetError{Path: path, Offset: offset, DriverName: d.Name()}
+		}
+		if _, err := f.Seek(offset, os.SEEK_SET); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+
+	rc, err := d.StorageDriver.ReadStream(ctx, path, offset)
+	if err != nil || offset != 0 {
+		return rc, err
+	}
+
+	fill, err := d.cache.fill(ctx, path, dgst)
+	if err != nil {
+		// The blob is already being filled, or cannot be: just stream it.
+		return rc, nil
+	}
+
+	return &fillReader{ReadCloser: rc, fill: fill}, nil
+}
+
+// ListFrom lists part of a directory of the wrapped driver, if it
+// implements storagedriver.PagedLister.
+func (d *diskCacheStorageMiddleware) ListFrom(ctx context.Context, path string, last string, n int) ([]string, error) {
+	lister, ok := d.StorageDriver.(storagedriver.PagedLister)
+	if !ok {
+		return nil, storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+	return lister.ListFrom(ctx, path, last, n)
+}
+
+// ListRecursive lists the files of the wrapped driver, if it implements
+// storagedriver.RecursiveLister.
+func (d *diskCacheStorageMiddleware) ListRecursive(ctx context.Context, path string, f func(storagedriver.FileInfo) error) error {
+	lister, ok := d.StorageDriver.(storagedriver.RecursiveLister)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+	return lister.ListRecursive(ctx, path, f)
+}
+
+// PutContent invalidates any cached copy of the content.
+func (d *diskCacheStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	d.cache.removeFile(path)
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+// WriteStream invalidates any cached copy of the content.
+func (d *diskCacheStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	d.cache.removeFile(path)
+	return d.StorageDriver.WriteStream(ctx, path, offset, reader)
+}
+
+// Move invalidates any cached copy of the content at both paths. Only blob
+// data is cached, which is moved file by file.
+func (d *diskCacheStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	d.cache.removeFile(sourcePath)
+	d.cache.removeFile(destPath)
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+// Delete invalidates the cached content at and below path.
+func (d *diskCacheStorageMiddleware) Delete(ctx context.Context, path string) error {
+	d.cache.remove(path)
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+// fillReader copies the stream read from the wrapped driver into the cache.
+// Readers such as blobServer.ServeBlob stop at the size of the blob without
+// reading to io.EOF, so the fill is also committed on Close once the content
+// read so far matches the digest.
+type fillReader struct {
+	io.ReadCloser
+	fill *cacheFill
+}
+
+func (r *fillReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.fill.write(p[:n])
+	}
+	if err == io.EOF {
+		r.fill.commit()
+	}
+	return n, err
+}
+
+func (r *fillReader) Close() error {
+	r.fill.finish()
+	return r.ReadCloser.Close()
+}
+
+// diskCache is a bounded least recently used cache of files kept below a root
+// directory, by storage driver path.
+type diskCache struct {
+	root    string
+	maxSize int64
+
+	mu      sync.Mutex // protects the fields below
+	size    int64
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+	filling map[string]*cacheFill
+}
+
+// cacheEntry is a file held by the cache.
+type cacheEntry struct {
+	path string
+	size int64
+}
+
+// newDiskCache returns the cache kept below root, indexing the files already
+// present from a previous run.
+func newDiskCache(root string, maxSize int64) (*diskCache, error) {
+	c := &diskCache{
+		root:    root,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		filling: make(map[string]*cacheFill),
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, tmpDir)); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(root, tmpDir), 0755); err != nil {
+		return nil, err
+	}
+
+	var files []cachedFile
+
+	err := filepath.Walk(root, func(fp string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, fp)
+		if err != nil {
+			return err
+		}
+		subPath := "/" + filepath.ToSlash(rel)
+
+		if _, ok := blobDigest(subPath); !ok {
+			return nil
+		}
+		files = append(files, cachedFile{path: subPath, size: fi.Size(), modTime: fi.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Files were touched when used, so the oldest are the least recently
+	// used.
+	sort.Sort(byModTime(files))
+	for _, f := range files {
+		c.entries[f.path] = c.lru.PushFront(&cacheEntry{path: f.path, size: f.size})
+		c.size += f.size
+	}
+	c.evict()
+
+	return c, nil
+}
+
+// cachedFile is a file found in the cache directory at startup.
+type cachedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// byModTime sorts cached files by modification time.
+type byModTime []cachedFile
+
+func (b byModTime) Len() int           { return len(b) }
+func (b byModTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byModTime) Less(i, j int) bool { return b[i].modTime.Before(b[j].modTime) }
+
+// filePath returns the local path of the file caching subPath.
+func (c *diskCache) filePath(subPath string) string {
+	return filepath.Join(c.root, filepath.FromSlash(subPath))
+}
+
+// open returns the cached file for subPath and its size, marking it as the
+// most recently used.
+func (c *diskCache) open(subPath string) (*os.File, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[subPath]
+	if !ok {
+		return nil, 0, os.ErrNotExist
+	}
+
+	f, err := os.Open(c.filePath(subPath))
+	if err != nil {
+		// The file disappeared from under the cache: forget it.
+		c.removeElement(e)
+		return nil, 0, err
+	}
+
+	c.lru.MoveToFront(e)
+	now := time.Now()
+	os.Chtimes(c.filePath(subPath), now, now)
+
+	return f, e.Value.(*cacheEntry).size, nil
+}
+
+// put caches content for subPath.
+func (c *diskCache) put(subPath string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Join(c.root, tmpDir), "put-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return c.add(subPath, tmp.Name(), int64(len(content)), nil)
+}
+
+// add moves the file at tmpPath, of the given size, into the cache as
+// subPath and evicts the least recently used files beyond the size limit.
+// When the file was filled by fill, it is only added if the blob was not
+// invalidated in the meantime.
+func (c *diskCache) add(subPath, tmpPath string, size int64, fill *cacheFill) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if size > c.maxSize || (fill != nil && c.filling[subPath] != fill) {
+		os.Remove(tmpPath)
+		return nil
+	}
+
+	if e, ok := c.entries[subPath]; ok {
+		c.removeElement(e)
+	}
+
+	fp := c.filePath(subPath)
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, fp); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	c.entries[subPath] = c.lru.PushFront(&cacheEntry{path: subPath, size: size})
+	c.size += size
+	c.evict()
+
+	return nil
+}
+
+// removeFile drops the cached file at subPath.
+func (c *diskCache) removeFile(subPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[subPath]; ok {
+		c.removeElement(e)
+	}
+
+	// A blob being filled is not added once complete.
+	delete(c.filling, subPath)
+}
+
+// remove drops the cached files at and below subPath.
+func (c *diskCache) remove(subPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prefix := strings.TrimSuffix(subPath, "/") + "/"
+	for p, e := range c.entries {
+		if p == subPath || strings.HasPrefix(p, prefix) {
+			c.removeElement(e)
+		}
+	}
+
+	// Blobs being filled are not added once complete.
+	for p := range c.filling {
+		if p == subPath || strings.HasPrefix(p, prefix) {
+			delete(c.filling, p)
+		}
+	}
+}
+
+// evict drops the least recently used files until the cache fits its size
+// limit. The caller must hold the lock.
+func (c *diskCache) evict() {
+	for c.size > c.maxSize {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// removeElement drops the file of e from the cache. The caller must hold the
+// lock.
+func (c *diskCache) removeElement(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, entry.path)
+	c.size -= entry.size
+	os.Remove(c.filePath(entry.path))
+}
+
+// fill starts filling the cache with the blob at subPath. It fails if the
+// blob is already being filled.
+func (c *diskCache) fill(ctx context.Context, subPath string, dgst digest.Digest) (*cacheFill, error) {
+	verifier, err := digest.NewDigestVerifier(dgst)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.filling[subPath]; ok {
+		return nil, fmt.Errorf("%s is already being cached", subPath)
+	}
+
+	f, err := ioutil.TempFile(filepath.Join(c.root, tmpDir), "fill-")
+	if err != nil {
+		return nil, err
+	}
+
+	cf := &cacheFill{
+		ctx:      ctx,
+		cache:    c,
+		path:     subPath,
+		file:     f,
+		verifier: verifier,
+	}
+	c.filling[subPath] = cf
+	return cf, nil
+}
+
+// cacheFill is a blob being copied into the cache. It is added to the cache
+// only once completely read and verified against its digest.
+type cacheFill struct {
+	ctx      context.Context
+	cache    *diskCache
+	path     string
+	file     *os.File // nil once committed or abandoned
+	verifier digest.Verifier
+	size     int64
+}
+
+func (cf *cacheFill) write(p []byte) {
+	if cf.file == nil {
+		return
+	}
+
+	if _, err := cf.file.Write(p); err != nil {
+		context.GetLogger(cf.ctx).Errorf("diskcache: error caching %s: %v", cf.path, err)
+		cf.abandon()
+		return
+	}
+	cf.verifier.Write(p)
+	cf.size += int64(len(p))
+}
+
+func (cf *cacheFill) commit() {
+	if cf.file == nil {
+		return
+	}
+	defer cf.done()
+
+	tmpPath := cf.file.Name()
+	if err := cf.file.Close(); err != nil {
+		context.GetLogger(cf.ctx).Errorf("diskcache: error caching %s: %v", cf.path, err)
+		os.Remove(tmpPath)
+		return
+	}
+
+	if !cf.verifier.Verified() {
+		context.GetLogger(cf.ctx).Errorf("diskcache: content of %s does not match its digest, not caching", cf.path)
+		os.Remove(tmpPath)
+		return
+	}
+
+	if err := cf.cache.add(cf.path, tmpPath, cf.size, cf); err != nil {
+		context.GetLogger(cf.ctx).Errorf("diskcache: error caching %s: %v", cf.path, err)
+	}
+}
+
+// finish commits the fill if the content written so far matches the digest,
+// and abandons it otherwise.
+func (cf *cacheFill) finish() {
+	if cf.file == nil {
+		return
+	}
+
+	if cf.verifier.Verified() {
+		cf.commit()
+	} else {
+		cf.abandon()
+	}
+}
+
+func (cf *cacheFill) abandon() {
+	if cf.file == nil {
+		return
+	}
+	defer cf.done()
+
+	cf.file.Close()
+	os.Remove(cf.file.Name())
+}
+
+func (cf *cacheFill) done() {
+	cf.file = nil
+
+	cf.cache.mu.Lock()
+	if cf.cache.filling[cf.path] == cf {
+		delete(cf.cache.filling, cf.path)
+	}
+	cf.cache.mu.Unlock()
+}
+
+// init registers the diskcache storage middleware.
+func init() {
+	storagemiddleware.Register("diskcache", storagemiddleware.InitFunc(newDiskCacheStorageMiddleware))
+}
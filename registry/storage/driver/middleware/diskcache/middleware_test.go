@@ -0,0 +1,316 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// countingDriver counts the reads made to the wrapped driver.
+type countingDriver struct {
+	storagedriver.StorageDriver
+	reads int
+}
+
+func (d *countingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	d.reads++
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func (d *countingDriver) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	d.reads++
+	return d.StorageDriver.ReadStream(ctx, path, offset)
+}
+
+func blobPath(content []byte) string {
+	dgst := digest.FromBytes(content)
+	return fmt.Sprintf("/docker/registry/v2/blobs/%s/%s/%s/data", dgst.Algorithm(), dgst.Hex()[:2], dgst.Hex())
+}
+
+func readStream(t *testing.T, driver storagedriver.StorageDriver, path string, offset int64) []byte {
+	rc, err := driver.ReadStream(context.Background(), path, offset)
+	if err != nil {
+		t.Fatalf("unexpected error reading %s: %v", path, err)
+	}
+	defer rc.Close()
+
+	p, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("unexpected error reading %s: %v", path, err)
+	}
+	return p
+}
+
+func newTestCache(t *testing.T, backend storagedriver.StorageDriver, root string, maxSize int) storagedriver.StorageDriver {
+	driver, err := newDiskCacheStorageMiddleware(backend, map[string]interface{}{
+		"rootdirectory": root,
+		"maxsize":       maxSize,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+	return driver
+}
+
+func TestDiskCache(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "diskcache-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	backend := &countingDriver{StorageDriver: inmemory.New()}
+	driver := newTestCache(t, backend, root, 1<<20)
+
+	content := bytes.Repeat([]byte("layer"), 1024)
+	p := blobPath(content)
+	if err := driver.PutContent(ctx, p, content); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	// The first read is served by the wrapped driver, and fills the cache.
+	if got := readStream(t, driver, p, 0); !bytes.Equal(got, content) {
+		t.Fatalf("unexpected content read")
+	}
+	if backend.reads != 1 {
+		t.Fatalf("unexpected reads of the wrapped driver: %d != 1", backend.reads)
+	}
+
+	// Later reads are served from the cache.
+	if got := readStream(t, driver, p, 0); !bytes.Equal(got, content) {
+		t.Fatalf("unexpected content read from cache")
+	}
+	if got := readStream(t, driver, p, 100); !bytes.Equal(got, content[100:]) {
+		t.Fatalf("unexpected content read from cache at offset")
+	}
+	if got, err := driver.GetContent(ctx, p); err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	} else if !bytes.Equal(got, content) {
+		t.Fatalf("unexpected content from cache")
+	}
+	if _, err := driver.ReadStream(ctx, p, int64(len(content)+1)); err == nil {
+		t.Fatalf("expected error reading past the end of a cached blob")
+	} else if _, ok := err.(storagedriver.InvalidOffsetError); !ok {
+		t.Fatalf("unexpected error reading past the end of a cached blob: %v", err)
+	}
+	if backend.reads != 1 {
+		t.Fatalf("unexpected reads of the wrapped driver: %d != 1", backend.reads)
+	}
+
+	// The cache is kept across restarts.
+	restarted := newTestCache(t, backend, root, 1<<20)
+	if got := readStream(t, restarted, p, 0); !bytes.Equal(got, content) {
+		t.Fatalf("unexpected content read from cache after restart")
+	}
+	if backend.reads != 1 {
+		t.Fatalf("unexpected reads of the wrapped driver after restart: %d != 1", backend.reads)
+	}
+
+	// Writing the blob again drops it from the cache.
+	if err := restarted.PutContent(ctx, p, content); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if got := readStream(t, restarted, p, 0); !bytes.Equal(got, content) {
+		t.Fatalf("unexpected content read after writing")
+	}
+	if backend.reads != 2 {
+		t.Fatalf("unexpected reads of the wrapped driver after writing: %d != 2", backend.reads)
+	}
+
+	// Deleting the blob drops it from the cache.
+	if err := driver.Delete(ctx, p[:len(p)-len("/data")]); err != nil {
+		t.Fatalf("unexpected error deleting blob: %v", err)
+	}
+	if _, err := driver.ReadStream(ctx, p, 0); err == nil {
+		t.Fatalf("expected error reading deleted blob")
+	}
+	if _, err := os.Stat(root + p); !os.IsNotExist(err) {
+		t.Fatalf("cached file of deleted blob still exists: %v", err)
+	}
+
+	// Other paths are never cached.
+	link := "/docker/registry/v2/repositories/foo/_manifests/tags/latest/current/link"
+	if err := driver.PutContent(ctx, link, []byte("sha256:abc")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	reads := backend.reads
+	driver.GetContent(ctx, link)
+	driver.GetContent(ctx, link)
+	if backend.reads != reads+2 {
+		t.Fatalf("expected mutable paths to be passed through")
+	}
+}
+
+func TestDiskCacheServeBlob(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "diskcache-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	backend := &countingDriver{StorageDriver: inmemory.New()}
+	driver := newTestCache(t, backend, root, 1<<20)
+
+	registry, err := storage.NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("unexpected error creating registry: %v", err)
+	}
+	name, _ := reference.ParseNamed("foo/bar")
+	repo, err := registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+
+	content := bytes.Repeat([]byte("served"), 1<<14)
+	desc, err := repo.Blobs(ctx).Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	// ServeBlob stops reading at the size of the blob, without reaching
+	// io.EOF, and still fills the cache.
+	for i := 0; i < 2; i++ {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		if err := repo.Blobs(ctx).ServeBlob(ctx, w, r, desc.Digest); err != nil {
+			t.Fatalf("unexpected error serving blob: %v", err)
+		}
+		if !bytes.Equal(w.Body.Bytes(), content) {
+			t.Fatalf("unexpected content served: %d bytes", w.Body.Len())
+		}
+
+		if _, err := os.Stat(root + blobPath(content)); err != nil {
+			t.Fatalf("expected served blob to be cached: %v", err)
+		}
+	}
+}
+
+func TestDiskCacheVerification(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "diskcache-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	backend := &countingDriver{StorageDriver: inmemory.New()}
+	driver := newTestCache(t, backend, root, 1<<20)
+
+	// Content not matching the digest in its path is served, but never
+	// cached.
+	p := blobPath([]byte("expected content"))
+	corrupted := []byte("corrupted content")
+	if err := backend.PutContent(ctx, p, corrupted); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if got := readStream(t, driver, p, 0); !bytes.Equal(got, corrupted) {
+			t.Fatalf("unexpected content read")
+		}
+		if _, err := driver.GetContent(ctx, p); err != nil {
+			t.Fatalf("unexpected error getting content: %v", err)
+		}
+	}
+	if backend.reads != 4 {
+		t.Fatalf("unexpected reads of the wrapped driver: %d != 4", backend.reads)
+	}
+
+	// A partially read stream is not cached either.
+	content := bytes.Repeat([]byte("partial"), 1024)
+	p = blobPath(content)
+	if err := backend.PutContent(ctx, p, content); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	rc, err := driver.ReadStream(ctx, p, 0)
+	if err != nil {
+		t.Fatalf("unexpected error reading stream: %v", err)
+	}
+	if _, err := rc.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("unexpected error reading stream: %v", err)
+	}
+	rc.Close()
+
+	readStream(t, driver, p, 0)
+	if backend.reads != 6 {
+		t.Fatalf("unexpected reads of the wrapped driver: %d != 6", backend.reads)
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "diskcache-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	const blobSize = 1024
+	backend := &countingDriver{StorageDriver: inmemory.New()}
+	driver := newTestCache(t, backend, root, 2*blobSize)
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		content := bytes.Repeat([]byte{byte(i)}, blobSize)
+		p := blobPath(content)
+		if err := backend.PutContent(ctx, p, content); err != nil {
+			t.Fatalf("unexpected error putting content: %v", err)
+		}
+		paths = append(paths, p)
+	}
+
+	// Cache the first two blobs, then use the first one again so that the
+	// second is the least recently used.
+	readStream(t, driver, paths[0], 0)
+	readStream(t, driver, paths[1], 0)
+	readStream(t, driver, paths[0], 0)
+	if backend.reads != 2 {
+		t.Fatalf("unexpected reads of the wrapped driver: %d != 2", backend.reads)
+	}
+
+	// Caching the third blob evicts the second.
+	readStream(t, driver, paths[2], 0)
+	readStream(t, driver, paths[2], 0)
+	readStream(t, driver, paths[0], 0)
+	if backend.reads != 3 {
+		t.Fatalf("unexpected reads of the wrapped driver: %d != 3", backend.reads)
+	}
+
+	readStream(t, driver, paths[1], 0)
+	if backend.reads != 4 {
+		t.Fatalf("expected evicted blob to be read from the wrapped driver")
+	}
+	if _, err := os.Stat(root + paths[1]); err != nil {
+		t.Fatalf("expected blob read again to be cached: %v", err)
+	}
+
+	// Blobs larger than the cache are never cached.
+	content := bytes.Repeat([]byte("large"), blobSize)
+	p := blobPath(content)
+	if err := backend.PutContent(ctx, p, content); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	readStream(t, driver, p, 0)
+	readStream(t, driver, p, 0)
+	if backend.reads != 6 {
+		t.Fatalf("unexpected reads of the wrapped driver: %d != 6", backend.reads)
+	}
+}
@@ -0,0 +1,534 @@
+// Package middleware - encryption at rest wrapper for storage drivers
+//
+// Every file written through the middleware is encrypted with AES in CTR
+// mode. The ciphertext is prefixed with a header recording the key and the
+// initialization vector used, so that files written with a retired key
+// remain readable for as long as that key is listed in the keyfile.
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+	"github.com/docker/distribution/uuid"
+)
+
+const (
+	// headerMagic identifies files written by the encryption middleware.
+	headerMagic = "DREN"
+
+	// headerVersion is the version of the header layout.
+	headerVersion = 1
+
+	// keyIDSize is the number of bytes of the key digest stored in the
+	// header to identify the key.
+	keyIDSize = 8
+
+	// headerSize is the size of the header preceding the ciphertext of every
+	// file: magic (4), version (1), reserved (3), key id (8) and iv (16).
+	headerSize = 4 + 1 + 3 + keyIDSize + aes.BlockSize
+)
+
+// encryptionKey is an AES key read from the keyfile.
+type encryptionKey struct {
+	id    [keyIDSize]byte
+	block cipher.Block
+}
+
+// fileHeader is the header stored in front of the ciphertext of a file.
+type fileHeader struct {
+	keyID [keyIDSize]byte
+	iv    [aes.BlockSize]byte
+}
+
+func (h *fileHeader) marshal() []byte {
+	p := make([]byte, headerSize)
+	copy(p, headerMagic)
+	p[4] = headerVersion
+	copy(p[8:], h.keyID[:])
+	copy(p[8+keyIDSize:], h.iv[:])
+	return p
+}
+
+func (h *fileHeader) unmarshal(p []byte) error {
+	if len(p) < headerSize || string(p[:4]) != headerMagic {
+		return fmt.Errorf("missing encryption header")
+	}
+	if p[4] != headerVersion {
+		return fmt.Errorf("unsupported encryption header version: %d", p[4])
+	}
+	copy(h.keyID[:], p[8:])
+	copy(h.iv[:], p[8+keyIDSize:])
+	return nil
+}
+
+// encryptionStorageMiddleware encrypts the content written to the wrapped
+// storage driver and decrypts the content read from it.
+type encryptionStorageMiddleware struct {
+	storagedriver.StorageDriver
+
+	// current is the key used to encrypt new content.
+	current *encryptionKey
+
+	// keys holds every key from the keyfile by id, including current.
+	keys map[[keyIDSize]byte]*encryptionKey
+}
+
+var _ storagedriver.StorageDriver = &encryptionStorageMiddleware{}
+
+// newEncryptionStorageMiddleware constructs and returns a new encryption
+// StorageDriver implementation.
+// Required options: keyfile
+func newEncryptionStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	kf, ok := options["keyfile"]
+	if !ok {
+		return nil, fmt.Errorf("No keyfile provided")
+	}
+	keyfile, ok := kf.(string)
+	if !ok {
+		return nil, fmt.Errorf("keyfile must be a string")
+	}
+
+	keys, err := loadKeys(keyfile)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &encryptionStorageMiddleware{
+		StorageDriver: storageDriver,
+		current:       keys[0],
+		keys:          make(map[[keyIDSize]byte]*encryptionKey),
+	}
+	for _, key := range keys {
+		d.keys[key.id] = key
+	}
+
+	return d, nil
+}
+
+// loadKeys reads the hex encoded AES keys listed one per line in keyfile.
+// Blank lines and lines starting with '#' are ignored. The first key is the
+// one used to encrypt.
+func loadKeys(keyfile string) ([]*encryptionKey, error) {
+	f, err := os.Open(keyfile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read keyfile: %s", err)
+	}
+	defer f.Close()
+
+	var keys []*encryptionKey
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		raw, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key on line %d of keyfile: %v", line, err)
+		}
+
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key on line %d of keyfile: %v", line, err)
+		}
+
+		key := &encryptionKey{block: block}
+		sum := sha256.Sum256(raw)
+		copy(key.id[:], sum[:])
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read keyfile: %s", err)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyfile %s contains no keys", keyfile)
+	}
+
+	return keys, nil
+}
+
+// newHeader returns a header for content encrypted with the current key
+// under a fresh initialization vector.
+func (d *encryptionStorageMiddleware) newHeader() (*fileHeader, error) {
+	h := &fileHeader{keyID: d.current.id}
+	if _, err := io.ReadFull(rand.Reader, h.iv[:]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// stream returns the keystream of the file described by h, positioned at
+// offset bytes into the plaintext.
+func (d *encryptionStorageMiddleware) stream(subPath string, h *fileHeader, offset int64) (cipher.Stream, error) {
+	key, ok := d.keys[h.keyID]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is encrypted with unknown key %x", d.Name(), subPath, h.keyID)
+	}
+
+	var iv [aes.BlockSize]byte
+	copy(iv[:], h.iv[:])
+
+	// The counter occupies the whole IV and is incremented as a big endian
+	// integer, one per block.
+	carry := uint64(offset / aes.BlockSize)
+	for i := len(iv) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(iv[i]) + carry&0xff
+		iv[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+
+	stream := cipher.NewCTR(key.block, iv[:])
+	skip := make([]byte, offset%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+
+	return stream, nil
+}
+
+// readHeader reads the header of the file at subPath from the wrapped driver.
+func (d *encryptionStorageMiddleware) readHeader(ctx context.Context, subPath string) (*fileHeader, error) {
+	rc, err := d.StorageDriver.ReadStream(ctx, subPath, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	p := make([]byte, headerSize)
+	if _, err := io.ReadFull(rc, p); err != nil {
+		return nil, fmt.Errorf("%s: unable to read encryption header of %s: %v", d.Name(), subPath, err)
+	}
+
+	h := &fileHeader{}
+	if err := h.unmarshal(p); err != nil {
+		return nil, fmt.Errorf("%s: %s: %v", d.Name(), subPath, err)
+	}
+
+	return h, nil
+}
+
+// GetContent retrieves and decrypts the content stored at "path".
+func (d *encryptionStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	p, err := d.StorageDriver.GetContent(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &fileHeader{}
+	if err := h.unmarshal(p); err != nil {
+		return nil, fmt.Errorf("%s: %s: %v", d.Name(), path, err)
+	}
+
+	stream, err := d.stream(path, h, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	content := make([]byte, len(p)-headerSize)
+	stream.XORKeyStream(content, p[headerSize:])
+	return content, nil
+}
+
+// PutContent encrypts and stores the content at "path".
+func (d *encryptionStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	h, err := d.newHeader()
+	if err != nil {
+		return err
+	}
+
+	stream, err := d.stream(path, h, 0)
+	if err != nil {
+		return err
+	}
+
+	p := make([]byte, headerSize+len(content))
+	copy(p, h.marshal())
+	stream.XORKeyStream(p[headerSize:], content)
+
+	return d.StorageDriver.PutContent(ctx, path, p)
+}
+
+// ReadStream retrieves a reader of the decrypted content stored at "path",
+// starting at the given offset.
+func (d *encryptionStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, storagedriver.InvalidOffsetError{Path: path, Offset: offset, DriverName: d.Name()}
+	}
+
+	h, err := d.readHeader(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := d.stream(path, h, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := d.StorageDriver.ReadStream(ctx, path, headerSize+offset)
+	if err != nil {
+		if _, ok := err.(storagedriver.InvalidOffsetError); ok {
+			return nil, storagedriver.InvalidOffsetError{Path: path, Offset: offset, DriverName: d.Name()}
+		}
+		return nil, err
+	}
+
+	return readCloser{
+		Reader: cipher.StreamReader{S: stream, R: rc},
+		Closer: rc,
+	}, nil
+}
+
+// WriteStream encrypts the contents of reader and stores it at "path",
+// starting at the given offset. Data written at the end of a file continues
+// its keystream; data overwriting part of a file causes the file to be
+// rewritten under a fresh initialization vector, so that no keystream is
+// ever used for two different plaintexts.
+func (d *encryptionStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	if offset < 0 {
+		return 0, storagedriver.InvalidOffsetError{Path: path, Offset: offset, DriverName: d.Name()}
+	}
+
+	fi, err := d.StorageDriver.Stat(ctx, path)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return 0, err
+		}
+		return d.writeNew(ctx, path, offset, reader)
+	}
+
+	size := fi.Size() - headerSize
+	if size < 0 {
+		return 0, fmt.Errorf("%s: %s: missing encryption header", d.Name(), path)
+	}
+
+	if offset >= size {
+		return d.writeAppend(ctx, path, size, offset, reader)
+	}
+
+	return d.writeRewrite(ctx, path, size, offset, reader)
+}
+
+// writeNew creates the file at subPath. The plaintext before offset is
+// filled with zeros.
+func (d *encryptionStorageMiddleware) writeNew(ctx context.Context, subPath string, offset int64, reader io.Reader) (int64, error) {
+	h, err := d.newHeader()
+	if err != nil {
+		return 0, err
+	}
+
+	stream, err := d.stream(subPath, h, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	nn, err := d.StorageDriver.WriteStream(ctx, subPath, 0, io.MultiReader(
+		bytes.NewReader(h.marshal()),
+		cipher.StreamReader{S: stream, R: io.MultiReader(zeros(offset), reader)},
+	))
+	return written(nn, headerSize+offset), err
+}
+
+// writeAppend continues the file at subPath, holding size bytes of plaintext,
+// with the contents of reader at offset. The plaintext between size and
+// offset is filled with zeros.
+func (d *encryptionStorageMiddleware) writeAppend(ctx context.Context, subPath string, size, offset int64, reader io.Reader) (int64, error) {
+	h, err := d.readHeader(ctx, subPath)
+	if err != nil {
+		return 0, err
+	}
+
+	stream, err := d.stream(subPath, h, size)
+	if err != nil {
+		return 0, err
+	}
+
+	nn, err := d.StorageDriver.WriteStream(ctx, subPath, headerSize+size, cipher.StreamReader{
+		S: stream,
+		R: io.MultiReader(zeros(offset-size), reader),
+	})
+	return written(nn, offset-size), err
+}
+
+// writeRewrite writes the contents of reader at offset within the file at
+// subPath, holding size bytes of plaintext, by writing the whole file anew
+// under a fresh initialization vector and moving it into place.
+func (d *encryptionStorageMiddleware) writeRewrite(ctx context.Context, subPath string, size, offset int64, reader io.Reader) (int64, error) {
+	head, err := d.ReadStream(ctx, subPath, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer head.Close()
+
+	counter := &countingReader{Reader: reader}
+	tail := &lazyReader{open: func() (io.ReadCloser, error) {
+		if offset+counter.n >= size {
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return d.ReadStream(ctx, subPath, offset+counter.n)
+	}}
+	defer tail.Close()
+
+	tmpPath := path.Join(path.Dir(subPath), fmt.Sprintf(".%s.%s", path.Base(subPath), uuid.Generate()))
+
+	h, err := d.newHeader()
+	if err != nil {
+		return 0, err
+	}
+
+	stream, err := d.stream(subPath, h, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := d.StorageDriver.WriteStream(ctx, tmpPath, 0, io.MultiReader(
+		bytes.NewReader(h.marshal()),
+		cipher.StreamReader{S: stream, R: io.MultiReader(io.LimitReader(head, offset), counter, tail)},
+	)); err != nil {
+		d.StorageDriver.Delete(ctx, tmpPath)
+		return 0, err
+	}
+
+	if err := d.StorageDriver.Move(ctx, tmpPath, subPath); err != nil {
+		d.StorageDriver.Delete(ctx, tmpPath)
+		return 0, err
+	}
+
+	return counter.n, nil
+}
+
+// Stat retrieves the FileInfo for the given path, reporting the size of the
+// decrypted content.
+func (d *encryptionStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	fi, err := d.StorageDriver.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{FileInfo: fi}, nil
+}
+
+// ListFrom lists part of a directory of the wrapped driver, if it
+// implements storagedriver.PagedLister.
+func (d *encryptionStorageMiddleware) ListFrom(ctx context.Context, path string, last string, n int) ([]string, error) {
+	lister, ok := d.StorageDriver.(storagedriver.PagedLister)
+	if !ok {
+		return nil, storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+	return lister.ListFrom(ctx, path, last, n)
+}
+
+// ListRecursive lists the files of the wrapped driver, if it implements
+// storagedriver.RecursiveLister, reporting the sizes of the decrypted
+// content.
+func (d *encryptionStorageMiddleware) ListRecursive(ctx context.Context, path string, f func(storagedriver.FileInfo) error) error {
+	lister, ok := d.StorageDriver.(storagedriver.RecursiveLister)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+
+	return lister.ListRecursive(ctx, path, func(fi storagedriver.FileInfo) error {
+		return f(fileInfo{FileInfo: fi})
+	})
+}
+
+// URLFor is not supported: content served directly by the storage backend
+// would not be decrypted.
+func (d *encryptionStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	return "", storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+}
+
+// fileInfo reports the size of a file without its encryption header.
+type fileInfo struct {
+	storagedriver.FileInfo
+}
+
+func (fi fileInfo) Size() int64 {
+	if fi.IsDir() || fi.FileInfo.Size() < headerSize {
+		return 0
+	}
+	return fi.FileInfo.Size() - headerSize
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// lazyReader opens its underlying reader on the first read.
+type lazyReader struct {
+	open func() (io.ReadCloser, error)
+	rc   io.ReadCloser
+}
+
+func (r *lazyReader) Read(p []byte) (int, error) {
+	if r.rc == nil {
+		rc, err := r.open()
+		if err != nil {
+			return 0, err
+		}
+		r.rc = rc
+	}
+	return r.rc.Read(p)
+}
+
+func (r *lazyReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	return r.rc.Close()
+}
+
+// zeros returns a reader of n zero bytes.
+func zeros(n int64) io.Reader {
+	return io.LimitReader(zeroReader{}, n)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// written returns the number of bytes of nn written to the wrapped driver
+// that came from the caller's reader, given the skip bytes written first.
+func written(nn, skip int64) int64 {
+	if nn < skip {
+		return 0
+	}
+	return nn - skip
+}
+
+// init registers the encryption storage middleware.
+func init() {
+	storagemiddleware.Register("encryption", storagemiddleware.InitFunc(newEncryptionStorageMiddleware))
+}
@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+// suiteDir holds the root of the driver tested by the suite and its keyfile,
+// which is kept out of the driver root.
+var suiteDir string
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.RemoveAll(suiteDir)
+	os.Exit(code)
+}
+
+func init() {
+	var err error
+	suiteDir, err = ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+
+	root := filepath.Join(suiteDir, "root")
+	keyfile, err := writeKeyfile(filepath.Join(suiteDir, "keys"), randomKey())
+	if err != nil {
+		panic(err)
+	}
+
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return newEncryptionStorageMiddleware(filesystem.New(root), map[string]interface{}{
+			"keyfile": keyfile,
+		})
+	}, testsuites.NeverSkip)
+}
+
+func randomKey() string {
+	p := make([]byte, 32)
+	if _, err := rand.Read(p); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(p)
+}
+
+func writeKeyfile(path string, keys ...string) (string, error) {
+	content := "# registry encryption keys\n\n" + strings.Join(keys, "\n") + "\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func TestEncryptedAtRest(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "encryption-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	keyfile, err := writeKeyfile(filepath.Join(root, "keys"), randomKey())
+	if err != nil {
+		t.Fatalf("unexpected error writing keyfile: %v", err)
+	}
+
+	backend := filesystem.New(filepath.Join(root, "storage"))
+	driver, err := newEncryptionStorageMiddleware(backend, map[string]interface{}{"keyfile": keyfile})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	content := bytes.Repeat([]byte("plaintext layer content "), 64)
+
+	if err := driver.PutContent(ctx, "/content", content); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if _, err := driver.WriteStream(ctx, "/stream", 0, bytes.NewReader(content)); err != nil {
+		t.Fatalf("unexpected error writing stream: %v", err)
+	}
+
+	for _, p := range []string{"/content", "/stream"} {
+		stored, err := backend.GetContent(ctx, p)
+		if err != nil {
+			t.Fatalf("unexpected error reading %s from backend: %v", p, err)
+		}
+		if bytes.Contains(stored, []byte("plaintext")) {
+			t.Fatalf("%s is stored in plaintext", p)
+		}
+		if len(stored) != len(content)+headerSize {
+			t.Fatalf("unexpected stored size of %s: %d != %d", p, len(stored), len(content)+headerSize)
+		}
+	}
+
+	if _, err := driver.URLFor(ctx, "/content", nil); err == nil {
+		t.Fatalf("expected URLFor to be unsupported")
+	} else if _, ok := err.(storagedriver.ErrUnsupportedMethod); !ok {
+		t.Fatalf("unexpected error from URLFor: %v", err)
+	}
+
+	// Content written without the middleware cannot be mistaken for
+	// ciphertext.
+	if err := backend.PutContent(ctx, "/unencrypted", content); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if _, err := driver.GetContent(ctx, "/unencrypted"); err == nil {
+		t.Fatalf("expected error reading unencrypted content")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "encryption-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	oldKey, newKey := randomKey(), randomKey()
+	backend := filesystem.New(filepath.Join(root, "storage"))
+
+	keyfile, err := writeKeyfile(filepath.Join(root, "keys"), oldKey)
+	if err != nil {
+		t.Fatalf("unexpected error writing keyfile: %v", err)
+	}
+	driver, err := newEncryptionStorageMiddleware(backend, map[string]interface{}{"keyfile": keyfile})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	oldContent := []byte("written with the old key")
+	if _, err := driver.WriteStream(ctx, "/old", 0, bytes.NewReader(oldContent)); err != nil {
+		t.Fatalf("unexpected error writing stream: %v", err)
+	}
+
+	// Rotate: the new key encrypts, the old one is kept for reading.
+	if _, err := writeKeyfile(keyfile, newKey, oldKey); err != nil {
+		t.Fatalf("unexpected error writing keyfile: %v", err)
+	}
+	rotated, err := newEncryptionStorageMiddleware(backend, map[string]interface{}{"keyfile": keyfile})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	got, err := rotated.GetContent(ctx, "/old")
+	if err != nil {
+		t.Fatalf("unexpected error reading content written with the old key: %v", err)
+	}
+	if !bytes.Equal(got, oldContent) {
+		t.Fatalf("unexpected content: %q != %q", got, oldContent)
+	}
+
+	// Appending continues with the key the file was written with.
+	more := []byte(", appended after rotation")
+	if _, err := rotated.WriteStream(ctx, "/old", int64(len(oldContent)), bytes.NewReader(more)); err != nil {
+		t.Fatalf("unexpected error appending: %v", err)
+	}
+	got, err = rotated.GetContent(ctx, "/old")
+	if err != nil {
+		t.Fatalf("unexpected error reading appended content: %v", err)
+	}
+	if expected := append(append([]byte{}, oldContent...), more...); !bytes.Equal(got, expected) {
+		t.Fatalf("unexpected content: %q != %q", got, expected)
+	}
+
+	newContent := []byte("written with the new key")
+	if err := rotated.PutContent(ctx, "/new", newContent); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	// Once the old key is retired, only content written with the new key
+	// remains readable.
+	if _, err := writeKeyfile(keyfile, newKey); err != nil {
+		t.Fatalf("unexpected error writing keyfile: %v", err)
+	}
+	retired, err := newEncryptionStorageMiddleware(backend, map[string]interface{}{"keyfile": keyfile})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	if got, err := retired.GetContent(ctx, "/new"); err != nil {
+		t.Fatalf("unexpected error reading content written with the new key: %v", err)
+	} else if !bytes.Equal(got, newContent) {
+		t.Fatalf("unexpected content: %q != %q", got, newContent)
+	}
+
+	if _, err := retired.GetContent(ctx, "/old"); err == nil {
+		t.Fatalf("expected error reading content written with a retired key")
+	}
+}
+
+func TestInvalidKeyfile(t *testing.T) {
+	root, err := ioutil.TempDir("", "encryption-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	backend := filesystem.New(filepath.Join(root, "storage"))
+
+	for _, keys := range [][]string{
+		nil,
+		{"not hex"},
+		{"0123456789abcdef"}, // 8 bytes is not an AES key size
+	} {
+		keyfile, err := writeKeyfile(filepath.Join(root, "keys"), keys...)
+		if err != nil {
+			t.Fatalf("unexpected error writing keyfile: %v", err)
+		}
+
+		if _, err := newEncryptionStorageMiddleware(backend, map[string]interface{}{"keyfile": keyfile}); err == nil {
+			t.Fatalf("expected error loading keyfile with keys %v", keys)
+		}
+	}
+
+	if _, err := newEncryptionStorageMiddleware(backend, map[string]interface{}{}); err == nil {
+		t.Fatalf("expected error without keyfile")
+	}
+}
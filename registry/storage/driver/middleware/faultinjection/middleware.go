@@ -0,0 +1,523 @@
+// Package middleware - fault injection wrapper for storage drivers
+//
+// The middleware makes calls to the wrapped driver fail at configured rates,
+// slows them down, interrupts streams being written and returns stale Stat
+// and List results for recently changed paths, as eventually consistent
+// object stores do. It is meant for testing how the registry copes with an
+// unreliable storage backend, and must not be used in production.
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+// ErrInjectedFault is the error enclosed in the storagedriver.Error returned
+// by calls made to fail.
+var ErrInjectedFault = errors.New("injected fault")
+
+// maxPartialWrite bounds the number of bytes written by a WriteStream call
+// before it is interrupted.
+const maxPartialWrite = 32 << 10
+
+// methods are the names of the StorageDriver methods faults are injected in.
+var methods = []string{
+	"GetContent",
+	"PutContent",
+	"ReadStream",
+	"WriteStream",
+	"Stat",
+	"List",
+	"ListFrom",
+	"ListRecursive",
+	"Move",
+	"Delete",
+	"URLFor",
+}
+
+// methodFaults are the faults injected in calls to a method.
+type methodFaults struct {
+	errorRate float64       // probability of a call failing
+	latency   time.Duration // delay added to every call
+}
+
+// change records the state of a path before it was last changed.
+type change struct {
+	prev storagedriver.FileInfo // nil if the path did not exist
+	at   time.Time
+}
+
+// faultInjectionStorageMiddleware injects faults in the calls made to the
+// wrapped storage driver.
+type faultInjectionStorageMiddleware struct {
+	storagedriver.StorageDriver
+
+	faults           map[string]methodFaults // by method name
+	partialWriteRate float64
+	staleRate        float64
+	staleness        time.Duration
+
+	mu      sync.Mutex // protects the fields below
+	rand    *rand.Rand
+	changes map[string]change // recent changes, by path
+}
+
+var _ storagedriver.StorageDriver = &faultInjectionStorageMiddleware{}
+
+// New returns storageDriver wrapped to inject the faults described by
+// options, as given in the configuration of the middleware. It allows tests,
+// such as those registered with testsuites.RegisterSuite, to run against an
+// unreliable driver.
+func New(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return newFaultInjectionStorageMiddleware(storageDriver, options)
+}
+
+// newFaultInjectionStorageMiddleware constructs and returns a new fault
+// injecting StorageDriver implementation.
+// Optional options: seed, errorrate, latency, methods, partialwriterate,
+// stalerate, staleness
+func newFaultInjectionStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	seed := time.Now().UnixNano()
+	if s, ok := options["seed"]; ok {
+		switch s := s.(type) {
+		case int:
+			seed = int64(s)
+		case int64:
+			seed = s
+		case string:
+			var err error
+			if seed, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid seed: %v", err)
+			}
+		default:
+			return nil, fmt.Errorf("invalid type for seed: %#v", s)
+		}
+	}
+
+	defaults, err := parseMethodFaults(options, methodFaults{})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &faultInjectionStorageMiddleware{
+		StorageDriver: storageDriver,
+		faults:        make(map[string]methodFaults),
+		rand:          rand.New(rand.NewSource(seed)),
+		changes:       make(map[string]change),
+		staleness:     5 * time.Second,
+	}
+
+	for _, method := range methods {
+		d.faults[method] = defaults
+	}
+
+	if m, ok := options["methods"]; ok {
+		perMethod, err := toMap(m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid methods: %v", err)
+		}
+
+		for name, o := range perMethod {
+			method, ok := lookupMethod(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown method: %s", name)
+			}
+
+			methodOptions, err := toMap(o)
+			if err != nil {
+				return nil, fmt.Errorf("invalid options for method %s: %v", name, err)
+			}
+
+			if d.faults[method], err = parseMethodFaults(methodOptions, defaults); err != nil {
+				return nil, fmt.Errorf("invalid options for method %s: %v", name, err)
+			}
+		}
+	}
+
+	if d.partialWriteRate, err = parseRate(options, "partialwriterate"); err != nil {
+		return nil, err
+	}
+	if d.staleRate, err = parseRate(options, "stalerate"); err != nil {
+		return nil, err
+	}
+	if s, ok := options["staleness"]; ok {
+		if d.staleness, err = parseDuration(s); err != nil {
+			return nil, fmt.Errorf("invalid staleness: %v", err)
+		}
+	}
+
+	return d, nil
+}
+
+// parseMethodFaults returns the faults described by the errorrate and
+// latency options, falling back to defaults.
+func parseMethodFaults(options map[string]interface{}, defaults methodFaults) (methodFaults, error) {
+	faults := defaults
+
+	if _, ok := options["errorrate"]; ok {
+		rate, err := parseRate(options, "errorrate")
+		if err != nil {
+			return faults, err
+		}
+		faults.errorRate = rate
+	}
+
+	if l, ok := options["latency"]; ok {
+		latency, err := parseDuration(l)
+		if err != nil {
+			return faults, fmt.Errorf("invalid latency: %v", err)
+		}
+		faults.latency = latency
+	}
+
+	return faults, nil
+}
+
+// parseRate returns the probability given as the named option, zero if
+// absent.
+func parseRate(options map[string]interface{}, name string) (float64, error) {
+	var rate float64
+	switch r := options[name].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		rate = r
+	case int:
+		rate = float64(r)
+	case string:
+		var err error
+		if rate, err = strconv.ParseFloat(r, 64); err != nil {
+			return 0, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	default:
+		return 0, fmt.Errorf("invalid type for %s: %#v", name, r)
+	}
+
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("%s must be between 0 and 1: %v", name, rate)
+	}
+	return rate, nil
+}
+
+func parseDuration(d interface{}) (time.Duration, error) {
+	switch d := d.(type) {
+	case time.Duration:
+		return d, nil
+	case int:
+		return time.Duration(d), nil
+	case string:
+		return time.ParseDuration(d)
+	default:
+		return 0, fmt.Errorf("invalid type for duration: %#v", d)
+	}
+}
+
+// toMap converts options parsed from the configuration to a map keyed by
+// string.
+func toMap(v interface{}) (map[string]interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, v := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key: %#v", k)
+			}
+			m[key] = v
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("expected a map: %#v", v)
+	}
+}
+
+// lookupMethod returns the name of the method named name, ignoring case.
+func lookupMethod(name string) (string, bool) {
+	for _, method := range methods {
+		if strings.EqualFold(method, name) {
+			return method, true
+		}
+	}
+	return "", false
+}
+
+// roll reports whether an event of probability rate happens.
+func (d *faultInjectionStorageMiddleware) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rand.Float64() < rate
+}
+
+// inject delays a call to method, and returns the error it must fail with,
+// if any.
+func (d *faultInjectionStorageMiddleware) inject(method string) error {
+	faults := d.faults[method]
+	if faults.latency > 0 {
+		time.Sleep(faults.latency)
+	}
+
+	if d.roll(faults.errorRate) {
+		return storagedriver.Error{DriverName: d.Name(), Enclosed: ErrInjectedFault}
+	}
+	return nil
+}
+
+// recordChange records the state of subPath, and of its missing parents,
+// before changing it, so that stale results can be returned for them.
+func (d *faultInjectionStorageMiddleware) recordChange(ctx context.Context, subPath string) {
+	if d.staleRate <= 0 {
+		return
+	}
+
+	now := time.Now()
+	changes := make(map[string]change)
+	for p := subPath; p != "/" && p != "."; p = path.Dir(p) {
+		fi, err := d.StorageDriver.Stat(ctx, p)
+		if err != nil {
+			fi = nil
+		}
+		changes[p] = change{prev: fi, at: now}
+
+		if fi != nil {
+			break
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for p, c := range d.changes {
+		if now.Sub(c.at) > d.staleness {
+			delete(d.changes, p)
+		}
+	}
+	for p, c := range changes {
+		// Keep the oldest state within the window, which stays visible
+		// until the window has passed since the last change.
+		if prev, ok := d.changes[p]; ok {
+			c.prev = prev.prev
+		}
+		d.changes[p] = c
+	}
+}
+
+// recentChanges returns the changes made within the staleness window.
+func (d *faultInjectionStorageMiddleware) recentChanges() map[string]change {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	changes := make(map[string]change)
+	for p, c := range d.changes {
+		if time.Since(c.at) <= d.staleness {
+			changes[p] = c
+		}
+	}
+	return changes
+}
+
+func (d *faultInjectionStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if err := d.inject("GetContent"); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func (d *faultInjectionStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	if err := d.inject("PutContent"); err != nil {
+		return err
+	}
+	d.recordChange(ctx, path)
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+func (d *faultInjectionStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	if err := d.inject("ReadStream"); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.ReadStream(ctx, path, offset)
+}
+
+// WriteStream may be interrupted after writing part of the stream, returning
+// the number of bytes written along with an error.
+func (d *faultInjectionStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	if err := d.inject("WriteStream"); err != nil {
+		return 0, err
+	}
+	d.recordChange(ctx, path)
+
+	if d.roll(d.partialWriteRate) {
+		d.mu.Lock()
+		n := d.rand.Int63n(maxPartialWrite)
+		d.mu.Unlock()
+
+		reader = &interruptedReader{Reader: reader, remaining: n}
+	}
+
+	nn, err := d.StorageDriver.WriteStream(ctx, path, offset, reader)
+	if r, ok := reader.(*interruptedReader); ok && r.interrupted && err == nil {
+		err = storagedriver.Error{DriverName: d.Name(), Enclosed: ErrInjectedFault}
+	}
+	return nn, err
+}
+
+// Stat may return the state of a recently changed path before the change.
+func (d *faultInjectionStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if err := d.inject("Stat"); err != nil {
+		return nil, err
+	}
+
+	if d.staleRate > 0 {
+		if c, ok := d.recentChanges()[path]; ok && d.roll(d.staleRate) {
+			if c.prev == nil {
+				return nil, storagedriver.PathNotFoundError{Path: path, DriverName: d.Name()}
+			}
+			return c.prev, nil
+		}
+	}
+
+	return d.StorageDriver.Stat(ctx, path)
+}
+
+// List may omit recently created children of the directory, and include
+// recently deleted ones.
+func (d *faultInjectionStorageMiddleware) List(ctx context.Context, subPath string) ([]string, error) {
+	if err := d.inject("List"); err != nil {
+		return nil, err
+	}
+
+	children, err := d.StorageDriver.List(ctx, subPath)
+	if d.staleRate <= 0 || !d.roll(d.staleRate) {
+		return children, err
+	}
+	if _, ok := err.(storagedriver.PathNotFoundError); err != nil && !ok {
+		return children, err
+	}
+
+	stale := make(map[string]bool)
+	for _, child := range children {
+		stale[child] = true
+	}
+	for p, c := range d.recentChanges() {
+		if path.Dir(p) != subPath {
+			continue
+		}
+		if c.prev == nil {
+			delete(stale, p)
+		} else {
+			stale[p] = true
+		}
+	}
+
+	if err != nil && len(stale) == 0 {
+		return nil, err
+	}
+
+	children = children[:0]
+	for child := range stale {
+		children = append(children, child)
+	}
+	sort.Strings(children)
+
+	return children, nil
+}
+
+// ListFrom lists part of a directory of the wrapped driver, if it implements
+// storagedriver.PagedLister.
+func (d *faultInjectionStorageMiddleware) ListFrom(ctx context.Context, path string, last string, n int) ([]string, error) {
+	lister, ok := d.StorageDriver.(storagedriver.PagedLister)
+	if !ok {
+		return nil, storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+
+	if err := d.inject("ListFrom"); err != nil {
+		return nil, err
+	}
+	return lister.ListFrom(ctx, path, last, n)
+}
+
+// ListRecursive lists the files of the wrapped driver, if it implements
+// storagedriver.RecursiveLister.
+func (d *faultInjectionStorageMiddleware) ListRecursive(ctx context.Context, path string, f func(storagedriver.FileInfo) error) error {
+	lister, ok := d.StorageDriver.(storagedriver.RecursiveLister)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+
+	if err := d.inject("ListRecursive"); err != nil {
+		return err
+	}
+	return lister.ListRecursive(ctx, path, f)
+}
+
+func (d *faultInjectionStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if err := d.inject("Move"); err != nil {
+		return err
+	}
+	d.recordChange(ctx, sourcePath)
+	d.recordChange(ctx, destPath)
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+func (d *faultInjectionStorageMiddleware) Delete(ctx context.Context, path string) error {
+	if err := d.inject("Delete"); err != nil {
+		return err
+	}
+	d.recordChange(ctx, path)
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+func (d *faultInjectionStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	if err := d.inject("URLFor"); err != nil {
+		return "", err
+	}
+	return d.StorageDriver.URLFor(ctx, path, options)
+}
+
+// interruptedReader ends the stream once remaining bytes have been read, as
+// a connection dropped in the middle of a request, so that the wrapped driver
+// stores only the bytes read so far.
+type interruptedReader struct {
+	io.Reader
+	remaining   int64
+	interrupted bool // whether bytes were left unread
+}
+
+func (r *interruptedReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		if !r.interrupted {
+			var b [1]byte
+			n, _ := io.ReadFull(r.Reader, b[:])
+			r.interrupted = n > 0
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.Reader.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// init registers the faultinjection storage middleware.
+func init() {
+	storagemiddleware.Register("faultinjection", storagemiddleware.InitFunc(newFaultInjectionStorageMiddleware))
+}
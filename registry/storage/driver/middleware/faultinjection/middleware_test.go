@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/filesystem"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+func init() {
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(root)
+
+	// Without faults configured, the middleware must pass the whole suite.
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return New(filesystem.New(root), map[string]interface{}{})
+	}, testsuites.NeverSkip)
+}
+
+func newTestDriver(t *testing.T, options map[string]interface{}) storagedriver.StorageDriver {
+	options["seed"] = 1
+	driver, err := New(inmemory.New(), options)
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+	return driver
+}
+
+func isInjected(err error) bool {
+	e, ok := err.(storagedriver.Error)
+	return ok && e.Enclosed == ErrInjectedFault
+}
+
+func TestErrorRates(t *testing.T) {
+	ctx := context.Background()
+	driver := newTestDriver(t, map[string]interface{}{
+		"methods": map[interface{}]interface{}{
+			"stat": map[interface{}]interface{}{
+				"errorrate": 1,
+			},
+			"getcontent": map[interface{}]interface{}{
+				"errorrate": "0.5",
+			},
+		},
+	})
+
+	if err := driver.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	if _, err := driver.Stat(ctx, "/a"); !isInjected(err) {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+
+	var failed int
+	for i := 0; i < 1000; i++ {
+		if _, err := driver.GetContent(ctx, "/a"); err != nil {
+			if !isInjected(err) {
+				t.Fatalf("unexpected error getting content: %v", err)
+			}
+			failed++
+		}
+	}
+	if failed < 400 || failed > 600 {
+		t.Fatalf("unexpected number of failures at rate 0.5: %d/1000", failed)
+	}
+
+	if _, err := newFaultInjectionStorageMiddleware(inmemory.New(), map[string]interface{}{"errorrate": 2}); err == nil {
+		t.Fatalf("expected error for rate greater than 1")
+	}
+	if _, err := newFaultInjectionStorageMiddleware(inmemory.New(), map[string]interface{}{
+		"methods": map[string]interface{}{"Unknown": map[string]interface{}{}},
+	}); err == nil {
+		t.Fatalf("expected error for unknown method")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	ctx := context.Background()
+	driver := newTestDriver(t, map[string]interface{}{
+		"methods": map[string]interface{}{
+			"List": map[string]interface{}{
+				"latency": "50ms",
+			},
+		},
+	})
+
+	if err := driver.PutContent(ctx, "/dir/a", []byte("content")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := driver.List(ctx, "/dir"); err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected latency to be added, took %v", elapsed)
+	}
+}
+
+func TestPartialWrites(t *testing.T) {
+	ctx := context.Background()
+	driver := newTestDriver(t, map[string]interface{}{
+		"partialwriterate": 1,
+	})
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), maxPartialWrite/8)
+	nn, err := driver.WriteStream(ctx, "/upload", 0, bytes.NewReader(content))
+	if !isInjected(err) {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+	if nn >= int64(len(content)) {
+		t.Fatalf("expected a partial write, wrote %d bytes", nn)
+	}
+
+	written, err := driver.GetContent(ctx, "/upload")
+	if err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	}
+	if !bytes.Equal(written, content[:nn]) {
+		t.Fatalf("unexpected content written: %d bytes reported, %d bytes written", nn, len(written))
+	}
+}
+
+func TestStaleResults(t *testing.T) {
+	ctx := context.Background()
+	driver := newTestDriver(t, map[string]interface{}{
+		"stalerate": 1,
+		"staleness": "100ms",
+	})
+
+	if err := driver.PutContent(ctx, "/dir/old", []byte("old")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := driver.PutContent(ctx, "/dir/new", []byte("new")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := driver.PutContent(ctx, "/dir/old", []byte("updated")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	// Within the window, the changes are not visible to Stat and List.
+	if _, err := driver.Stat(ctx, "/dir/new"); err == nil {
+		t.Fatalf("expected new file to be missing")
+	} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fi, err := driver.Stat(ctx, "/dir/old")
+	if err != nil {
+		t.Fatalf("unexpected error stating: %v", err)
+	}
+	if fi.Size() != int64(len("old")) {
+		t.Fatalf("expected stale size, got %d", fi.Size())
+	}
+	children, err := driver.List(ctx, "/dir")
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if !reflect.DeepEqual(children, []string{"/dir/old"}) {
+		t.Fatalf("unexpected stale listing: %v", children)
+	}
+
+	if err := driver.Delete(ctx, "/dir/old"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+	if _, err := driver.Stat(ctx, "/dir/old"); err != nil {
+		t.Fatalf("expected deleted file to be visible: %v", err)
+	}
+
+	// Content is never stale.
+	if _, err := driver.GetContent(ctx, "/dir/new"); err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	}
+
+	// After the window, they are.
+	time.Sleep(100 * time.Millisecond)
+	if _, err := driver.Stat(ctx, "/dir/new"); err != nil {
+		t.Fatalf("unexpected error stating: %v", err)
+	}
+	if _, err := driver.Stat(ctx, "/dir/old"); err == nil {
+		t.Fatalf("expected deleted file to be missing")
+	}
+	children, err = driver.List(ctx, "/dir")
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if !reflect.DeepEqual(children, []string{"/dir/new"}) {
+		t.Fatalf("unexpected listing: %v", children)
+	}
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram buckets. Calls
+// slower than the last bound are counted in the "+Inf" bucket.
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// OperationMetrics track the calls made to a storage driver method.
+type OperationMetrics struct {
+	Calls    int64            // total calls
+	Bytes    int64            // total bytes read or written
+	Duration time.Duration    // total time spent in calls
+	Latency  map[string]int64 // latency histogram, by bucket upper bound
+	Errors   map[string]int64 // errors, by class
+}
+
+// driverMetrics holds the metrics of every method of the storage drivers
+// sharing a name.
+type driverMetrics struct {
+	sync.Mutex // protects operations
+	operations map[string]*OperationMetrics
+}
+
+// operation returns the metrics of method, allocating them if needed. The
+// caller must hold the lock.
+func (dm *driverMetrics) operation(method string) *OperationMetrics {
+	om, ok := dm.operations[method]
+	if !ok {
+		om = &OperationMetrics{
+			Latency: make(map[string]int64),
+			Errors:  make(map[string]int64),
+		}
+		dm.operations[method] = om
+	}
+	return om
+}
+
+// record counts a call to method which started at start, transferred n bytes
+// and returned err.
+func (dm *driverMetrics) record(method string, start time.Time, n int64, err error) {
+	latency := time.Since(start)
+
+	dm.Lock()
+	defer dm.Unlock()
+
+	om := dm.operation(method)
+	om.Calls++
+	om.Bytes += n
+	om.Duration += latency
+	om.Latency[latencyBucket(latency)]++
+	if err != nil {
+		om.Errors[errorClass(err)]++
+	}
+}
+
+// addBytes counts n more bytes transferred by method, after the call
+// returned.
+func (dm *driverMetrics) addBytes(method string, n int64) {
+	dm.Lock()
+	defer dm.Unlock()
+
+	dm.operation(method).Bytes += n
+}
+
+// snapshot returns a copy of the metrics, by method.
+func (dm *driverMetrics) snapshot() map[string]OperationMetrics {
+	dm.Lock()
+	defer dm.Unlock()
+
+	operations := make(map[string]OperationMetrics, len(dm.operations))
+	for method, om := range dm.operations {
+		cp := *om
+		cp.Latency = make(map[string]int64, len(om.Latency))
+		for k, v := range om.Latency {
+			cp.Latency[k] = v
+		}
+		cp.Errors = make(map[string]int64, len(om.Errors))
+		for k, v := range om.Errors {
+			cp.Errors[k] = v
+		}
+		operations[method] = cp
+	}
+	return operations
+}
+
+// latencyBucket returns the label of the histogram bucket counting latency.
+func latencyBucket(latency time.Duration) string {
+	for _, bound := range latencyBuckets {
+		if latency <= bound {
+			return bound.String()
+		}
+	}
+	return "+Inf"
+}
+
+// errorClass returns the class under which err is counted.
+func errorClass(err error) string {
+	switch err.(type) {
+	case storagedriver.PathNotFoundError:
+		return "PathNotFound"
+	case storagedriver.InvalidPathError:
+		return "InvalidPath"
+	case storagedriver.InvalidOffsetError:
+		return "InvalidOffset"
+	case storagedriver.ErrUnsupportedMethod:
+		return "UnsupportedMethod"
+	default:
+		return "Other"
+	}
+}
+
+// drivers is the global registry of driver metrics, by driver name, reported
+// to expvar.
+var drivers struct {
+	metrics map[string]*driverMetrics
+	mu      sync.Mutex
+}
+
+// metricsFor returns the metrics of the storage drivers named name.
+func metricsFor(name string) *driverMetrics {
+	drivers.mu.Lock()
+	defer drivers.mu.Unlock()
+
+	if drivers.metrics == nil {
+		drivers.metrics = make(map[string]*driverMetrics)
+	}
+
+	dm, ok := drivers.metrics[name]
+	if !ok {
+		dm = &driverMetrics{operations: make(map[string]*OperationMetrics)}
+		drivers.metrics[name] = dm
+	}
+	return dm
+}
+
+func init() {
+	registry := expvar.Get("registry")
+	if registry == nil {
+		registry = expvar.NewMap("registry")
+	}
+
+	storage := registry.(*expvar.Map).Get("storage")
+	if storage == nil {
+		storage = &expvar.Map{}
+		storage.(*expvar.Map).Init()
+		registry.(*expvar.Map).Set("storage", storage)
+	}
+
+	storage.(*expvar.Map).Set("drivers", expvar.Func(func() interface{} {
+		drivers.mu.Lock()
+		defer drivers.mu.Unlock()
+
+		metrics := make(map[string]map[string]OperationMetrics, len(drivers.metrics))
+		for name, dm := range drivers.metrics {
+			metrics[name] = dm.snapshot()
+		}
+		return metrics
+	}))
+}
@@ -0,0 +1,159 @@
+// Package middleware - instrumentation wrapper for storage drivers
+//
+// The middleware records the number of calls, the latency, the bytes
+// transferred and the errors of every StorageDriver method, per driver name,
+// and reports them through expvar under registry.storage.drivers.
+package middleware
+
+import (
+	"io"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+// instrumentedStorageMiddleware records metrics for the calls made to the
+// wrapped storage driver.
+type instrumentedStorageMiddleware struct {
+	storagedriver.StorageDriver
+	metrics *driverMetrics
+}
+
+var _ storagedriver.StorageDriver = &instrumentedStorageMiddleware{}
+
+// newInstrumentedStorageMiddleware constructs and returns a new instrumented
+// StorageDriver implementation. It takes no options.
+func newInstrumentedStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return &instrumentedStorageMiddleware{
+		StorageDriver: storageDriver,
+		metrics:       metricsFor(storageDriver.Name()),
+	}, nil
+}
+
+func (d *instrumentedStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	start := time.Now()
+	content, err := d.StorageDriver.GetContent(ctx, path)
+	d.metrics.record("GetContent", start, int64(len(content)), err)
+	return content, err
+}
+
+func (d *instrumentedStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	start := time.Now()
+	err := d.StorageDriver.PutContent(ctx, path, content)
+	var n int64
+	if err == nil {
+		n = int64(len(content))
+	}
+	d.metrics.record("PutContent", start, n, err)
+	return err
+}
+
+// ReadStream records the time taken to open the stream. The bytes read are
+// counted as the stream is consumed.
+func (d *instrumentedStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := d.StorageDriver.ReadStream(ctx, path, offset)
+	d.metrics.record("ReadStream", start, 0, err)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReadCloser{ReadCloser: rc, metrics: d.metrics}, nil
+}
+
+func (d *instrumentedStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	start := time.Now()
+	nn, err := d.StorageDriver.WriteStream(ctx, path, offset, reader)
+	d.metrics.record("WriteStream", start, nn, err)
+	return nn, err
+}
+
+func (d *instrumentedStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	start := time.Now()
+	fi, err := d.StorageDriver.Stat(ctx, path)
+	d.metrics.record("Stat", start, 0, err)
+	return fi, err
+}
+
+func (d *instrumentedStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	start := time.Now()
+	children, err := d.StorageDriver.List(ctx, path)
+	d.metrics.record("List", start, 0, err)
+	return children, err
+}
+
+func (d *instrumentedStorageMiddleware) ListFrom(ctx context.Context, path string, last string, n int) ([]string, error) {
+	lister, ok := d.StorageDriver.(storagedriver.PagedLister)
+	if !ok {
+		return nil, storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+
+	start := time.Now()
+	children, err := lister.ListFrom(ctx, path, last, n)
+	d.metrics.record("ListFrom", start, 0, err)
+	return children, err
+}
+
+// ListRecursive records the time taken by the whole listing, including the
+// calls to f.
+func (d *instrumentedStorageMiddleware) ListRecursive(ctx context.Context, path string, f func(storagedriver.FileInfo) error) error {
+	lister, ok := d.StorageDriver.(storagedriver.RecursiveLister)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+
+	start := time.Now()
+	err := lister.ListRecursive(ctx, path, f)
+	d.metrics.record("ListRecursive", start, 0, err)
+	return err
+}
+
+func (d *instrumentedStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	start := time.Now()
+	err := d.StorageDriver.Move(ctx, sourcePath, destPath)
+	d.metrics.record("Move", start, 0, err)
+	return err
+}
+
+func (d *instrumentedStorageMiddleware) Delete(ctx context.Context, path string) error {
+	start := time.Now()
+	err := d.StorageDriver.Delete(ctx, path)
+	d.metrics.record("Delete", start, 0, err)
+	return err
+}
+
+func (d *instrumentedStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	start := time.Now()
+	u, err := d.StorageDriver.URLFor(ctx, path, options)
+	d.metrics.record("URLFor", start, 0, err)
+	return u, err
+}
+
+// countingReadCloser counts the bytes read from a stream opened by
+// ReadStream. The count is published to the metrics once the stream is
+// closed, so that reads do not contend on the metrics lock.
+type countingReadCloser struct {
+	io.ReadCloser
+	metrics *driverMetrics
+	n       int64
+}
+
+func (rc *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	rc.n += int64(n)
+	return n, err
+}
+
+func (rc *countingReadCloser) Close() error {
+	if rc.n > 0 {
+		rc.metrics.addBytes("ReadStream", rc.n)
+		rc.n = 0
+	}
+	return rc.ReadCloser.Close()
+}
+
+// init registers the instrumentation storage middleware.
+func init() {
+	storagemiddleware.Register("instrumentation", storagemiddleware.InitFunc(newInstrumentedStorageMiddleware))
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"io/ioutil"
+	"testing"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// namedDriver gives the wrapped driver a name unique to the test, so that
+// its metrics are not shared with other drivers.
+type namedDriver struct {
+	storagedriver.StorageDriver
+	name string
+}
+
+func (d namedDriver) Name() string {
+	return d.name
+}
+
+func TestInstrumentation(t *testing.T) {
+	ctx := context.Background()
+	driver, err := newInstrumentedStorageMiddleware(namedDriver{inmemory.New(), "instrumented"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	content := []byte("instrumented content")
+
+	if err := driver.PutContent(ctx, "/a", content); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if _, err := driver.GetContent(ctx, "/a"); err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	}
+	if _, err := driver.GetContent(ctx, "/missing"); err == nil {
+		t.Fatalf("expected error getting missing content")
+	}
+	if _, err := driver.WriteStream(ctx, "/b", 0, bytes.NewReader(content)); err != nil {
+		t.Fatalf("unexpected error writing stream: %v", err)
+	}
+
+	rc, err := driver.ReadStream(ctx, "/b", 0)
+	if err != nil {
+		t.Fatalf("unexpected error reading stream: %v", err)
+	}
+	if _, err := ioutil.ReadAll(rc); err != nil {
+		t.Fatalf("unexpected error reading stream: %v", err)
+	}
+	rc.Close()
+
+	if _, err := driver.Stat(ctx, "/b"); err != nil {
+		t.Fatalf("unexpected error stating: %v", err)
+	}
+	if _, err := driver.List(ctx, "/"); err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+
+	// The metrics are read back through expvar, as reported on the debug
+	// server.
+	var reported map[string]map[string]OperationMetrics
+	drivers := expvar.Get("registry").(*expvar.Map).Get("storage").(*expvar.Map).Get("drivers")
+	if err := json.Unmarshal([]byte(drivers.String()), &reported); err != nil {
+		t.Fatalf("unexpected error decoding metrics: %v", err)
+	}
+
+	metrics, ok := reported["instrumented"]
+	if !ok {
+		t.Fatalf("no metrics reported for driver: %v", reported)
+	}
+
+	for method, expected := range map[string]struct {
+		calls, bytes int64
+		errors       map[string]int64
+	}{
+		"PutContent":  {1, int64(len(content)), nil},
+		"GetContent":  {2, int64(len(content)), map[string]int64{"PathNotFound": 1}},
+		"WriteStream": {1, int64(len(content)), nil},
+		"ReadStream":  {1, int64(len(content)), nil},
+		"Stat":        {1, 0, nil},
+		"List":        {1, 0, nil},
+	} {
+		om := metrics[method]
+		if om.Calls != expected.calls {
+			t.Errorf("unexpected %s calls: %d != %d", method, om.Calls, expected.calls)
+		}
+		if om.Bytes != expected.bytes {
+			t.Errorf("unexpected %s bytes: %d != %d", method, om.Bytes, expected.bytes)
+		}
+
+		var histogram int64
+		for _, n := range om.Latency {
+			histogram += n
+		}
+		if histogram != expected.calls {
+			t.Errorf("unexpected %s latency histogram count: %d != %d", method, histogram, expected.calls)
+		}
+
+		if len(om.Errors) != len(expected.errors) {
+			t.Errorf("unexpected %s errors: %v != %v", method, om.Errors, expected.errors)
+		}
+		for class, n := range expected.errors {
+			if om.Errors[class] != n {
+				t.Errorf("unexpected %s %s errors: %d != %d", method, class, om.Errors[class], n)
+			}
+		}
+	}
+
+	if _, ok := metrics["Delete"]; ok {
+		t.Errorf("unexpected metrics for a method never called")
+	}
+}
@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/context"
+)
+
+const (
+	// journalFile holds the operations journaled, one JSON object per line.
+	journalFile = "journal"
+
+	// appliedFile holds the number of operations of the journal already
+	// applied.
+	appliedFile = "applied"
+
+	// compactThreshold is the number of applied operations past which the
+	// journal is rewritten without them.
+	compactThreshold = 1024
+
+	// maxRetryInterval bounds the interval between attempts at applying an
+	// operation.
+	maxRetryInterval = time.Minute
+)
+
+// journal applies operations in order in the background, keeping those not
+// yet applied on disk so that they survive restarts. An operation failing to
+// apply is retried until it succeeds, holding back the later ones.
+type journal struct {
+	dir   string
+	apply func(operation) error
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	file    *os.File    // journal file, opened for appending
+	pending []operation // operations not yet applied, in order
+	applied int         // operations of the journal file already applied
+}
+
+// newJournal opens the journal kept in dir and starts applying the operations
+// it holds.
+func newJournal(dir string, apply func(operation) error) (*journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	j := &journal{dir: dir, apply: apply}
+	j.cond = sync.NewCond(&j.mu)
+
+	ops, err := readJournal(filepath.Join(dir, journalFile))
+	if err != nil {
+		return nil, err
+	}
+
+	if p, err := ioutil.ReadFile(filepath.Join(dir, appliedFile)); err == nil {
+		j.applied, err = strconv.Atoi(strings.TrimSpace(string(p)))
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if j.applied > len(ops) {
+		j.applied = len(ops)
+	}
+	j.pending = ops[j.applied:]
+
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+
+	go j.run()
+
+	return j, nil
+}
+
+// readJournal returns the operations held in the journal file at fp.
+func readJournal(fp string) ([]operation, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var ops []operation
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var op operation
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			// A partially written last line, left by a crash, was never
+			// acknowledged: drop it.
+			break
+		}
+		ops = append(ops, op)
+	}
+
+	return ops, scanner.Err()
+}
+
+// add journals op, to be applied after the operations already pending.
+func (j *journal) add(op operation) error {
+	p, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(append(p, '\n')); err != nil {
+		return err
+	}
+
+	j.pending = append(j.pending, op)
+	j.cond.Signal()
+	return nil
+}
+
+// run applies the pending operations, forever.
+func (j *journal) run() {
+	for {
+		j.mu.Lock()
+		for len(j.pending) == 0 {
+			j.cond.Wait()
+		}
+		op := j.pending[0]
+		j.mu.Unlock()
+
+		for retry := time.Second; ; retry *= 2 {
+			err := j.apply(op)
+			if err == nil {
+				break
+			}
+
+			if retry > maxRetryInterval {
+				retry = maxRetryInterval
+			}
+			context.GetLogger(context.Background()).Errorf("mirror: error applying %s of %s, retrying in %v: %v", op.Op, op.Path, retry, err)
+			time.Sleep(retry)
+		}
+
+		j.mu.Lock()
+		j.pending = j.pending[1:]
+		j.applied++
+		if err := j.commit(); err != nil {
+			context.GetLogger(context.Background()).Errorf("mirror: error updating journal: %v", err)
+		}
+		j.mu.Unlock()
+	}
+}
+
+// commit records the progress made applying the journal. The caller must
+// hold the lock.
+func (j *journal) commit() error {
+	if len(j.pending) == 0 || j.applied >= compactThreshold {
+		return j.compact()
+	}
+	return ioutil.WriteFile(filepath.Join(j.dir, appliedFile), []byte(strconv.Itoa(j.applied)), 0644)
+}
+
+// compact rewrites the journal file with the pending operations only, and
+// reopens it for appending. The caller must hold the lock, unless the
+// journal is not running yet.
+func (j *journal) compact() error {
+	tmp, err := ioutil.TempFile(j.dir, journalFile+"-")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, op := range j.pending {
+		if err := enc.Encode(op); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// The applied count is reset before replacing the journal: a crash in
+	// between replays operations, which is harmless, rather than skipping
+	// them.
+	if err := ioutil.WriteFile(filepath.Join(j.dir, appliedFile), []byte("0"), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	j.applied = 0
+	if err := os.Rename(tmp.Name(), filepath.Join(j.dir, journalFile)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(j.dir, journalFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file = f
+
+	return nil
+}
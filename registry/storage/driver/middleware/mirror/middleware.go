@@ -0,0 +1,315 @@
+// Package middleware - write mirroring wrapper for storage drivers
+//
+// Every change made through the middleware is replicated to a secondary
+// storage driver, either before the call returns or in the background
+// through a journal kept on local disk. Reads failing on the primary driver
+// are retried on the secondary one.
+package middleware
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+const (
+	// modeSync replicates each change before returning from the call.
+	modeSync = "sync"
+
+	// modeAsync replicates changes in the background, through a journal.
+	modeAsync = "async"
+)
+
+// operation is a change to replicate to the secondary driver.
+type operation struct {
+	Op     string `json:"op"` // "put", "write", "move" or "delete"
+	Path   string `json:"path"`
+	Dest   string `json:"dest,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// mirrorStorageMiddleware replicates the changes made to the wrapped storage
+// driver to a secondary driver.
+type mirrorStorageMiddleware struct {
+	storagedriver.StorageDriver
+	secondary storagedriver.StorageDriver
+
+	// journal holds the changes left to replicate in async mode. It is nil
+	// in sync mode.
+	journal *journal
+}
+
+var _ storagedriver.StorageDriver = &mirrorStorageMiddleware{}
+
+// newMirrorStorageMiddleware constructs and returns a new mirroring
+// StorageDriver implementation.
+// Required options: driver, journaldirectory (in async mode)
+// Optional options: parameters, mode
+func newMirrorStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	drv, ok := options["driver"]
+	if !ok {
+		return nil, fmt.Errorf("No driver provided")
+	}
+	driverName, ok := drv.(string)
+	if !ok {
+		return nil, fmt.Errorf("driver must be a string")
+	}
+
+	parameters := make(map[string]interface{})
+	if params, ok := options["parameters"]; ok && params != nil {
+		switch params := params.(type) {
+		case map[string]interface{}:
+			parameters = params
+		case map[interface{}]interface{}:
+			for k, v := range params {
+				key, ok := k.(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid parameter name: %#v", k)
+				}
+				parameters[key] = v
+			}
+		default:
+			return nil, fmt.Errorf("invalid type for parameters: %#v", params)
+		}
+	}
+
+	mode := modeSync
+	if m, ok := options["mode"]; ok {
+		if mode, ok = m.(string); !ok || (mode != modeSync && mode != modeAsync) {
+			return nil, fmt.Errorf("mode must be %q or %q", modeSync, modeAsync)
+		}
+	}
+
+	secondary, err := factory.Create(driverName, parameters)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create secondary %s driver: %v", driverName, err)
+	}
+
+	d := &mirrorStorageMiddleware{
+		StorageDriver: storageDriver,
+		secondary:     secondary,
+	}
+
+	if mode == modeAsync {
+		dir, ok := options["journaldirectory"].(string)
+		if !ok || dir == "" {
+			return nil, fmt.Errorf("journaldirectory must be a non-empty string in async mode")
+		}
+
+		d.journal, err = newJournal(dir, func(op operation) error {
+			return d.replicate(context.Background(), op)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// mirror replicates op, or journals it in async mode.
+func (d *mirrorStorageMiddleware) mirror(ctx context.Context, op operation) error {
+	if d.journal != nil {
+		return d.journal.add(op)
+	}
+
+	if err := d.replicate(ctx, op); err != nil {
+		return fmt.Errorf("%s: unable to mirror %s of %s to %s: %v", d.Name(), op.Op, op.Path, d.secondary.Name(), err)
+	}
+	return nil
+}
+
+// replicate applies op to the secondary driver. Content is copied from the
+// primary driver as it is when op is replicated: content changed again since
+// op was made is brought up to date by the later operations.
+func (d *mirrorStorageMiddleware) replicate(ctx context.Context, op operation) error {
+	switch op.Op {
+	case "put":
+		content, err := d.StorageDriver.GetContent(ctx, op.Path)
+		if err != nil {
+			return ignoreMissing(err)
+		}
+		return d.secondary.PutContent(ctx, op.Path, content)
+	case "write":
+		size := int64(-1)
+		if fi, err := d.secondary.Stat(ctx, op.Path); err == nil {
+			size = fi.Size()
+		} else if ignoreMissing(err) != nil {
+			return err
+		}
+
+		// The secondary is missing the data before the write: copy the
+		// whole file instead.
+		if size < op.Offset || op.Offset == 0 {
+			return d.copyFile(ctx, op.Path)
+		}
+
+		rc, err := d.StorageDriver.ReadStream(ctx, op.Path, op.Offset)
+		if err != nil {
+			return ignoreMissing(err)
+		}
+		defer rc.Close()
+
+		_, err = d.secondary.WriteStream(ctx, op.Path, op.Offset, io.LimitReader(rc, op.Size))
+		return err
+	case "move":
+		err := d.secondary.Move(ctx, op.Path, op.Dest)
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			// The source never made it to the secondary.
+			return d.copyFile(ctx, op.Dest)
+		}
+		return err
+	case "delete":
+		return ignoreMissing(d.secondary.Delete(ctx, op.Path))
+	default:
+		return fmt.Errorf("unknown operation: %q", op.Op)
+	}
+}
+
+// copyFile replaces the file at subPath on the secondary driver with the one
+// on the primary driver.
+func (d *mirrorStorageMiddleware) copyFile(ctx context.Context, subPath string) error {
+	rc, err := d.StorageDriver.ReadStream(ctx, subPath, 0)
+	if err != nil {
+		return ignoreMissing(err)
+	}
+	defer rc.Close()
+
+	// Writing at offset zero does not truncate the existing file.
+	if err := ignoreMissing(d.secondary.Delete(ctx, subPath)); err != nil {
+		return err
+	}
+
+	_, err = d.secondary.WriteStream(ctx, subPath, 0, rc)
+	return err
+}
+
+// ignoreMissing returns err, unless it reports a missing path. Content
+// missing from the primary driver has been moved or deleted since, which the
+// later operations replicate.
+func ignoreMissing(err error) error {
+	switch err.(type) {
+	case storagedriver.PathNotFoundError, storagedriver.InvalidOffsetError:
+		return nil
+	}
+	return err
+}
+
+// fallback reports whether a read failing with err on the primary driver
+// should be retried on the secondary. Errors describing the request rather
+// than a failure of the driver are not.
+func fallback(err error) bool {
+	switch err.(type) {
+	case storagedriver.PathNotFoundError, storagedriver.InvalidPathError, storagedriver.InvalidOffsetError:
+		return false
+	}
+	return err != nil
+}
+
+func (d *mirrorStorageMiddleware) GetContent(ctx context.Context, path string) ([]byte, error) {
+	content, err := d.StorageDriver.GetContent(ctx, path)
+	if fallback(err) {
+		context.GetLogger(ctx).Errorf("%s: reading %s from %s after error: %v", d.Name(), path, d.secondary.Name(), err)
+		return d.secondary.GetContent(ctx, path)
+	}
+	return content, err
+}
+
+func (d *mirrorStorageMiddleware) PutContent(ctx context.Context, path string, content []byte) error {
+	if err := d.StorageDriver.PutContent(ctx, path, content); err != nil {
+		return err
+	}
+	return d.mirror(ctx, operation{Op: "put", Path: path})
+}
+
+func (d *mirrorStorageMiddleware) ReadStream(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	rc, err := d.StorageDriver.ReadStream(ctx, path, offset)
+	if fallback(err) {
+		context.GetLogger(ctx).Errorf("%s: reading %s from %s after error: %v", d.Name(), path, d.secondary.Name(), err)
+		return d.secondary.ReadStream(ctx, path, offset)
+	}
+	return rc, err
+}
+
+func (d *mirrorStorageMiddleware) WriteStream(ctx context.Context, path string, offset int64, reader io.Reader) (int64, error) {
+	nn, err := d.StorageDriver.WriteStream(ctx, path, offset, reader)
+	if nn > 0 {
+		if merr := d.mirror(ctx, operation{Op: "write", Path: path, Offset: offset, Size: nn}); err == nil {
+			err = merr
+		}
+	}
+	return nn, err
+}
+
+func (d *mirrorStorageMiddleware) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	fi, err := d.StorageDriver.Stat(ctx, path)
+	if fallback(err) {
+		context.GetLogger(ctx).Errorf("%s: reading %s from %s after error: %v", d.Name(), path, d.secondary.Name(), err)
+		return d.secondary.Stat(ctx, path)
+	}
+	return fi, err
+}
+
+func (d *mirrorStorageMiddleware) List(ctx context.Context, path string) ([]string, error) {
+	children, err := d.StorageDriver.List(ctx, path)
+	if fallback(err) {
+		context.GetLogger(ctx).Errorf("%s: reading %s from %s after error: %v", d.Name(), path, d.secondary.Name(), err)
+		return d.secondary.List(ctx, path)
+	}
+	return children, err
+}
+
+// ListFrom lists part of a directory of the wrapped driver, if it implements
+// storagedriver.PagedLister, falling back to the secondary driver if it does
+// too.
+func (d *mirrorStorageMiddleware) ListFrom(ctx context.Context, path string, last string, n int) ([]string, error) {
+	lister, ok := d.StorageDriver.(storagedriver.PagedLister)
+	if !ok {
+		return nil, storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+
+	children, err := lister.ListFrom(ctx, path, last, n)
+	if _, ok := err.(storagedriver.ErrUnsupportedMethod); ok {
+		return nil, err
+	}
+	if secondary, ok := d.secondary.(storagedriver.PagedLister); ok && fallback(err) {
+		context.GetLogger(ctx).Errorf("%s: reading %s from %s after error: %v", d.Name(), path, d.secondary.Name(), err)
+		return secondary.ListFrom(ctx, path, last, n)
+	}
+	return children, err
+}
+
+// ListRecursive lists the files of the wrapped driver, if it implements
+// storagedriver.RecursiveLister. Since f may already have been called when
+// the listing fails, it is not retried on the secondary driver.
+func (d *mirrorStorageMiddleware) ListRecursive(ctx context.Context, path string, f func(storagedriver.FileInfo) error) error {
+	lister, ok := d.StorageDriver.(storagedriver.RecursiveLister)
+	if !ok {
+		return storagedriver.ErrUnsupportedMethod{DriverName: d.Name()}
+	}
+	return lister.ListRecursive(ctx, path, f)
+}
+
+func (d *mirrorStorageMiddleware) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if err := d.StorageDriver.Move(ctx, sourcePath, destPath); err != nil {
+		return err
+	}
+	return d.mirror(ctx, operation{Op: "move", Path: sourcePath, Dest: destPath})
+}
+
+func (d *mirrorStorageMiddleware) Delete(ctx context.Context, path string) error {
+	if err := d.StorageDriver.Delete(ctx, path); err != nil {
+		return err
+	}
+	return d.mirror(ctx, operation{Op: "delete", Path: path})
+}
+
+// init registers the mirror storage middleware.
+func init() {
+	storagemiddleware.Register("mirror", storagemiddleware.InitFunc(newMirrorStorageMiddleware))
+}
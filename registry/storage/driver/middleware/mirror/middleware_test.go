@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func newTestMirror(t *testing.T, primary storagedriver.StorageDriver, options map[string]interface{}) *mirrorStorageMiddleware {
+	options["driver"] = "inmemory"
+	driver, err := newMirrorStorageMiddleware(primary, options)
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+	return driver.(*mirrorStorageMiddleware)
+}
+
+// exercise makes changes of every kind through driver.
+func exercise(t *testing.T, driver storagedriver.StorageDriver) {
+	ctx := context.Background()
+
+	if err := driver.PutContent(ctx, "/put", []byte("put content")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := driver.PutContent(ctx, "/deleted/file", []byte("deleted")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := driver.Delete(ctx, "/deleted"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+
+	// A stream written in two parts, then moved into place.
+	if _, err := driver.WriteStream(ctx, "/upload", 0, bytes.NewReader([]byte("first part, "))); err != nil {
+		t.Fatalf("unexpected error writing stream: %v", err)
+	}
+	if _, err := driver.WriteStream(ctx, "/upload", 12, bytes.NewReader([]byte("second part"))); err != nil {
+		t.Fatalf("unexpected error writing stream: %v", err)
+	}
+	if err := driver.Move(ctx, "/upload", "/blob"); err != nil {
+		t.Fatalf("unexpected error moving: %v", err)
+	}
+}
+
+// checkMirrored verifies that the changes made by exercise are on secondary.
+func checkMirrored(secondary storagedriver.StorageDriver) error {
+	ctx := context.Background()
+
+	for p, expected := range map[string]string{
+		"/put":  "put content",
+		"/blob": "first part, second part",
+	} {
+		content, err := secondary.GetContent(ctx, p)
+		if err != nil {
+			return fmt.Errorf("unexpected error reading %s from secondary: %v", p, err)
+		}
+		if string(content) != expected {
+			return fmt.Errorf("unexpected content of %s on secondary: %q != %q", p, content, expected)
+		}
+	}
+
+	for _, p := range []string{"/deleted/file", "/upload"} {
+		if _, err := secondary.Stat(ctx, p); err == nil {
+			return fmt.Errorf("expected %s to be missing from secondary", p)
+		}
+	}
+
+	return nil
+}
+
+func TestMirrorSync(t *testing.T) {
+	driver := newTestMirror(t, inmemory.New(), map[string]interface{}{})
+
+	exercise(t, driver)
+	if err := checkMirrored(driver.secondary); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMirrorAsync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	driver := newTestMirror(t, inmemory.New(), map[string]interface{}{
+		"mode":             "async",
+		"journaldirectory": dir,
+	})
+
+	exercise(t, driver)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := checkMirrored(driver.secondary)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("changes not mirrored in time: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Operations that cannot be applied are kept in the journal.
+	failing, err := newJournal(dir, func(op operation) error {
+		return fmt.Errorf("secondary unavailable")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error opening journal: %v", err)
+	}
+
+	expected := []operation{
+		{Op: "put", Path: "/a"},
+		{Op: "write", Path: "/b", Offset: 10, Size: 20},
+		{Op: "move", Path: "/b", Dest: "/c"},
+		{Op: "delete", Path: "/a"},
+	}
+	for _, op := range expected {
+		if err := failing.add(op); err != nil {
+			t.Fatalf("unexpected error journaling operation: %v", err)
+		}
+	}
+
+	// Reopening the journal, as on restart, applies them in order.
+	applied := make(chan operation, len(expected))
+	if _, err := newJournal(dir, func(op operation) error {
+		applied <- op
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error opening journal: %v", err)
+	}
+
+	for _, op := range expected {
+		select {
+		case got := <-applied:
+			if got != op {
+				t.Fatalf("unexpected operation applied: %#v != %#v", got, op)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("operation not applied in time: %#v", op)
+		}
+	}
+}
+
+// failingDriver fails every read.
+type failingDriver struct {
+	storagedriver.StorageDriver
+}
+
+func (d failingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	return nil, fmt.Errorf("primary unavailable")
+}
+
+func (d failingDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	return nil, storagedriver.PathNotFoundError{Path: path, DriverName: d.Name()}
+}
+
+func TestMirrorReadFallback(t *testing.T) {
+	ctx := context.Background()
+	driver := newTestMirror(t, failingDriver{inmemory.New()}, map[string]interface{}{})
+
+	if err := driver.PutContent(ctx, "/a", []byte("content")); err == nil {
+		t.Fatalf("expected error mirroring content unreadable from the primary")
+	}
+	if err := driver.secondary.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	content, err := driver.GetContent(ctx, "/a")
+	if err != nil {
+		t.Fatalf("unexpected error reading content: %v", err)
+	}
+	if string(content) != "content" {
+		t.Fatalf("unexpected content read from secondary: %q", content)
+	}
+
+	// Missing paths are not looked up on the secondary.
+	if _, err := driver.Stat(ctx, "/a"); err == nil {
+		t.Fatalf("expected path missing from the primary to be missing")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -719,6 +720,183 @@ func (d *driver) List(ctx context.Context, opath string) ([]string, error) {
 	return append(files, directories...), nil
 }
 
+// ListFrom returns at most n of the direct descendants of the given path
+// whose name follows last, in lexical order. The objects are listed from a
+// marker in the order of their keys, in which a directory such as "a/"
+// follows its siblings "a-b/" and "a.b/": the listing goes on past the n
+// first names until no such directory may precede them.
+func (d *driver) ListFrom(ctx context.Context, opath string, last string, n int) ([]string, error) {
+	path := opath
+	if path != "/" && path[len(path)-1] != '/' {
+		path = path + "/"
+	}
+
+	// See List for the handling of an empty root directory.
+	prefix := ""
+	if d.s3Path("") == "" {
+		prefix = "/"
+	}
+
+	dirPrefix := d.s3Path(path)
+	marker := ""
+	if last != "" {
+		marker = dirPrefix + last
+	}
+
+	var names []string // the smallest names found, sorted
+	found := false
+	for {
+		listResponse, err := d.Bucket.List(dirPrefix, "/", marker, listMax)
+		if err != nil {
+			return nil, parseError(opath, err)
+		}
+
+		keys := make([]string, 0, len(listResponse.Contents)+len(listResponse.CommonPrefixes))
+		for _, key := range listResponse.Contents {
+			keys = append(keys, key.Key)
+		}
+		keys = append(keys, listResponse.CommonPrefixes...)
+		sort.Strings(keys)
+
+		done := false
+		for _, key := range keys {
+			found = true
+
+			if len(names) == n && !mayPrecede(key[len(dirPrefix):], names) {
+				done = true
+				break
+			}
+
+			name := strings.TrimSuffix(key[len(dirPrefix):], "/")
+			if name == "" || name <= last {
+				continue
+			}
+
+			i := sort.SearchStrings(names, name)
+			if i < len(names) && names[i] == name {
+				continue
+			}
+			names = append(names, "")
+			copy(names[i+1:], names[i:])
+			names[i] = name
+			if len(names) > n {
+				names = names[:n]
+			}
+		}
+
+		if done || !listResponse.IsTruncated {
+			break
+		}
+
+		marker = listResponse.NextMarker
+		if marker == "" && len(keys) > 0 {
+			marker = keys[len(keys)-1]
+		}
+	}
+
+	if !found && opath != "/" {
+		// Nothing follows last: check whether the directory exists at all.
+		exists := false
+		if last != "" {
+			listResponse, err := d.Bucket.List(dirPrefix, "/", "", 1)
+			if err != nil {
+				return nil, parseError(opath, err)
+			}
+			exists = len(listResponse.Contents) > 0 || len(listResponse.CommonPrefixes) > 0
+		}
+
+		if !exists {
+			// Treat empty response as missing directory, since we don't
+			// actually have directories in s3.
+			return nil, storagedriver.PathNotFoundError{Path: opath}
+		}
+	}
+
+	entries := make([]string, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, strings.Replace(dirPrefix+name, d.s3Path(""), prefix, 1))
+	}
+	return entries, nil
+}
+
+// mayPrecede reports whether the entry listed under key, relative to the
+// listed directory, may precede the last of names lexically. Only the
+// directory of a prefix of that name, followed by a character ordered before
+// "/", is listed after it while preceding it.
+func mayPrecede(key string, names []string) bool {
+	if len(names) == 0 {
+		return false
+	}
+
+	name := names[len(names)-1]
+	for i := 1; i < len(name); i++ {
+		if name[i] < '/' {
+			// The shortest such prefix is listed last.
+			return key <= name[:i]+"/"
+		}
+	}
+	return false
+}
+
+// ListRecursive calls f for each object below the given path, listing the
+// objects by prefix, without delimiter, in lexical order of their keys.
+func (d *driver) ListRecursive(ctx context.Context, opath string, f func(storagedriver.FileInfo) error) error {
+	path := opath
+	if path != "/" && path[len(path)-1] != '/' {
+		path = path + "/"
+	}
+
+	// See List for the handling of an empty root directory.
+	prefix := ""
+	if d.s3Path("") == "" {
+		prefix = "/"
+	}
+
+	found := false
+	marker := ""
+	for {
+		listResponse, err := d.Bucket.List(d.s3Path(path), "", marker, listMax)
+		if err != nil {
+			return parseError(opath, err)
+		}
+
+		for _, key := range listResponse.Contents {
+			found = true
+
+			timestamp, err := time.Parse(time.RFC3339Nano, key.LastModified)
+			if err != nil {
+				return err
+			}
+
+			if err := f(storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+				Path:    strings.Replace(key.Key, d.s3Path(""), prefix, 1),
+				Size:    key.Size,
+				ModTime: timestamp,
+			}}); err != nil {
+				return err
+			}
+		}
+
+		if !listResponse.IsTruncated {
+			break
+		}
+
+		// S3 only returns the next marker when listing with a delimiter.
+		marker = listResponse.NextMarker
+		if marker == "" && len(listResponse.Contents) > 0 {
+			marker = listResponse.Contents[len(listResponse.Contents)-1].Key
+		}
+	}
+
+	if !found && opath != "/" {
+		// Treat empty response as missing directory, since we don't actually
+		// have directories in s3.
+		return storagedriver.PathNotFoundError{Path: opath}
+	}
+
+	return nil
+}
+
 // Move moves an object stored at sourcePath to destPath, removing the original
 // object.
 func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
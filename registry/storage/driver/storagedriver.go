@@ -84,6 +84,30 @@ type StorageDriver interface {
 	URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error)
 }
 
+// RecursiveLister is an optional interface of StorageDriver implementations
+// able to enumerate every file below a path in a single operation, such as a
+// prefix listing on object stores, instead of one List call per directory.
+type RecursiveLister interface {
+	// ListRecursive calls f with the FileInfo of each file, but not
+	// directory, stored below the given path, in lexical order of their
+	// paths: the files below any directory are listed contiguously. An error
+	// returned by f stops the listing and is returned as is.
+	// May return an ErrUnsupportedMethod, before calling f, in certain
+	// StorageDriver implementations.
+	ListRecursive(ctx context.Context, path string, f func(FileInfo) error) error
+}
+
+// PagedLister is an optional interface of StorageDriver implementations able
+// to list part of a directory, such as a listing from a marker on object
+// stores, instead of every direct descendant at once.
+type PagedLister interface {
+	// ListFrom returns, in lexical order, at most n of the direct
+	// descendants of the given path whose base name lexically follows last.
+	// All descendants are eligible when last is empty. May return an
+	// ErrUnsupportedMethod in certain StorageDriver implementations.
+	ListFrom(ctx context.Context, path string, last string, n int) ([]string, error)
+}
+
 // PathRegexp is the regular expression which each file path must match. A
 // file path is absolute, beginning with a slash and containing a positive
 // number of path components separated by slashes, where each component is
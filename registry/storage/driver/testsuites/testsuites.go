@@ -3,6 +3,7 @@ package testsuites
 import (
 	"bytes"
 	"crypto/sha1"
+	"errors"
 	"io"
 	"io/ioutil"
 	"math/rand"
@@ -527,6 +528,162 @@ func (suite *DriverSuite) TestList(c *check.C) {
 	// 3. Ensure that we only respond to directory listings that end with a slash (maybe?).
 }
 
+// TestListRecursive checks the files listed by drivers implementing
+// storagedriver.RecursiveLister after populating a directory tree.
+func (suite *DriverSuite) TestListRecursive(c *check.C) {
+	lister, ok := suite.StorageDriver.(storagedriver.RecursiveLister)
+	if !ok {
+		c.Skip("driver does not implement ListRecursive")
+	}
+
+	rootDirectory := "/" + randomFilename(int64(8+rand.Intn(8)))
+	defer suite.deletePath(c, rootDirectory)
+
+	doesnotexist := path.Join(rootDirectory, "nonexistent")
+	err := lister.ListRecursive(suite.ctx, doesnotexist, func(storagedriver.FileInfo) error {
+		return nil
+	})
+	if _, ok := err.(storagedriver.ErrUnsupportedMethod); ok {
+		c.Skip("driver does not support ListRecursive")
+	}
+	c.Assert(err, check.Equals, storagedriver.PathNotFoundError{
+		Path:       doesnotexist,
+		DriverName: suite.StorageDriver.Name(),
+	})
+
+	files := make(map[string]int64)
+	for i := 0; i < 5; i++ {
+		directory := rootDirectory + "/" + randomFilename(int64(8+rand.Intn(8)))
+		for j := 0; j < 5; j++ {
+			file := directory
+			for depth := rand.Intn(3); depth >= 0; depth-- {
+				file += "/" + randomFilename(int64(8+rand.Intn(8)))
+			}
+
+			contents := randomContents(int64(1 + rand.Intn(64)))
+			err := suite.StorageDriver.PutContent(suite.ctx, file, contents)
+			c.Assert(err, check.IsNil)
+			files[file] = int64(len(contents))
+		}
+	}
+
+	// Directories whose names are prefixes of their siblings' come after
+	// them in lexical order of the paths.
+	for _, file := range []string{"/a/b", "/a-b/c", "/a.b/d"} {
+		contents := randomContents(int64(1 + rand.Intn(64)))
+		err := suite.StorageDriver.PutContent(suite.ctx, rootDirectory+file, contents)
+		c.Assert(err, check.IsNil)
+		files[rootDirectory+file] = int64(len(contents))
+	}
+
+	var (
+		listed   []string
+		left     = make(map[string]bool) // directories whose files were all listed
+		previous string
+	)
+	err = lister.ListRecursive(suite.ctx, rootDirectory, func(fi storagedriver.FileInfo) error {
+		c.Assert(fi.IsDir(), check.Equals, false)
+
+		size, ok := files[fi.Path()]
+		c.Assert(ok, check.Equals, true)
+		c.Assert(fi.Size(), check.Equals, size)
+
+		// The files of a directory are listed contiguously.
+		dir := path.Dir(fi.Path())
+		if previous != "" {
+			for d := previous; d != rootDirectory; d = path.Dir(d) {
+				if d != dir && !strings.HasPrefix(dir, d+"/") {
+					left[d] = true
+				}
+			}
+		}
+		for d := dir; d != rootDirectory; d = path.Dir(d) {
+			c.Assert(left[d], check.Equals, false)
+		}
+		previous = dir
+
+		listed = append(listed, fi.Path())
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(len(listed), check.Equals, len(files))
+	c.Assert(sort.StringsAreSorted(listed), check.Equals, true)
+
+	// An error returned by f stops the listing and is returned as is.
+	errStop := errors.New("stop")
+	calls := 0
+	err = lister.ListRecursive(suite.ctx, rootDirectory, func(storagedriver.FileInfo) error {
+		calls++
+		return errStop
+	})
+	c.Assert(err, check.Equals, errStop)
+	c.Assert(calls, check.Equals, 1)
+}
+
+// TestListFrom checks that drivers implementing storagedriver.PagedLister
+// list a directory page by page in lexical order, including directories
+// whose names are prefixes of their siblings.
+func (suite *DriverSuite) TestListFrom(c *check.C) {
+	lister, ok := suite.StorageDriver.(storagedriver.PagedLister)
+	if !ok {
+		c.Skip("driver does not implement ListFrom")
+	}
+
+	rootDirectory := "/" + randomFilename(int64(8+rand.Intn(8)))
+	defer suite.deletePath(c, rootDirectory)
+
+	doesnotexist := path.Join(rootDirectory, "nonexistent")
+	_, err := lister.ListFrom(suite.ctx, doesnotexist, "", 10)
+	if _, ok := err.(storagedriver.ErrUnsupportedMethod); ok {
+		c.Skip("driver does not support ListFrom")
+	}
+	c.Assert(err, check.Equals, storagedriver.PathNotFoundError{
+		Path:       doesnotexist,
+		DriverName: suite.StorageDriver.Name(),
+	})
+
+	names := []string{"a", "a-b", "a.b", "a.b-c", "a0", "b", "b-a", "c"}
+	for _, name := range names {
+		// Every other entry is a directory.
+		file := path.Join(rootDirectory, name)
+		if len(name)%2 == 1 {
+			file = path.Join(file, "link")
+		}
+
+		err := suite.StorageDriver.PutContent(suite.ctx, file, randomContents(8))
+		c.Assert(err, check.IsNil)
+	}
+	sort.Strings(names)
+
+	for _, pageSize := range []int{1, 2, 3, len(names)} {
+		var listed []string
+		last := ""
+		for {
+			entries, err := lister.ListFrom(suite.ctx, rootDirectory, last, pageSize)
+			c.Assert(err, check.IsNil)
+			c.Assert(len(entries) <= pageSize, check.Equals, true)
+			if len(entries) == 0 {
+				break
+			}
+
+			for _, entry := range entries {
+				c.Assert(path.Dir(entry), check.Equals, rootDirectory)
+				listed = append(listed, path.Base(entry))
+			}
+			last = listed[len(listed)-1]
+		}
+		c.Assert(listed, check.DeepEquals, names)
+	}
+
+	entries, err := lister.ListFrom(suite.ctx, rootDirectory, "a.a", 3)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.DeepEquals, []string{
+		path.Join(rootDirectory, "a.b"),
+		path.Join(rootDirectory, "a.b-c"),
+		path.Join(rootDirectory, "a0"),
+	})
+}
+
 // TestMove checks that a moved object no longer exists at the source path and
 // does exist at the destination.
 func (suite *DriverSuite) TestMove(c *check.C) {
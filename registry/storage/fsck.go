@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// FsckOpts contains options for the storage integrity checker.
+type FsckOpts struct {
+	// Verify re-hashes the data of every blob in the blob store and
+	// reports blobs whose content does not match their digest.
+	Verify bool
+
+	// Repair removes dangling layer links, manifest revision links,
+	// signature links and tags. Corrupt blob data and manifests referencing
+	// missing blobs are only reported.
+	Repair bool
+}
+
+// FsckProblem describes an inconsistency found in storage.
+type FsckProblem struct {
+	// Repository is the name of the affected repository. It is empty for
+	// problems with blob data.
+	Repository string
+
+	// Path is the storage path of the affected link, tag or blob.
+	Path string
+
+	// Description explains the problem.
+	Description string
+
+	// Repaired is true if Path was removed from storage.
+	Repaired bool
+}
+
+func (p FsckProblem) String() string {
+	msg := p.Description
+	if p.Repository != "" {
+		msg = p.Repository + ": " + msg
+	}
+	if p.Repaired {
+		msg += " (removed)"
+	}
+	return msg
+}
+
+// Fsck checks the consistency of the storage layout described in paths.go.
+// It reports layer links, manifest revision links and signature links
+// pointing at missing blobs, tags whose current link points at a revision
+// which is not in the repository, and manifests referencing blobs which are
+// absent from the blob store.
+//
+// Repairing removes the dangling links found and must not race with pushes,
+// as a blob being uploaded may be linked before its data is visible to the
+// checker.
+func Fsck(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts FsckOpts) ([]FsckProblem, error) {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	checker := &fsckChecker{
+		ctx:       ctx,
+		driver:    storageDriver,
+		blobStore: &blobStore{driver: storageDriver},
+		present:   make(map[digest.Digest]bool),
+	}
+
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		emit(repoName)
+		return checker.checkRepository(registry, repoName)
+	})
+	if err != nil {
+		return checker.problems, fmt.Errorf("failed to check repositories: %v", err)
+	}
+
+	if opts.Verify {
+		err = checker.blobStore.Enumerate(ctx, func(dgst digest.Digest) error {
+			return checker.verifyBlob(dgst)
+		})
+		if err != nil {
+			return checker.problems, fmt.Errorf("failed to verify blobs: %v", err)
+		}
+	}
+
+	if opts.Repair {
+		usage := newUsageTracker(storageDriver, nil)
+		for i, problem := range checker.problems {
+			if !checker.repairable[i] {
+				continue
+			}
+
+			if err := storageDriver.Delete(ctx, problem.Path); err != nil {
+				if _, ok := err.(driver.PathNotFoundError); !ok {
+					return checker.problems, fmt.Errorf("failed to remove %s: %v", problem.Path, err)
+				}
+			}
+			checker.problems[i].Repaired = true
+
+			// Removed links may have been accounted for.
+			usage.invalidate(ctx, problem.Repository)
+		}
+	}
+
+	return checker.problems, nil
+}
+
+// fsckChecker accumulates the problems found by Fsck.
+type fsckChecker struct {
+	ctx       context.Context
+	driver    driver.StorageDriver
+	blobStore *blobStore
+
+	// present caches the existence of blob data by digest.
+	present map[digest.Digest]bool
+
+	problems   []FsckProblem
+	repairable []bool
+}
+
+func (fc *fsckChecker) report(repoName, p string, repairable bool, format string, a ...interface{}) {
+	problem := FsckProblem{
+		Repository:  repoName,
+		Path:        p,
+		Description: fmt.Sprintf(format, a...),
+	}
+	emit("%v", problem)
+
+	fc.problems = append(fc.problems, problem)
+	fc.repairable = append(fc.repairable, repairable)
+}
+
+// blobExists reports whether the data of the blob identified by dgst is
+// present in the blob store.
+func (fc *fsckChecker) blobExists(dgst digest.Digest) (bool, error) {
+	if present, ok := fc.present[dgst]; ok {
+		return present, nil
+	}
+
+	blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return false, err
+	}
+
+	present, err := exists(fc.ctx, fc.driver, blobPath)
+	if err != nil {
+		return false, err
+	}
+
+	fc.present[dgst] = present
+	return present, nil
+}
+
+func (fc *fsckChecker) checkRepository(registry distribution.Namespace, repoName string) error {
+	layersPath, err := pathFor(layersPathSpec{name: repoName})
+	if err != nil {
+		return err
+	}
+
+	err = fc.walkLinks(repoName, layersPath, func(linkPath string, dgst digest.Digest) error {
+		present, err := fc.blobExists(dgst)
+		if err != nil || present {
+			return err
+		}
+
+		fc.report(repoName, linkPath, true, "layer link %s points at missing blob", dgst)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	manifestService, err := manifestServiceFor(fc.ctx, registry, repoName)
+	if err != nil {
+		return err
+	}
+
+	revisionsPath, err := pathFor(manifestRevisionsPathSpec{name: repoName})
+	if err != nil {
+		return err
+	}
+
+	revisions := make(map[digest.Digest]struct{})
+	err = fc.walkLinks(repoName, revisionsPath, func(linkPath string, dgst digest.Digest) error {
+		isSignature := strings.Contains(linkPath[len(revisionsPath):], "/signatures/")
+
+		present, err := fc.blobExists(dgst)
+		if err != nil {
+			return err
+		}
+
+		if !present {
+			if isSignature {
+				fc.report(repoName, linkPath, true, "signature link %s points at missing blob", dgst)
+			} else {
+				fc.report(repoName, linkPath, true, "manifest revision link %s points at missing blob", dgst)
+			}
+			return nil
+		}
+
+		if isSignature {
+			return nil
+		}
+
+		revisions[dgst] = struct{}{}
+		return fc.checkManifest(repoName, manifestService, dgst)
+	})
+	if err != nil {
+		return err
+	}
+
+	return fc.checkTags(repoName, revisions)
+}
+
+// checkManifest reports the blobs referenced by the manifest identified by
+// dgst which are missing from the blob store.
+func (fc *fsckChecker) checkManifest(repoName string, manifestService distribution.ManifestService, dgst digest.Digest) error {
+	manifest, err := manifestService.Get(fc.ctx, dgst)
+	if err != nil {
+		p, _ := pathFor(blobDataPathSpec{digest: dgst})
+		fc.report(repoName, p, false, "manifest %s cannot be read: %v", dgst, err)
+		return nil
+	}
+
+	references := append([]distribution.Descriptor{}, manifest.References()...)
+	if m, ok := manifest.(*schema2.DeserializedManifest); ok {
+		references = append(references, m.Config)
+	}
+
+	for _, descriptor := range references {
+		present, err := fc.blobExists(descriptor.Digest)
+		if err != nil {
+			return err
+		}
+		if !present {
+			p, _ := pathFor(blobDataPathSpec{digest: descriptor.Digest})
+			fc.report(repoName, p, false, "manifest %s references missing blob %s", dgst, descriptor.Digest)
+		}
+	}
+
+	return nil
+}
+
+// checkTags reports the tags whose current link points at a revision which
+// is not in revisions.
+func (fc *fsckChecker) checkTags(repoName string, revisions map[digest.Digest]struct{}) error {
+	tagsPath, err := pathFor(manifestTagsPathSpec{name: repoName})
+	if err != nil {
+		return err
+	}
+
+	entries, err := fc.driver.List(fc.ctx, tagsPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		tag := path.Base(entry)
+
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{name: repoName, tag: tag})
+		if err != nil {
+			return err
+		}
+
+		content, err := fc.driver.GetContent(fc.ctx, currentPath)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				fc.report(repoName, entry, true, "tag %s has no current link", tag)
+				continue
+			}
+			return err
+		}
+
+		dgst, err := digest.ParseDigest(string(content))
+		if err != nil {
+			fc.report(repoName, entry, true, "tag %s has an invalid current link: %v", tag, err)
+			continue
+		}
+
+		if _, ok := revisions[dgst]; !ok {
+			fc.report(repoName, entry, true, "tag %s points at missing revision %s", tag, dgst)
+		}
+	}
+
+	return nil
+}
+
+// walkLinks calls fn with the path and digest of each link file found under
+// root. Links which cannot be parsed are reported as problems.
+func (fc *fsckChecker) walkLinks(repoName, root string, fn func(linkPath string, dgst digest.Digest) error) error {
+	err := walkAll(fc.ctx, fc.driver, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		content, err := fc.driver.GetContent(fc.ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		dgst, err := digest.ParseDigest(string(content))
+		if err != nil {
+			fc.report(repoName, fileInfo.Path(), true, "link %s is invalid: %v", fileInfo.Path(), err)
+			return nil
+		}
+
+		return fn(fileInfo.Path(), dgst)
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// verifyBlob re-hashes the data of the blob identified by dgst.
+func (fc *fsckChecker) verifyBlob(dgst digest.Digest) error {
+	blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return err
+	}
+
+	verifier, err := digest.NewDigestVerifier(dgst)
+	if err != nil {
+		fc.report("", blobPath, false, "blob %s cannot be verified: %v", dgst, err)
+		return nil
+	}
+
+	reader, err := fc.driver.ReadStream(fc.ctx, blobPath, 0)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(verifier, reader); err != nil {
+		return err
+	}
+
+	if !verifier.Verified() {
+		fc.report("", blobPath, false, "blob %s does not match its digest", dgst)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/digest"
+)
+
+func checkFsck(t *testing.T, env *gcTestEnv, opts FsckOpts, expected ...string) []FsckProblem {
+	problems, err := Fsck(env.ctx, env.driver, env.registry, opts)
+	if err != nil {
+		t.Fatalf("unexpected error checking storage: %v", err)
+	}
+
+	if len(problems) != len(expected) {
+		t.Fatalf("unexpected problems: %v != %v", problems, expected)
+	}
+
+	for i, problem := range problems {
+		if !strings.Contains(problem.String(), expected[i]) {
+			t.Fatalf("unexpected problem %d: %q does not contain %q", i, problem, expected[i])
+		}
+	}
+
+	return problems
+}
+
+func TestFsckNoop(t *testing.T) {
+	env := newGCTestEnv(t)
+	checkFsck(t, env, FsckOpts{Verify: true})
+
+	repo := env.repository(t, "foo/bar")
+	dgst, _ := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 2))
+	tagManifest(t, env, repo, "latest", dgst)
+
+	checkFsck(t, env, FsckOpts{Verify: true})
+}
+
+func TestFsck(t *testing.T) {
+	env := newGCTestEnv(t)
+
+	intact := env.repository(t, "foo/intact")
+	intactLayers := uploadRandomLayers(t, intact, 2)
+	intactManifest, _ := uploadSchema2Manifest(t, intact, intactLayers)
+	tagManifest(t, env, intact, "latest", intactManifest)
+
+	broken := env.repository(t, "foo/broken")
+	brokenLayers := uploadRandomLayers(t, broken, 2)
+	brokenManifest, _ := uploadSchema2Manifest(t, broken, brokenLayers)
+	tagManifest(t, env, broken, "latest", brokenManifest)
+
+	// Point a tag at a revision which was never pushed
+	missing := digest.FromBytes([]byte("missing"))
+	currentPath, err := pathFor(manifestTagCurrentPathSpec{name: "foo/broken", tag: "gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.driver.PutContent(env.ctx, currentPath, []byte(missing)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lose the data of a layer
+	lostPath, err := pathFor(blobDataPathSpec{digest: brokenLayers[0].Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.driver.Delete(env.ctx, lostPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the data of another
+	corruptPath, err := pathFor(blobDataPathSpec{digest: intactLayers[0].Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.driver.PutContent(env.ctx, corruptPath, []byte("corrupt")); err != nil {
+		t.Fatal(err)
+	}
+
+	layerLink := "layer link " + brokenLayers[0].Digest.String() + " points at missing blob"
+	manifestRef := "references missing blob " + brokenLayers[0].Digest.String()
+	danglingTag := "tag gone points at missing revision " + missing.String()
+	mismatch := "blob " + intactLayers[0].Digest.String() + " does not match its digest"
+
+	checkFsck(t, env, FsckOpts{}, layerLink, manifestRef, danglingTag)
+	checkFsck(t, env, FsckOpts{Verify: true}, layerLink, manifestRef, danglingTag, mismatch)
+
+	problems := checkFsck(t, env, FsckOpts{Repair: true}, layerLink, manifestRef, danglingTag)
+	for i, repaired := range []bool{true, false, true} {
+		if problems[i].Repaired != repaired {
+			t.Fatalf("unexpected repair state of %q: %v", problems[i], problems[i].Repaired)
+		}
+	}
+
+	checkFsck(t, env, FsckOpts{}, manifestRef)
+	checkTags(t, env, broken, "latest")
+}
@@ -0,0 +1,549 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+func emit(format string, a ...interface{}) {
+	fmt.Printf(format+"\n", a...)
+}
+
+// GCOpts contains options for the garbage collector.
+type GCOpts struct {
+	// DryRun prints the blobs eligible for deletion without removing
+	// anything from storage.
+	DryRun bool
+
+	// GracePeriod enables online garbage collection, which is safe to run
+	// while the registry accepts pushes. Blobs written, or linked into a
+	// repository, within the grace period before the collection started are
+	// never swept. The period should comfortably exceed the time taken by
+	// the longest blob upload and by the collection itself.
+	GracePeriod time.Duration
+}
+
+// MarkAndSweep performs a mark and sweep of registry data. Every blob
+// reachable from a manifest revision in any repository is marked: the
+// manifest itself, its layers, the schema2 config, the schema1 signatures
+// and the children of manifest lists. All other blobs in the blob store are
+// removed through Vacuum.
+//
+// Without a grace period, the registry must not accept writes while this
+// runs, as blobs uploaded during the mark phase would not be marked and
+// hence be swept. See GCOpts.GracePeriod for collecting a live registry.
+func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) error {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	// Anything modified after cutoff may belong to a push which is still in
+	// progress and is left alone in online mode.
+	cutoff := time.Now().Add(-opts.GracePeriod)
+
+	// mark
+	markSet, err := markReferencedBlobs(ctx, repositoryEnumerator, registry)
+	if err != nil {
+		return err
+	}
+
+	if opts.GracePeriod > 0 && !opts.DryRun {
+		if err := restoreFencedBlobs(ctx, storageDriver); err != nil {
+			return err
+		}
+	}
+
+	// sweep
+	blobService := &blobStore{driver: storageDriver}
+	deleteSet := make(map[digest.Digest]struct{})
+	err = blobService.Enumerate(ctx, func(dgst digest.Digest) error {
+		// check if digest is in markSet. If not, delete it!
+		if _, ok := markSet[dgst]; ok {
+			return nil
+		}
+
+		if opts.GracePeriod > 0 {
+			recent, err := modifiedAfter(ctx, storageDriver, blobDataPathSpec{digest: dgst}, cutoff)
+			if err != nil {
+				return err
+			}
+			if recent {
+				emit("blob %s written within grace period, skipping", dgst)
+				return nil
+			}
+		}
+
+		deleteSet[dgst] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error enumerating blobs: %v", err)
+	}
+
+	if opts.GracePeriod == 0 {
+		emit("\n%d blobs marked, %d blobs eligible for deletion", len(markSet), len(deleteSet))
+		return sweepCandidates(ctx, storageDriver, deleteSet, opts.DryRun)
+	}
+
+	unlinked, err := fenceCandidates(ctx, storageDriver, repositoryEnumerator, deleteSet, cutoff, opts.DryRun)
+	if err != nil {
+		return err
+	}
+
+	emit("\n%d blobs marked, %d blobs eligible for deletion", len(markSet), len(deleteSet))
+
+	if opts.DryRun {
+		return sweepCandidates(ctx, storageDriver, deleteSet, true)
+	}
+	return sweepFencedCandidates(ctx, storageDriver, repositoryEnumerator, registry, deleteSet, unlinked, cutoff)
+}
+
+// sweepCandidates removes the blobs in deleteSet, which must not be linked
+// again while they are removed.
+func sweepCandidates(ctx context.Context, storageDriver driver.StorageDriver, deleteSet map[digest.Digest]struct{}, dryRun bool) error {
+	vacuum := NewVacuum(ctx, storageDriver)
+	for dgst := range deleteSet {
+		if dryRun {
+			emit("blob eligible for deletion: %s", dgst)
+			continue
+		}
+
+		if err := vacuum.RemoveBlob(string(dgst)); err != nil {
+			return fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+		}
+	}
+
+	return nil
+}
+
+// markReferencedBlobs walks every manifest revision of every repository and
+// returns the set of blob digests which they reference.
+func markReferencedBlobs(ctx context.Context, repositoryEnumerator distribution.RepositoryEnumerator, registry distribution.Namespace) (map[digest.Digest]struct{}, error) {
+	markSet := make(map[digest.Digest]struct{})
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		emit(repoName)
+
+		manifestService, err := manifestServiceFor(ctx, registry, repoName)
+		if err != nil {
+			return err
+		}
+
+		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+		}
+
+		return manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+			return markManifest(ctx, repoName, manifestService, dgst, markSet)
+		})
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark: %v", err)
+	}
+
+	return markSet, nil
+}
+
+// markManifest adds the manifest identified by dgst and every blob it
+// references to markSet.
+func markManifest(ctx context.Context, repoName string, manifestService distribution.ManifestService, dgst digest.Digest, markSet map[digest.Digest]struct{}) error {
+	// Mark the manifest's blob
+	emit("%s: marking manifest %s ", repoName, dgst)
+	markSet[dgst] = struct{}{}
+
+	manifest, err := manifestService.Get(ctx, dgst)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+	}
+
+	descriptors := manifest.References()
+	for _, descriptor := range descriptors {
+		markSet[descriptor.Digest] = struct{}{}
+		emit("%s: marking blob %s", repoName, descriptor.Digest)
+	}
+
+	switch manifest.(type) {
+	case *schema1.SignedManifest:
+		signaturesGetter, ok := manifestService.(distribution.SignaturesGetter)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService into SignaturesGetter")
+		}
+		signatures, err := signaturesGetter.GetSignatures(ctx, dgst)
+		if err != nil {
+			return fmt.Errorf("failed to get signatures for signed manifest: %v", err)
+		}
+		for _, signatureDigest := range signatures {
+			emit("%s: marking signature %s", repoName, signatureDigest)
+			markSet[signatureDigest] = struct{}{}
+		}
+	case *schema2.DeserializedManifest:
+		config := manifest.(*schema2.DeserializedManifest).Config
+		emit("%s: marking configuration %s", repoName, config.Digest)
+		markSet[config.Digest] = struct{}{}
+	}
+
+	return nil
+}
+
+// fenceCandidates makes the blobs in deleteSet unavailable to new pushes
+// before they are swept. A candidate still linked into a repository within
+// the grace period is spared. Otherwise its repository links are removed, so
+// that a manifest put referencing it fails verification instead of producing
+// a broken image. The links removed are returned by repository.
+func fenceCandidates(ctx context.Context, storageDriver driver.StorageDriver, repositoryEnumerator distribution.RepositoryEnumerator, deleteSet map[digest.Digest]struct{}, cutoff time.Time, dryRun bool) (map[string]map[digest.Digest]struct{}, error) {
+	// Find the repository links of every candidate.
+	links := make(map[string][]digest.Digest)
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		layersPath, err := pathFor(layersPathSpec{name: repoName})
+		if err != nil {
+			return err
+		}
+
+		return walkLinks(ctx, storageDriver, layersPath, func(fileInfo driver.FileInfo, dgst digest.Digest) error {
+			if _, ok := deleteSet[dgst]; !ok {
+				return nil
+			}
+
+			if fileInfo.ModTime().After(cutoff) {
+				emit("%s: blob %s linked within grace period, skipping", repoName, dgst)
+				delete(deleteSet, dgst)
+				return nil
+			}
+
+			links[repoName] = append(links[repoName], dgst)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find links to unreferenced blobs: %v", err)
+	}
+
+	// Unlink the remaining candidates. The usage records of the repositories
+	// are counted again when next needed.
+	usage := newUsageTracker(storageDriver, nil)
+	unlinked := make(map[string]map[digest.Digest]struct{})
+	for repoName, dgsts := range links {
+		unlinked[repoName] = make(map[digest.Digest]struct{})
+		for _, dgst := range dgsts {
+			if _, ok := deleteSet[dgst]; !ok {
+				continue // spared by a recent link in another repository
+			}
+
+			emit("%s: unlinking blob %s", repoName, dgst)
+			if dryRun {
+				continue
+			}
+
+			linkPath, err := pathFor(layerLinkPathSpec{name: repoName, digest: dgst})
+			if err != nil {
+				return nil, err
+			}
+			if err := storageDriver.Delete(ctx, linkPath); err != nil {
+				if _, ok := err.(driver.PathNotFoundError); !ok {
+					return nil, fmt.Errorf("failed to unlink blob %s from %s: %v", dgst, repoName, err)
+				}
+			}
+			unlinked[repoName][dgst] = struct{}{}
+		}
+
+		if len(unlinked[repoName]) > 0 {
+			usage.invalidate(ctx, repoName)
+		}
+	}
+
+	return unlinked, nil
+}
+
+// sweepFencedCandidates removes the blobs in deleteSet while the registry
+// accepts pushes. The data of every candidate is first moved aside, after
+// which the repositories are searched for links to the candidates and for
+// manifests whose revision was linked after cutoff. The candidates found,
+// and those referenced by such manifests, are spared: their data is moved
+// back and any layer link removed by fenceCandidates is restored. The data
+// of the others is removed.
+//
+// Linking a blob, or putting a manifest, checks that the data of the blobs
+// involved is present once linked, and fails otherwise. A push racing with
+// the collection is thus either seen by the search and spared, or finds the
+// data moved aside and fails, so that the client pushes the blob again.
+func sweepFencedCandidates(ctx context.Context, storageDriver driver.StorageDriver, repositoryEnumerator distribution.RepositoryEnumerator, registry distribution.Namespace, deleteSet map[digest.Digest]struct{}, unlinked map[string]map[digest.Digest]struct{}, cutoff time.Time) (err error) {
+	// Data left aside on failure is restored, or else by the next run.
+	defer func() {
+		if err == nil {
+			return
+		}
+		for dgst := range deleteSet {
+			if err := moveBlobData(ctx, storageDriver, blobFencedPathSpec{digest: dgst}, blobDataPathSpec{digest: dgst}); err != nil {
+				context.GetLogger(ctx).Errorf("failed to restore blob %s: %v", dgst, err)
+			}
+		}
+	}()
+
+	for dgst := range deleteSet {
+		if err := moveBlobData(ctx, storageDriver, blobDataPathSpec{digest: dgst}, blobFencedPathSpec{digest: dgst}); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				delete(deleteSet, dgst) // already removed
+				continue
+			}
+			return fmt.Errorf("failed to fence blob %s: %v", dgst, err)
+		}
+	}
+
+	spared := make(map[digest.Digest]struct{})
+	relinks := make(map[string][]digest.Digest)
+	err = repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		layersPath, err := pathFor(layersPathSpec{name: repoName})
+		if err != nil {
+			return err
+		}
+		revisionsPath, err := pathFor(manifestRevisionsPathSpec{name: repoName})
+		if err != nil {
+			return err
+		}
+
+		// Manifests are read once their data is restored.
+		var late []digest.Digest
+		for _, root := range []string{layersPath, revisionsPath} {
+			err := walkLinks(ctx, storageDriver, root, func(fileInfo driver.FileInfo, dgst digest.Digest) error {
+				if _, ok := deleteSet[dgst]; ok {
+					emit("%s: blob %s linked during collection, skipping", repoName, dgst)
+					spared[dgst] = struct{}{}
+				}
+
+				if root == revisionsPath && fileInfo.ModTime().After(cutoff) && !strings.Contains(fileInfo.Path()[len(root):], "/signatures/") {
+					late = append(late, dgst)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(late) > 0 {
+			relinks[repoName] = late
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find links to fenced blobs: %v", err)
+	}
+
+	restore := func(dgst digest.Digest) error {
+		if err := moveBlobData(ctx, storageDriver, blobFencedPathSpec{digest: dgst}, blobDataPathSpec{digest: dgst}); err != nil {
+			return fmt.Errorf("failed to restore blob %s: %v", dgst, err)
+		}
+		delete(deleteSet, dgst)
+		return nil
+	}
+
+	for dgst := range spared {
+		if err := restore(dgst); err != nil {
+			return err
+		}
+	}
+
+	// Spare the blobs referenced by manifests put while the collection was
+	// running, linking them back into the repository if they were unlinked.
+	for repoName, manifests := range relinks {
+		manifestService, err := manifestServiceFor(ctx, registry, repoName)
+		if err != nil {
+			return err
+		}
+
+		lateSet := make(map[digest.Digest]struct{})
+		for _, dgst := range manifests {
+			if err := markManifest(ctx, repoName, manifestService, dgst, lateSet); err != nil {
+				// The revision may have been taken back by a failed put.
+				revisionPath, pathErr := manifestRevisionLinkPath(repoName, dgst)
+				if pathErr != nil {
+					return pathErr
+				}
+				if ok, existsErr := exists(ctx, storageDriver, revisionPath); existsErr != nil || ok {
+					return err
+				}
+			}
+		}
+
+		for dgst := range lateSet {
+			if _, ok := deleteSet[dgst]; ok {
+				emit("%s: blob %s referenced by a recent manifest, skipping", repoName, dgst)
+				if err := restore(dgst); err != nil {
+					return err
+				}
+			}
+
+			if _, ok := unlinked[repoName][dgst]; ok {
+				linkPath, err := pathFor(layerLinkPathSpec{name: repoName, digest: dgst})
+				if err != nil {
+					return err
+				}
+				if err := storageDriver.PutContent(ctx, linkPath, []byte(dgst)); err != nil {
+					return fmt.Errorf("failed to relink blob %s into %s: %v", dgst, repoName, err)
+				}
+			}
+		}
+	}
+
+	for dgst := range deleteSet {
+		if err := removeFencedBlob(ctx, storageDriver, dgst); err != nil {
+			return fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreFencedBlobs moves back the data of blobs left aside by an
+// interrupted collection. The data may have been pushed again since, in
+// which case the fenced copy is removed.
+func restoreFencedBlobs(ctx context.Context, storageDriver driver.StorageDriver) error {
+	root, err := pathFor(blobsPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	err = walkAll(ctx, storageDriver, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "fenced" {
+			return nil
+		}
+
+		dgst, err := digestFromPath(path.Join(path.Dir(fileInfo.Path()), "data"))
+		if err != nil {
+			return err
+		}
+
+		emit("restoring fenced blob %s", dgst)
+		return moveBlobData(ctx, storageDriver, blobFencedPathSpec{digest: dgst}, blobDataPathSpec{digest: dgst})
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore fenced blobs: %v", err)
+	}
+	return nil
+}
+
+// moveBlobData moves the blob data at from to to. The data is content
+// addressed, so any data already at to is identical and overwritten.
+func moveBlobData(ctx context.Context, storageDriver driver.StorageDriver, from, to pathSpec) error {
+	fromPath, err := pathFor(from)
+	if err != nil {
+		return err
+	}
+	toPath, err := pathFor(to)
+	if err != nil {
+		return err
+	}
+
+	return storageDriver.Move(ctx, fromPath, toPath)
+}
+
+// removeFencedBlob removes the data of a blob moved aside by
+// sweepFencedCandidates, along with its referrer index entries. Data pushed
+// again since is left in place.
+func removeFencedBlob(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest) error {
+	fencedPath, err := pathFor(blobFencedPathSpec{digest: dgst})
+	if err != nil {
+		return err
+	}
+	context.GetLogger(ctx).Infof("Deleting blob: %s", fencedPath)
+	if err := storageDriver.Delete(ctx, fencedPath); err != nil {
+		return err
+	}
+
+	// Index entries of data pushed again since are kept.
+	dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return err
+	}
+	pushed, err := exists(ctx, storageDriver, dataPath)
+	if err != nil || pushed {
+		return err
+	}
+
+	referrersPath, err := pathFor(referrersPathSpec{digest: dgst})
+	if err != nil {
+		return err
+	}
+	if err := storageDriver.Delete(ctx, referrersPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkLinks calls fn with the file info and digest of each link file found
+// under root, reading the digest from the path of the link.
+func walkLinks(ctx context.Context, storageDriver driver.StorageDriver, root string, fn func(fileInfo driver.FileInfo, dgst digest.Digest) error) error {
+	err := walkAll(ctx, storageDriver, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		dir := path.Dir(fileInfo.Path())
+		dgst := digest.NewDigestFromHex(path.Base(path.Dir(dir)), path.Base(dir))
+		if err := dgst.Validate(); err != nil {
+			return nil // not a blob link
+		}
+
+		return fn(fileInfo, dgst)
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// modifiedAfter reports whether the file described by spec was modified
+// after t.
+func modifiedAfter(ctx context.Context, storageDriver driver.StorageDriver, spec pathSpec, t time.Time) (bool, error) {
+	p, err := pathFor(spec)
+	if err != nil {
+		return false, err
+	}
+
+	fi, err := storageDriver.Stat(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return fi.ModTime().After(t), nil
+}
+
+// manifestServiceFor returns the manifest service of the named repository.
+func manifestServiceFor(ctx context.Context, registry distribution.Namespace, repoName string) (distribution.ManifestService, error) {
+	named, err := reference.ParseNamed(repoName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+	}
+
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct repository: %v", err)
+	}
+
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct manifest service: %v", err)
+	}
+
+	return manifestService, nil
+}
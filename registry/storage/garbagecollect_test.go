@@ -0,0 +1,441 @@
+package storage
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/docker/libtrust"
+)
+
+type gcTestEnv struct {
+	ctx      context.Context
+	driver   driver.StorageDriver
+	registry distribution.Namespace
+}
+
+func newGCTestEnv(t *testing.T) *gcTestEnv {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry, err := NewRegistry(ctx, d, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	return &gcTestEnv{
+		ctx:      ctx,
+		driver:   d,
+		registry: registry,
+	}
+}
+
+func (env *gcTestEnv) repository(t *testing.T, name string) distribution.Repository {
+	named, err := reference.ParseNamed(name)
+	if err != nil {
+		t.Fatalf("failed to parse name %s: %v", name, err)
+	}
+
+	repo, err := env.registry.Repository(env.ctx, named)
+	if err != nil {
+		t.Fatalf("failed to construct repository: %v", err)
+	}
+	return repo
+}
+
+// uploadRandomLayers pushes n random layers into the repository, returning
+// their descriptors.
+func uploadRandomLayers(t *testing.T, repo distribution.Repository, n int) []distribution.Descriptor {
+	ctx := context.Background()
+	var descriptors []distribution.Descriptor
+	for i := 0; i < n; i++ {
+		rs, dgst, err := testutil.CreateRandomTarFile()
+		if err != nil {
+			t.Fatalf("unexpected error generating test layer file: %v", err)
+		}
+
+		size, err := seekerSize(rs)
+		if err != nil {
+			t.Fatalf("unexpected error getting layer size: %v", err)
+		}
+
+		desc, err := addBlob(ctx, repo.Blobs(ctx), distribution.Descriptor{Digest: dgst, Size: size}, rs)
+		if err != nil {
+			t.Fatalf("unexpected error uploading layer: %v", err)
+		}
+		descriptors = append(descriptors, desc)
+	}
+
+	return descriptors
+}
+
+func uploadSchema2Manifest(t *testing.T, repo distribution.Repository, layers []distribution.Descriptor) (digest.Digest, *schema2.DeserializedManifest) {
+	ctx := context.Background()
+	builder := schema2.NewManifestBuilder(repo.Blobs(ctx), []byte(`{"architecture": "amd64"}`))
+	for _, layer := range layers {
+		if err := builder.AppendReference(layer); err != nil {
+			t.Fatalf("unexpected error appending reference: %v", err)
+		}
+	}
+
+	m, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest: %v", err)
+	}
+
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+
+	dgst, err := manifests.Put(ctx, m)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	return dgst, m.(*schema2.DeserializedManifest)
+}
+
+func uploadSchema1Manifest(t *testing.T, repo distribution.Repository, layers []distribution.Descriptor) digest.Digest {
+	ctx := context.Background()
+	m := schema1.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name: repo.Name().Name(),
+		Tag:  "latest",
+	}
+	for _, layer := range layers {
+		m.FSLayers = append(m.FSLayers, schema1.FSLayer{BlobSum: layer.Digest})
+		m.History = append(m.History, schema1.History{V1Compatibility: ""})
+	}
+
+	pk, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating private key: %v", err)
+	}
+
+	sm, err := schema1.Sign(&m, pk)
+	if err != nil {
+		t.Fatalf("error signing manifest: %v", err)
+	}
+
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+
+	dgst, err := manifests.Put(ctx, sm)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	return dgst
+}
+
+func allBlobs(t *testing.T, env *gcTestEnv) map[digest.Digest]struct{} {
+	blobs := make(map[digest.Digest]struct{})
+	bs := &blobStore{driver: env.driver}
+	err := bs.Enumerate(env.ctx, func(dgst digest.Digest) error {
+		blobs[dgst] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error enumerating blobs: %v", err)
+	}
+	return blobs
+}
+
+func TestGCNoop(t *testing.T) {
+	env := newGCTestEnv(t)
+	if err := MarkAndSweep(env.ctx, env.driver, env.registry, GCOpts{}); err != nil {
+		t.Fatalf("unexpected error collecting empty registry: %v", err)
+	}
+}
+
+func TestGCUnreferencedLayers(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+
+	layers := uploadRandomLayers(t, repo, 4)
+	_, m := uploadSchema2Manifest(t, repo, layers[:2])
+	orphans := layers[2:]
+
+	// A dry run must leave everything in place.
+	before := allBlobs(t, env)
+	if err := MarkAndSweep(env.ctx, env.driver, env.registry, GCOpts{DryRun: true}); err != nil {
+		t.Fatalf("unexpected error during dry run: %v", err)
+	}
+	if after := allBlobs(t, env); len(after) != len(before) {
+		t.Fatalf("dry run removed blobs: %d != %d", len(after), len(before))
+	}
+
+	if err := MarkAndSweep(env.ctx, env.driver, env.registry, GCOpts{}); err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+
+	blobs := allBlobs(t, env)
+	for _, orphan := range orphans {
+		if _, ok := blobs[orphan.Digest]; ok {
+			t.Errorf("unreferenced layer %s was not removed", orphan.Digest)
+		}
+	}
+
+	for _, layer := range layers[:2] {
+		if _, ok := blobs[layer.Digest]; !ok {
+			t.Errorf("referenced layer %s was removed", layer.Digest)
+		}
+	}
+
+	if _, ok := blobs[m.Config.Digest]; !ok {
+		t.Errorf("config %s was removed", m.Config.Digest)
+	}
+}
+
+func TestGCDeletedManifest(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+	other := env.repository(t, "foo/baz")
+
+	layers := uploadRandomLayers(t, repo, 2)
+	dgst, _ := uploadSchema2Manifest(t, repo, layers)
+
+	// the second layer is also referenced from another repository.
+	otherLayers := uploadRandomLayers(t, other, 1)
+	if _, err := addBlob(env.ctx, other.Blobs(env.ctx), layers[1], mustOpen(t, repo, layers[1].Digest)); err != nil {
+		t.Fatalf("unexpected error linking layer into other repository: %v", err)
+	}
+	uploadSchema2Manifest(t, other, append(otherLayers, layers[1]))
+
+	manifests, err := repo.Manifests(env.ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+	if err := manifests.Delete(env.ctx, dgst); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+
+	if err := MarkAndSweep(env.ctx, env.driver, env.registry, GCOpts{}); err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+
+	blobs := allBlobs(t, env)
+	if _, ok := blobs[dgst]; ok {
+		t.Errorf("deleted manifest %s was not removed", dgst)
+	}
+	if _, ok := blobs[layers[0].Digest]; ok {
+		t.Errorf("layer %s of deleted manifest was not removed", layers[0].Digest)
+	}
+	if _, ok := blobs[layers[1].Digest]; !ok {
+		t.Errorf("layer %s shared with another repository was removed", layers[1].Digest)
+	}
+}
+
+func TestGCSchema1Signatures(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+
+	layers := uploadRandomLayers(t, repo, 1)
+	dgst := uploadSchema1Manifest(t, repo, layers)
+
+	manifests, err := repo.Manifests(env.ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+	signatures, err := manifests.(distribution.SignaturesGetter).GetSignatures(env.ctx, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error getting signatures: %v", err)
+	}
+	if len(signatures) != 1 {
+		t.Fatalf("unexpected number of signatures: %d != 1", len(signatures))
+	}
+
+	if err := MarkAndSweep(env.ctx, env.driver, env.registry, GCOpts{}); err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+
+	blobs := allBlobs(t, env)
+	for _, dgst := range []digest.Digest{dgst, layers[0].Digest, signatures[0]} {
+		if _, ok := blobs[dgst]; !ok {
+			t.Errorf("referenced blob %s was removed", dgst)
+		}
+	}
+
+	// The manifest must still be readable after collection.
+	if _, err := manifests.Get(env.ctx, dgst); err != nil {
+		t.Fatalf("unexpected error fetching manifest after collection: %v", err)
+	}
+}
+
+func TestGCGracePeriod(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+
+	layers := uploadRandomLayers(t, repo, 1)
+
+	// A freshly uploaded blob may belong to a push in progress.
+	if err := MarkAndSweep(env.ctx, env.driver, env.registry, GCOpts{GracePeriod: time.Hour}); err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+	if _, err := repo.Blobs(env.ctx).Stat(env.ctx, layers[0].Digest); err != nil {
+		t.Fatalf("blob within grace period was collected: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := MarkAndSweep(env.ctx, env.driver, env.registry, GCOpts{GracePeriod: time.Millisecond}); err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+	if _, ok := allBlobs(t, env)[layers[0].Digest]; ok {
+		t.Fatalf("blob outside of grace period was not collected")
+	}
+
+	linkPath, err := pathFor(layerLinkPathSpec{name: repo.Name().Name(), digest: layers[0].Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.driver.Stat(env.ctx, linkPath); err == nil {
+		t.Fatalf("link to collected blob was not removed")
+	}
+}
+
+func TestGCFenceRescuesLateManifests(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+
+	layers := uploadRandomLayers(t, repo, 2)
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+
+	// A manifest referencing the first layer arrives after the mark phase.
+	uploadSchema2Manifest(t, repo, layers[:1])
+
+	deleteSet := map[digest.Digest]struct{}{
+		layers[0].Digest: {},
+		layers[1].Digest: {},
+	}
+	enumerator := env.registry.(distribution.RepositoryEnumerator)
+	unlinked, err := fenceCandidates(env.ctx, env.driver, enumerator, deleteSet, cutoff, false)
+	if err != nil {
+		t.Fatalf("unexpected error fencing candidates: %v", err)
+	}
+	if err := sweepFencedCandidates(env.ctx, env.driver, enumerator, env.registry, deleteSet, unlinked, cutoff); err != nil {
+		t.Fatalf("unexpected error sweeping candidates: %v", err)
+	}
+
+	all := allBlobs(t, env)
+	if _, ok := all[layers[0].Digest]; !ok {
+		t.Fatalf("blob referenced by a late manifest was removed")
+	}
+	if _, ok := all[layers[1].Digest]; ok {
+		t.Fatalf("unreferenced blob was not removed")
+	}
+
+	blobs := repo.Blobs(env.ctx)
+	if _, err := blobs.Stat(env.ctx, layers[0].Digest); err != nil {
+		t.Fatalf("blob referenced by a late manifest was not relinked: %v", err)
+	}
+	if _, err := blobs.Stat(env.ctx, layers[1].Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("unreferenced blob was not unlinked: %v", err)
+	}
+}
+
+func TestGCFenceFailsLinking(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+	layers := uploadRandomLayers(t, repo, 1)
+
+	// The collector moved the data aside before a push linked the blob
+	// into another repository.
+	if err := moveBlobData(env.ctx, env.driver, blobDataPathSpec{digest: layers[0].Digest}, blobFencedPathSpec{digest: layers[0].Digest}); err != nil {
+		t.Fatal(err)
+	}
+
+	late := env.repository(t, "foo/late")
+	if err := late.Blobs(env.ctx).(*linkedBlobStore).linkBlob(env.ctx, layers[0]); err != errBlobCollected {
+		t.Fatalf("expected linking a fenced blob to fail, got %v", err)
+	}
+	if linked, err := env.registry.(*registry).linked(env.ctx, "foo/late", layers[0].Digest); err != nil || linked {
+		t.Fatalf("link to fenced blob was kept: %v, %v", linked, err)
+	}
+
+	// An interrupted collection is undone by the next one.
+	if err := MarkAndSweep(env.ctx, env.driver, env.registry, GCOpts{GracePeriod: time.Hour}); err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+	if _, err := repo.Blobs(env.ctx).Stat(env.ctx, layers[0].Digest); err != nil {
+		t.Fatalf("fenced blob was not restored: %v", err)
+	}
+}
+
+func mustOpen(t *testing.T, repo distribution.Repository, dgst digest.Digest) io.Reader {
+	rc, err := repo.Blobs(context.Background()).Open(context.Background(), dgst)
+	if err != nil {
+		t.Fatalf("unexpected error opening blob %s: %v", dgst, err)
+	}
+	return rc
+}
+
+func TestGCSweepSparesRelinkedBlobs(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+
+	shared, err := pushBytes(env.ctx, repo, 'a', 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreferenced, err := pushBytes(env.ctx, repo, 'b', 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+
+	deleteSet := map[digest.Digest]struct{}{
+		shared.Digest:       {},
+		unreferenced.Digest: {},
+	}
+	enumerator := env.registry.(distribution.RepositoryEnumerator)
+	unlinked, err := fenceCandidates(env.ctx, env.driver, enumerator, deleteSet, cutoff, false)
+	if err != nil {
+		t.Fatalf("unexpected error fencing candidates: %v", err)
+	}
+	if len(deleteSet) != 2 {
+		t.Fatalf("unexpected candidates after fencing: %v", deleteSet)
+	}
+
+	// Between the mark and the sweep, the first blob is pushed again into
+	// another repository. Its data is already present, so it stays old.
+	late := env.repository(t, "foo/late")
+	if _, err := pushBytes(env.ctx, late, 'a', 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sweepFencedCandidates(env.ctx, env.driver, enumerator, env.registry, deleteSet, unlinked, cutoff); err != nil {
+		t.Fatalf("unexpected error sweeping candidates: %v", err)
+	}
+
+	blobs := allBlobs(t, env)
+	if _, ok := blobs[shared.Digest]; !ok {
+		t.Fatalf("blob linked after the fence was removed")
+	}
+	if _, ok := blobs[unreferenced.Digest]; ok {
+		t.Fatalf("unreferenced blob was not removed")
+	}
+
+	p, err := late.Blobs(env.ctx).Get(env.ctx, shared.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error reading relinked blob: %v", err)
+	}
+	if len(p) != 100 {
+		t.Fatalf("unexpected content of relinked blob: %d bytes", len(p))
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"path"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+)
+
+// ImmutableTagRule makes the tags matching Tag, in the repositories matching
+// Repository, immutable. Both are patterns in the syntax of path.Match; an
+// empty pattern matches every repository or tag.
+type ImmutableTagRule struct {
+	Repository string
+	Tag        string
+}
+
+// ImmutableTags returns a functional option for NewRegistry. Once created, a
+// tag matching any of the rules may not be moved to a different manifest or
+// deleted, nor may the manifest it refers to be deleted: these fail with
+// distribution.ErrTagImmutable instead. Tagging the manifest a tag already
+// refers to succeeds.
+func ImmutableTags(rules []ImmutableTagRule) RegistryOption {
+	return func(registry *registry) error {
+		for _, rule := range rules {
+			for _, pattern := range []string{rule.Repository, rule.Tag} {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return err
+				}
+			}
+		}
+
+		registry.immutableTags = rules
+		return nil
+	}
+}
+
+// tagImmutable reports whether tag, in the named repository, is subject to
+// an immutable tag rule.
+func (reg *registry) tagImmutable(name, tag string) bool {
+	for _, rule := range reg.immutableTags {
+		if matchPattern(rule.Repository, name) && matchPattern(rule.Tag, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// immutableTag reports whether tag is immutable in repo. Only repositories
+// of this package have immutable tags.
+func immutableTag(repo distribution.Repository, tag string) bool {
+	r, ok := repo.(*repository)
+	return ok && r.tagImmutable(r.Name().Name(), tag)
+}
+
+// checkImmutableReferrers returns distribution.ErrTagImmutable if an
+// immutable tag of the repository refers to the manifest dgst. The tags are
+// only looked up if a rule applies to the repository.
+func (repo *repository) checkImmutableReferrers(ctx context.Context, dgst digest.Digest) error {
+	name := repo.Name().Name()
+
+	applies := false
+	for _, rule := range repo.immutableTags {
+		if matchPattern(rule.Repository, name) {
+			applies = true
+			break
+		}
+	}
+	if !applies {
+		return nil
+	}
+
+	tags, err := repo.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if repo.tagImmutable(name, tag) {
+			return distribution.ErrTagImmutable{Tag: tag, Digest: dgst}
+		}
+	}
+	return nil
+}
+
+// matchPattern reports whether s matches pattern. An empty pattern matches
+// everything.
+func matchPattern(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, s)
+	return matched
+}
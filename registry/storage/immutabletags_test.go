@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestImmutableTags(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry, err := NewRegistry(ctx, d, EnableDelete, ImmutableTags([]ImmutableTagRule{{Repository: "release/*", Tag: "v*"}}))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	env := &gcTestEnv{ctx: ctx, driver: d, registry: registry}
+
+	for _, name := range []string{"release/app", "ci/app"} {
+		repo := env.repository(t, name)
+		first, _ := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 1))
+		second, _ := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 1))
+
+		tags := repo.Tags(ctx)
+		for _, tag := range []string{"v1", "latest"} {
+			if err := tags.Tag(ctx, tag, distribution.Descriptor{Digest: first}); err != nil {
+				t.Fatalf("%s: unexpected error creating tag %s: %v", name, tag, err)
+			}
+
+			// Tagging the same manifest again is allowed
+			if err := tags.Tag(ctx, tag, distribution.Descriptor{Digest: first}); err != nil {
+				t.Fatalf("%s: unexpected error retagging %s: %v", name, tag, err)
+			}
+		}
+
+		if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: second}); err != nil {
+			t.Fatalf("%s: unexpected error moving mutable tag: %v", name, err)
+		}
+
+		err := tags.Tag(ctx, "v1", distribution.Descriptor{Digest: second})
+		if name == "ci/app" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error moving tag: %v", name, err)
+			}
+			continue
+		}
+
+		if immutableErr, ok := err.(distribution.ErrTagImmutable); !ok || immutableErr.Digest != first {
+			t.Fatalf("%s: expected ErrTagImmutable moving tag, got %v", name, err)
+		}
+
+		desc, err := tags.Get(ctx, "v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if desc.Digest != first {
+			t.Fatalf("%s: immutable tag was moved to %s", name, desc.Digest)
+		}
+
+		// Neither the tag nor the manifest it refers to may be deleted
+		if _, ok := tags.Untag(ctx, "v1").(distribution.ErrTagImmutable); !ok {
+			t.Fatalf("%s: expected ErrTagImmutable deleting tag", name)
+		}
+
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := manifests.Delete(ctx, first).(distribution.ErrTagImmutable); !ok {
+			t.Fatalf("%s: expected ErrTagImmutable deleting manifest", name)
+		}
+		if err := manifests.Delete(ctx, second); err != nil {
+			t.Fatalf("%s: unexpected error deleting manifest: %v", name, err)
+		}
+
+		if _, ok := tags.Untag(ctx, "v2").(distribution.ErrTagUnknown); !ok {
+			t.Fatalf("%s: expected ErrTagUnknown deleting unknown tag", name)
+		}
+		if err := tags.Untag(ctx, "latest"); err != nil {
+			t.Fatalf("%s: unexpected error deleting mutable tag: %v", name, err)
+		}
+	}
+}
+
+func TestImmutableTagsConcurrentPush(t *testing.T) {
+	ctx := context.Background()
+	d := &slowReadDriver{StorageDriver: inmemory.New()}
+	registry, err := NewRegistry(ctx, d, ImmutableTags([]ImmutableTagRule{{Repository: "release/*", Tag: "v*"}}))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	env := &gcTestEnv{ctx: ctx, driver: d, registry: registry}
+	repo := env.repository(t, "release/app")
+
+	var manifests []digest.Digest
+	for i := 0; i < 8; i++ {
+		dgst, _ := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 1))
+		manifests = append(manifests, dgst)
+	}
+
+	// Only one of the manifests pushed at once may take the new tag, even
+	// when the pushes read the tag slowly.
+	d.delay = 10 * time.Millisecond
+	tags := repo.Tags(ctx)
+	errs := make([]error, len(manifests))
+	var wg sync.WaitGroup
+	for i, dgst := range manifests {
+		wg.Add(1)
+		go func(i int, dgst digest.Digest) {
+			defer wg.Done()
+			errs[i] = tags.Tag(ctx, "v1", distribution.Descriptor{Digest: dgst})
+		}(i, dgst)
+	}
+	wg.Wait()
+
+	desc, err := tags.Get(ctx, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := 0
+	for i, err := range errs {
+		switch err.(type) {
+		case nil:
+			tagged++
+			if manifests[i] != desc.Digest {
+				t.Fatalf("tag refers to %s instead of the tagged %s", desc.Digest, manifests[i])
+			}
+		case distribution.ErrTagImmutable:
+		default:
+			t.Fatalf("unexpected error tagging: %v", err)
+		}
+	}
+	if tagged != 1 {
+		t.Fatalf("expected one manifest to be tagged, got %d", tagged)
+	}
+}
+
+// slowReadDriver delays returning the content of files once read.
+type slowReadDriver struct {
+	storagedriver.StorageDriver
+	delay time.Duration
+}
+
+func (d *slowReadDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	content, err := d.StorageDriver.GetContent(ctx, path)
+	time.Sleep(d.delay)
+	return content, err
+}
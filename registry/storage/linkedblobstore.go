@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -13,6 +14,10 @@ import (
 	"github.com/docker/distribution/uuid"
 )
 
+// errBlobCollected is returned when linking a blob which an online garbage
+// collection is removing. The blob has to be pushed again.
+var errBlobCollected = errors.New("blob removed by garbage collection, push it again")
+
 // linkPathFunc describes a function that can resolve a link based on the
 // repository name and digest.
 type linkPathFunc func(name string, dgst digest.Digest) (string, error)
@@ -37,6 +42,9 @@ type linkedBlobStore struct {
 	// removed an the blob links folder should be merged. The first entry is
 	// treated as the "canonical" link location and will be used for writes.
 	linkPathFns []linkPathFunc
+
+	// linkKind identifies the link set written to for usage accounting.
+	linkKind linkKind
 }
 
 var _ distribution.BlobStore = &linkedBlobStore{}
@@ -79,6 +87,10 @@ func (lbs *linkedBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter
 
 func (lbs *linkedBlobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
 	dgst := digest.FromBytes(p)
+	if err := lbs.checkQuota(ctx, distribution.Descriptor{Digest: dgst, Size: int64(len(p))}); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	// Place the data in the blob store first.
 	desc, err := lbs.blobStore.Put(ctx, mediaType, p)
 	if err != nil {
@@ -147,6 +159,11 @@ func (lbs *linkedBlobStore) Create(ctx context.Context, options ...distribution.
 			// Mount successful, no need to initiate an upload session
 			return nil, distribution.ErrBlobMounted{From: opts.Mount.From, Descriptor: desc}
 		}
+
+		// A refused mount would be refused on commit of the upload as well.
+		if _, ok := err.(distribution.ErrQuotaExceeded); ok {
+			return nil, err
+		}
 	}
 
 	uuid := uuid.Generate().String()
@@ -217,23 +234,118 @@ func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (distribution
 	return lbs.newBlobUpload(ctx, id, path, startedAt)
 }
 
-func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) error {
+// deleteOptions is a collection of blob deletion modifiers intended to be
+// configured by the BlobDeleteOption.Apply method.
+type deleteOptions struct {
+	Force bool
+}
+
+// WithForce returns a BlobDeleteOption which deletes the blob even if
+// manifests in the repository still reference it.
+func WithForce() distribution.BlobDeleteOption {
+	return optionFunc(func(v interface{}) error {
+		opts, ok := v.(*deleteOptions)
+		if !ok {
+			return fmt.Errorf("unexpected options type: %T", v)
+		}
+
+		opts.Force = true
+
+		return nil
+	})
+}
+
+// Delete unlinks the blob from the repository. A layer referenced by a
+// manifest revision of the repository is only unlinked when forced, as
+// doing so breaks the manifest. References are found through the referrer
+// index, or by reading every manifest of the repository when the index has
+// no entry for the layer.
+func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest, options ...distribution.BlobDeleteOption) error {
 	if !lbs.deleteEnabled {
 		return distribution.ErrUnsupported
 	}
 
+	var opts deleteOptions
+
+	for _, option := range options {
+		err := option.Apply(&opts)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Ensure the blob is available for deletion
 	_, err := lbs.blobAccessController.Stat(ctx, dgst)
 	if err != nil {
 		return err
 	}
 
+	if lbs.linkKind == layerLink && !opts.Force {
+		manifests, err := lbs.registry.referencingManifests(ctx, lbs.repository.Name().Name(), dgst)
+		if err != nil {
+			return err
+		}
+
+		if len(manifests) > 0 {
+			return distribution.ErrBlobReferenced{Digest: dgst, Manifests: manifests}
+		}
+	}
+
+	return lbs.unlink(ctx, dgst)
+}
+
+// unlink removes the links to the blob from the repository, accounting for
+// them in the usage records and the referrer index.
+func (lbs *linkedBlobStore) unlink(ctx context.Context, dgst digest.Digest) error {
+	if lbs.linkKind == untrackedLink {
+		return lbs.blobAccessController.Clear(ctx, dgst)
+	}
+
+	name := lbs.repository.Name().Name()
+	unlock, err := lbs.registry.usage.lockBlob(dgst)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var delta usageRecord
+	if lbs.linkKind == manifestLink {
+		revisionPath, err := manifestRevisionLinkPath(name, dgst)
+		if err != nil {
+			return err
+		}
+		revisionLinked, err := exists(ctx, lbs.blobStore.driver, revisionPath)
+		if err != nil {
+			return err
+		}
+		if revisionLinked {
+			delta.Manifests = -1
+		}
+	}
+
 	err = lbs.blobAccessController.Clear(ctx, dgst)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// The blob may remain linked under the other link set.
+	linked, err := lbs.registry.linked(ctx, name, dgst)
+	if err != nil {
+		return err
+	}
+	if !linked {
+		var size int64
+		size, err = lbs.registry.usage.blobSize(ctx, dgst)
+		delta.LinkedBytes = -size
+	}
+	if err == nil {
+		err = lbs.registry.usage.linkChanged(ctx, name, dgst, delta)
+	}
+	if err != nil {
+		context.GetLogger(ctx).Errorf("usage: unable to account for unlinking %s from %s: %v", dgst, name, err)
+	}
+
+	return lbs.registry.unindexLink(ctx, name, dgst)
 }
 
 func (lbs *linkedBlobStore) mount(ctx context.Context, sourceRepo reference.Named, dgst digest.Digest) (distribution.Descriptor, error) {
@@ -255,6 +367,11 @@ func (lbs *linkedBlobStore) mount(ctx context.Context, sourceRepo reference.Name
 		MediaType: "application/octet-stream",
 		Digest:    dgst,
 	}
+
+	if err := lbs.checkQuota(ctx, desc); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	return desc, lbs.linkBlob(ctx, desc)
 }
 
@@ -292,13 +409,38 @@ func (lbs *linkedBlobStore) linkBlob(ctx context.Context, canonical distribution
 	// only use the first link
 	linkPathFn := lbs.linkPathFns[0]
 
+	name := lbs.repository.Name().Name()
+	var linked, relinked bool
+	if lbs.linkKind != untrackedLink {
+		unlock, err := lbs.registry.usage.lockBlob(canonical.Digest)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		linked, err = lbs.registry.linked(ctx, name, canonical.Digest)
+		if err != nil {
+			return err
+		}
+
+		linkPath, err := linkPathFn(name, canonical.Digest)
+		if err != nil {
+			return err
+		}
+		relinked, err = exists(ctx, lbs.blobStore.driver, linkPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var linkPaths []string
 	for _, dgst := range dgsts {
 		if _, seen := seenDigests[dgst]; seen {
 			continue
 		}
 		seenDigests[dgst] = struct{}{}
 
-		blobLinkPath, err := linkPathFn(lbs.repository.Name().Name(), dgst)
+		blobLinkPath, err := linkPathFn(name, dgst)
 		if err != nil {
 			return err
 		}
@@ -306,9 +448,57 @@ func (lbs *linkedBlobStore) linkBlob(ctx context.Context, canonical distribution
 		if err := lbs.blobStore.link(ctx, blobLinkPath, canonical.Digest); err != nil {
 			return err
 		}
+		linkPaths = append(linkPaths, blobLinkPath)
 	}
 
-	return nil
+	if lbs.linkKind == untrackedLink {
+		return nil
+	}
+
+	// An online garbage collection moves the data of the blobs it removes
+	// aside before looking for links to them, so the link is either seen by
+	// the collector, which then restores the data, or the data is missing
+	// here and the new link is taken back.
+	present, err := lbs.blobStore.present(ctx, canonical.Digest)
+	if err != nil {
+		return err
+	}
+	if !present {
+		if !relinked {
+			for _, linkPath := range linkPaths {
+				if err := lbs.blobStore.driver.Delete(ctx, linkPath); err != nil {
+					context.GetLogger(ctx).Errorf("unable to remove link %s to collected blob: %v", linkPath, err)
+				}
+			}
+		}
+		return errBlobCollected
+	}
+
+	var delta usageRecord
+	if lbs.linkKind == manifestLink && !relinked {
+		delta.Manifests = 1
+	}
+
+	if !linked {
+		delta.LinkedBytes = canonical.Size
+		if delta.LinkedBytes == 0 {
+			delta.LinkedBytes, err = lbs.registry.usage.blobSize(ctx, canonical.Digest)
+		}
+	}
+	if err == nil {
+		err = lbs.registry.usage.linkChanged(ctx, name, canonical.Digest, delta)
+	}
+	if err != nil {
+		context.GetLogger(ctx).Errorf("usage: unable to account for linking %s into %s: %v", canonical.Digest, name, err)
+	}
+
+	// A blob linked before the referrer index was introduced is left out of
+	// it, as the manifests referencing it may not be indexed.
+	if linked {
+		return nil
+	}
+
+	return lbs.registry.indexLink(ctx, name, canonical.Digest)
 }
 
 type linkedBlobStatter struct {
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"path"
 
 	"encoding/json"
 	"github.com/docker/distribution"
@@ -11,6 +12,7 @@ import (
 	"github.com/docker/distribution/manifest/manifestlist"
 	"github.com/docker/distribution/manifest/schema1"
 	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver"
 )
 
 // A ManifestHandler gets and puts manifests of a particular type.
@@ -51,6 +53,8 @@ type manifestStore struct {
 }
 
 var _ distribution.ManifestService = &manifestStore{}
+var _ distribution.ManifestEnumerator = &manifestStore{}
+var _ distribution.SignaturesGetter = &manifestStore{}
 
 func (ms *manifestStore) Exists(ctx context.Context, dgst digest.Digest) (bool, error) {
 	context.GetLogger(ms.ctx).Debug("(*manifestStore).Exists")
@@ -111,24 +115,154 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
 	context.GetLogger(ms.ctx).Debug("(*manifestStore).Put")
 
+	var handler ManifestHandler
 	switch manifest.(type) {
 	case *schema1.SignedManifest:
-		return ms.schema1Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema1Handler
 	case *schema2.DeserializedManifest:
-		return ms.schema2Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema2Handler
 	case *manifestlist.DeserializedManifestList:
-		return ms.manifestListHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.manifestListHandler
+	default:
+		return "", fmt.Errorf("unrecognized manifest type %T", manifest)
 	}
 
-	return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	name := ms.repository.Name().Name()
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		return "", err
+	}
+	revisionPath, err := manifestRevisionLinkPath(name, digest.FromBytes(payload))
+	if err != nil {
+		return "", err
+	}
+	relinked, err := exists(ctx, ms.blobStore.driver, revisionPath)
+	if err != nil {
+		return "", err
+	}
+
+	dgst, err := handler.Put(ctx, manifest, ms.skipDependencyVerification)
+	if err != nil {
+		return "", err
+	}
+
+	if !ms.skipDependencyVerification {
+		if err := ms.checkReferencesPresent(ctx, manifest); err != nil {
+			if !relinked {
+				if err := ms.blobStore.unlink(ctx, dgst); err != nil {
+					context.GetLogger(ctx).Errorf("unable to remove manifest %s referencing collected blob: %v", dgst, err)
+				}
+			}
+			return "", err
+		}
+	}
+
+	return dgst, ms.repository.indexManifest(ctx, name, dgst, manifest)
+}
+
+// checkReferencesPresent fails if the data of a blob referenced by the
+// manifest is missing once its revision is linked. An online garbage
+// collection moves the data of the blobs it removes aside before looking for
+// manifests linked since it started, so a referenced blob is either spared
+// by the collector or found missing here.
+func (ms *manifestStore) checkReferencesPresent(ctx context.Context, manifest distribution.Manifest) error {
+	for _, desc := range manifestReferences(manifest) {
+		present, err := ms.blobStore.present(ctx, desc.Digest)
+		if err != nil {
+			return err
+		}
+		if !present {
+			return distribution.ErrManifestVerification{distribution.ErrManifestBlobUnknown{Digest: desc.Digest}}
+		}
+	}
+
+	return nil
 }
 
-// Delete removes the revision of the specified manfiest.
+// Delete removes the revision of the specified manfiest, unless an immutable
+// tag refers to it.
 func (ms *manifestStore) Delete(ctx context.Context, dgst digest.Digest) error {
 	context.GetLogger(ms.ctx).Debug("(*manifestStore).Delete")
+	if ms.blobStore.deleteEnabled {
+		if err := ms.repository.checkImmutableReferrers(ctx, dgst); err != nil {
+			return err
+		}
+	}
 	return ms.blobStore.Delete(ctx, dgst)
 }
 
-func (ms *manifestStore) Enumerate(ctx context.Context, manifests []distribution.Manifest, last distribution.Manifest) (n int, err error) {
-	return 0, distribution.ErrUnsupported
+// Enumerate calls ingester for each manifest revision linked into the
+// repository. Signature links stored alongside revisions are skipped.
+func (ms *manifestStore) Enumerate(ctx context.Context, ingester func(digest.Digest) error) error {
+	rootPath, err := pathFor(manifestRevisionsPathSpec{name: ms.repository.Name().Name()})
+	if err != nil {
+		return err
+	}
+
+	err = walkAll(ctx, ms.blobStore.driver, rootPath, func(fileInfo driver.FileInfo) error {
+		_, fileName := path.Split(fileInfo.Path())
+		if fileInfo.IsDir() {
+			if fileName == "signatures" {
+				return ErrSkipDir
+			}
+			return nil
+		}
+
+		if fileName != "link" {
+			return nil
+		}
+
+		dgst, err := ms.blobStore.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		return ingester(dgst)
+	})
+
+	switch err.(type) {
+	case driver.PathNotFoundError:
+		// repository has no manifests
+		return nil
+	}
+
+	return err
+}
+
+// GetSignatures returns the digests of the signatures stored for the given
+// manifest revision. Manifests without signatures return an empty list.
+func (ms *manifestStore) GetSignatures(ctx context.Context, manifestDigest digest.Digest) ([]digest.Digest, error) {
+	signaturesPath, err := pathFor(manifestSignaturesPathSpec{
+		name:     ms.repository.Name().Name(),
+		revision: manifestDigest,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var signatures []digest.Digest
+	err = walkAll(ctx, ms.blobStore.driver, signaturesPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		dgst, err := ms.blobStore.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		signatures = append(signatures, dgst)
+		return nil
+	})
+
+	switch err.(type) {
+	case nil:
+	case driver.PathNotFoundError:
+		// not a schema1 manifest, or no signatures stored
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	return signatures, nil
 }
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// MigrateOpts contains options for copying a registry between storage
+// drivers.
+type MigrateOpts struct {
+	// Parallelism is the number of files copied concurrently. It defaults to
+	// one.
+	Parallelism int
+}
+
+// Migrate copies the registry stored in src to dst, using only the
+// driver.StorageDriver interface. Blobs are copied first, followed by the
+// repository links and the referrer index, so that dst never refers to a
+// blob which it does not hold. Uploads in progress are not copied.
+//
+// Each blob is written to a temporary file, its digest is verified by
+// reading it back from dst, and it is then moved into place. Blobs already
+// present in dst are skipped, which makes an interrupted migration
+// resumable by running it again. Repository links and index entries are
+// small and always copied.
+//
+// src must not be written to while the migration runs, or the copy may be
+// inconsistent.
+func Migrate(ctx context.Context, src, dst driver.StorageDriver, opts MigrateOpts) error {
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	m := &migration{
+		ctx: ctx,
+		src: src,
+		dst: dst,
+	}
+
+	// blobs
+	srcBlobs := &blobStore{driver: src}
+	err := m.run(parallelism, func(submit func(job func() error) error) error {
+		return srcBlobs.Enumerate(ctx, func(dgst digest.Digest) error {
+			return submit(func() error {
+				return m.copyBlob(dgst)
+			})
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy blobs: %v", err)
+	}
+
+	// repositories, then the referrer index
+	for _, spec := range []pathSpec{repositoriesRootPathSpec{}, referrersRootPathSpec{}} {
+		root, err := pathFor(spec)
+		if err != nil {
+			return err
+		}
+
+		err = m.run(parallelism, func(submit func(job func() error) error) error {
+			err := walkAll(ctx, src, root, func(fileInfo driver.FileInfo) error {
+				filePath := fileInfo.Path()
+				if fileInfo.IsDir() {
+					if path.Base(filePath) == "_uploads" {
+						return ErrSkipDir
+					}
+					return nil
+				}
+
+				return submit(func() error {
+					return m.copyFile(filePath)
+				})
+			})
+
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// nothing to copy
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %v", root, err)
+		}
+	}
+
+	emit("\n%d blobs copied, %d blobs skipped, %d repository files copied", m.copied, m.skipped, m.files)
+	return nil
+}
+
+// migration holds the state of a call to Migrate.
+type migration struct {
+	ctx context.Context
+	src driver.StorageDriver
+	dst driver.StorageDriver
+
+	mu      sync.Mutex
+	copied  int
+	skipped int
+	files   int
+}
+
+// run calls the jobs submitted by produce on parallelism goroutines. It
+// returns the first error encountered; once a job has failed, submit refuses
+// further jobs.
+func (m *migration) run(parallelism int, produce func(submit func(job func() error) error) error) error {
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		jobs     = make(chan func() error)
+		failed   = make(chan struct{})
+	)
+
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := job(); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+
+	err := produce(func(job func() error) error {
+		select {
+		case jobs <- job:
+			return nil
+		case <-failed:
+			return errMigrationFailed
+		}
+	})
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return err
+}
+
+// errMigrationFailed is returned by submit once a job has failed.
+var errMigrationFailed = fmt.Errorf("migration failed")
+
+// copyBlob copies the data of the blob identified by dgst, unless it is
+// already present in dst.
+func (m *migration) copyBlob(dgst digest.Digest) error {
+	blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return err
+	}
+
+	present, err := exists(m.ctx, m.dst, blobPath)
+	if err != nil {
+		return err
+	}
+	if present {
+		m.mu.Lock()
+		m.skipped++
+		m.mu.Unlock()
+		return nil
+	}
+
+	// Stage the copy next to its final location, so that an interrupted
+	// copy is never mistaken for a complete blob.
+	partialPath := path.Join(path.Dir(blobPath), "partial")
+	if err := m.dst.Delete(m.ctx, partialPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	reader, err := m.src.ReadStream(m.ctx, blobPath, 0)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if _, err := m.dst.WriteStream(m.ctx, partialPath, 0, reader); err != nil {
+		return fmt.Errorf("failed to copy blob %s: %v", dgst, err)
+	}
+
+	if err := m.verify(dgst, partialPath); err != nil {
+		return err
+	}
+
+	if err := m.dst.Move(m.ctx, partialPath, blobPath); err != nil {
+		return fmt.Errorf("failed to move blob %s into place: %v", dgst, err)
+	}
+
+	emit("blob %s copied", dgst)
+	m.mu.Lock()
+	m.copied++
+	m.mu.Unlock()
+	return nil
+}
+
+// verify reads back the data at p from dst and checks it against dgst.
+func (m *migration) verify(dgst digest.Digest, p string) error {
+	verifier, err := digest.NewDigestVerifier(dgst)
+	if err != nil {
+		return err
+	}
+
+	reader, err := m.dst.ReadStream(m.ctx, p, 0)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(verifier, reader); err != nil {
+		return err
+	}
+
+	if !verifier.Verified() {
+		return fmt.Errorf("blob %s does not match its digest after copying", dgst)
+	}
+
+	return nil
+}
+
+// copyFile copies the small file at p from src to dst.
+func (m *migration) copyFile(p string) error {
+	content, err := m.src.GetContent(m.ctx, p)
+	if err != nil {
+		return err
+	}
+
+	if err := m.dst.PutContent(m.ctx, p, content); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.files++
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestMigrate(t *testing.T) {
+	src := newGCTestEnv(t)
+
+	first := src.repository(t, "foo/first")
+	layers := uploadRandomLayers(t, first, 3)
+	dgst, _ := uploadSchema2Manifest(t, first, layers)
+	tagManifest(t, src, first, "latest", dgst)
+
+	second := src.repository(t, "bar")
+	secondDigest := uploadSchema1Manifest(t, second, uploadRandomLayers(t, second, 2))
+	tagManifest(t, src, second, "v1", secondDigest)
+
+	// uploads in progress are not copied
+	if _, err := second.Blobs(src.ctx).Create(src.ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	d := inmemory.New()
+	registry, err := NewRegistry(src.ctx, d, EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	dst := &gcTestEnv{ctx: src.ctx, driver: d, registry: registry}
+
+	// A copy interrupted before the blob was moved into place is redone
+	blobPath, err := pathFor(blobDataPathSpec{digest: layers[0].Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutContent(src.ctx, path.Join(path.Dir(blobPath), "partial"), []byte("part")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(src.ctx, src.driver, d, MigrateOpts{Parallelism: 3}); err != nil {
+		t.Fatalf("unexpected error migrating: %v", err)
+	}
+
+	checkTags(t, dst, dst.repository(t, "foo/first"), "latest")
+	checkTags(t, dst, dst.repository(t, "bar"), "v1")
+	if !manifestExists(t, dst, dst.repository(t, "foo/first"), dgst) {
+		t.Fatalf("manifest %s was not migrated", dgst)
+	}
+	if !manifestExists(t, dst, dst.repository(t, "bar"), secondDigest) {
+		t.Fatalf("manifest %s was not migrated", secondDigest)
+	}
+	for _, layer := range layers {
+		if _, err := dst.repository(t, "foo/first").Blobs(dst.ctx).Stat(dst.ctx, layer.Digest); err != nil {
+			t.Fatalf("layer %s was not migrated: %v", layer.Digest, err)
+		}
+	}
+	checkFsck(t, dst, FsckOpts{Verify: true})
+
+	// The referrer index is copied along with the repositories
+	referrers, err := dst.registry.(distribution.BlobReferrerIndexer).Referrers(dst.ctx, layers[0].Digest)
+	if err != nil {
+		t.Fatalf("unexpected error reading referrers: %v", err)
+	}
+	if len(referrers) != 1 || referrers[0].Name != "foo/first" {
+		t.Fatalf("unexpected referrers of migrated layer: %v", referrers)
+	}
+	referrersPath, err := pathFor(referrersPathSpec{digest: layers[0].Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := exists(dst.ctx, d, referrersPath); err != nil || !ok {
+		t.Fatalf("referrer index was not migrated: %v, %v", ok, err)
+	}
+
+	uploadsPath, err := pathFor(uploadsPathSpec{name: "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := exists(dst.ctx, d, uploadsPath); err != nil || ok {
+		t.Fatalf("uploads were migrated: %v, %v", ok, err)
+	}
+
+	// Migrating again skips the blobs already copied
+	if err := Migrate(src.ctx, src.driver, d, MigrateOpts{Parallelism: 3}); err != nil {
+		t.Fatalf("unexpected error resuming migration: %v", err)
+	}
+	checkFsck(t, dst, FsckOpts{Verify: true})
+}
+
+func TestMigrateVerifiesDigests(t *testing.T) {
+	src := newGCTestEnv(t)
+	repo := src.repository(t, "foo/bar")
+	layers := uploadRandomLayers(t, repo, 1)
+
+	blobPath, err := pathFor(blobDataPathSpec{digest: layers[0].Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.driver.PutContent(src.ctx, blobPath, []byte("corrupt")); err != nil {
+		t.Fatal(err)
+	}
+
+	d := inmemory.New()
+	err = Migrate(src.ctx, src.driver, d, MigrateOpts{Parallelism: 2})
+	if err == nil || !strings.Contains(err.Error(), "does not match its digest") {
+		t.Fatalf("expected digest mismatch, got %v", err)
+	}
+
+	if ok, err := exists(src.ctx, d, blobPath); err != nil || ok {
+		t.Fatalf("corrupt blob was migrated: %v, %v", ok, err)
+	}
+}
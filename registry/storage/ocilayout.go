@@ -0,0 +1,524 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+)
+
+const (
+	// ociLayoutFile marks the root of an OCI image layout.
+	ociLayoutFile = "oci-layout"
+
+	// ociIndexFile lists the manifests of an OCI image layout.
+	ociIndexFile = "index.json"
+
+	// ociImageLayoutVersion is the version of the OCI image layout written
+	// and accepted.
+	ociImageLayoutVersion = "1.0.0"
+
+	// ociRefNameAnnotation names the manifests listed in the index.
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+	// mediaTypeOCIIndex is the media type of the index.
+	mediaTypeOCIIndex = "application/vnd.oci.image.index.v1+json"
+)
+
+// ociLayout is the content of the oci-layout file.
+type ociLayout struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+// ociDescriptor describes a manifest listed in the index.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      digest.Digest     `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociIndex is the content of the index.json file.
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// ociBlobPath returns the path of a blob within an OCI image layout.
+func ociBlobPath(dgst digest.Digest) string {
+	return path.Join("blobs", dgst.Algorithm().String(), dgst.Hex())
+}
+
+// manifestBlobs returns the blobs referenced by an image manifest: its
+// layers and, for schema2 manifests, its configuration.
+func manifestBlobs(manifest distribution.Manifest) []distribution.Descriptor {
+	blobs := append([]distribution.Descriptor{}, manifest.References()...)
+	if m, ok := manifest.(*schema2.DeserializedManifest); ok {
+		blobs = append(blobs, m.Config)
+	}
+	return blobs
+}
+
+// ExportOCILayout writes the images named by refs to w, as a tar archive of
+// an OCI image layout. A reference with a tag exports that tag; a reference
+// without one exports every tag of the repository. Each tagged manifest is
+// listed in index.json, annotated with its fully qualified name, such as
+// "foo/bar:latest".
+//
+// Manifests are written in the format they were pushed in. Schema1
+// manifests are written with their signatures, under the digest of the
+// signed payload.
+func ExportOCILayout(ctx context.Context, registry distribution.Namespace, w io.Writer, refs []reference.Named) error {
+	exporter := &ociExporter{
+		ctx:     ctx,
+		tw:      tar.NewWriter(w),
+		modTime: time.Now(),
+		written: make(map[string]struct{}),
+	}
+
+	layout, err := json.Marshal(ociLayout{ImageLayoutVersion: ociImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	if err := exporter.writeFile(ociLayoutFile, bytes.NewReader(layout), int64(len(layout))); err != nil {
+		return err
+	}
+
+	index := ociIndex{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIIndex,
+		Manifests:     []ociDescriptor{},
+	}
+
+	for _, ref := range refs {
+		repo, err := registry.Repository(ctx, ref)
+		if err != nil {
+			return err
+		}
+
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			return err
+		}
+
+		var tags []string
+		if tagged, ok := ref.(reference.Tagged); ok {
+			tags = []string{tagged.Tag()}
+		} else {
+			tags, err = repo.Tags(ctx).All(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, tag := range tags {
+			desc, err := repo.Tags(ctx).Get(ctx, tag)
+			if err != nil {
+				return err
+			}
+
+			emit("%s:%s: exporting manifest %s", ref.Name(), tag, desc.Digest)
+			manifestDesc, err := exporter.exportManifest(repo, manifests, desc.Digest)
+			if err != nil {
+				return err
+			}
+
+			named, err := reference.WithTag(ref, tag)
+			if err != nil {
+				return err
+			}
+			manifestDesc.Annotations = map[string]string{ociRefNameAnnotation: named.String()}
+			index.Manifests = append(index.Manifests, manifestDesc)
+		}
+	}
+
+	p, err := json.MarshalIndent(index, "", "   ")
+	if err != nil {
+		return err
+	}
+	if err := exporter.writeFile(ociIndexFile, bytes.NewReader(p), int64(len(p))); err != nil {
+		return err
+	}
+
+	return exporter.tw.Close()
+}
+
+// ociExporter writes the files of an OCI image layout to a tar archive.
+type ociExporter struct {
+	ctx     context.Context
+	tw      *tar.Writer
+	modTime time.Time
+
+	// written holds the files and directories already in the archive.
+	written map[string]struct{}
+}
+
+// writeFile adds a file, and its missing parent directories, to the archive.
+func (e *ociExporter) writeFile(name string, r io.Reader, size int64) error {
+	if dir := path.Dir(name); dir != "." {
+		if _, ok := e.written[dir]; !ok {
+			if err := e.writeDir(dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := e.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  e.modTime,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(e.tw, r); err != nil {
+		return err
+	}
+
+	e.written[name] = struct{}{}
+	return nil
+}
+
+// writeDir adds a directory, and its missing parent directories, to the
+// archive.
+func (e *ociExporter) writeDir(dir string) error {
+	if parent := path.Dir(dir); parent != "." {
+		if _, ok := e.written[parent]; !ok {
+			if err := e.writeDir(parent); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := e.tw.WriteHeader(&tar.Header{
+		Name:     dir + "/",
+		Mode:     0755,
+		ModTime:  e.modTime,
+		Typeflag: tar.TypeDir,
+	}); err != nil {
+		return err
+	}
+
+	e.written[dir] = struct{}{}
+	return nil
+}
+
+// exportManifest writes the manifest identified by dgst, and the blobs and
+// manifests it references, returning its descriptor.
+func (e *ociExporter) exportManifest(repo distribution.Repository, manifests distribution.ManifestService, dgst digest.Digest) (ociDescriptor, error) {
+	manifest, err := manifests.Get(e.ctx, dgst)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	if _, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		for _, child := range manifest.References() {
+			if _, err := e.exportManifest(repo, manifests, child.Digest); err != nil {
+				return ociDescriptor{}, err
+			}
+		}
+	} else {
+		for _, blob := range manifestBlobs(manifest) {
+			if err := e.exportBlob(repo, blob.Digest); err != nil {
+				return ociDescriptor{}, err
+			}
+		}
+	}
+
+	desc := ociDescriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(payload),
+		Size:      int64(len(payload)),
+	}
+
+	name := ociBlobPath(desc.Digest)
+	if _, ok := e.written[name]; !ok {
+		if err := e.writeFile(name, bytes.NewReader(payload), desc.Size); err != nil {
+			return ociDescriptor{}, err
+		}
+	}
+
+	return desc, nil
+}
+
+// exportBlob writes the blob identified by dgst, unless it is already in
+// the archive.
+func (e *ociExporter) exportBlob(repo distribution.Repository, dgst digest.Digest) error {
+	name := ociBlobPath(dgst)
+	if _, ok := e.written[name]; ok {
+		return nil
+	}
+
+	blobs := repo.Blobs(e.ctx)
+	desc, err := blobs.Stat(e.ctx, dgst)
+	if err != nil {
+		return fmt.Errorf("failed to stat blob %s: %v", dgst, err)
+	}
+
+	rc, err := blobs.Open(e.ctx, dgst)
+	if err != nil {
+		return fmt.Errorf("failed to open blob %s: %v", dgst, err)
+	}
+	defer rc.Close()
+
+	return e.writeFile(name, rc, desc.Size)
+}
+
+// ImportOCILayout pushes the images listed in the index of the OCI image
+// layout archived in r, of the given size, and tags them. Each manifest of
+// the index must be annotated with a fully qualified name, such as
+// "foo/bar:latest", unless repository is given: every image is then
+// imported into repository, and the annotation, if any, only provides the
+// tag. It returns the references imported.
+//
+// Blobs are pushed through the BlobIngester of each repository, and
+// manifests through ManifestService.Put, so that the same validation
+// applies as for pushes over the API.
+func ImportOCILayout(ctx context.Context, registry distribution.Namespace, r io.ReaderAt, size int64, repository reference.Named) ([]reference.Named, error) {
+	importer := &ociImporter{
+		ctx:   ctx,
+		files: make(map[string]*io.SectionReader),
+	}
+	if err := importer.indexArchive(r, size); err != nil {
+		return nil, err
+	}
+
+	var layout ociLayout
+	if err := importer.readJSON(ociLayoutFile, &layout); err != nil {
+		return nil, err
+	}
+	if layout.ImageLayoutVersion != ociImageLayoutVersion {
+		return nil, fmt.Errorf("unsupported image layout version %q", layout.ImageLayoutVersion)
+	}
+
+	var index ociIndex
+	if err := importer.readJSON(ociIndexFile, &index); err != nil {
+		return nil, err
+	}
+
+	var imported []reference.Named
+	for _, desc := range index.Manifests {
+		named, err := ociReference(desc, repository)
+		if err != nil {
+			return imported, err
+		}
+
+		repo, err := registry.Repository(ctx, named)
+		if err != nil {
+			return imported, err
+		}
+
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			return imported, err
+		}
+
+		emit("%s: importing manifest %s", named, desc.Digest)
+		dgst, err := importer.importManifest(repo, manifests, desc.MediaType, desc.Digest)
+		if err != nil {
+			return imported, err
+		}
+
+		if tagged, ok := named.(reference.Tagged); ok {
+			if err := repo.Tags(ctx).Tag(ctx, tagged.Tag(), distribution.Descriptor{Digest: dgst}); err != nil {
+				return imported, err
+			}
+		}
+
+		imported = append(imported, named)
+	}
+
+	return imported, nil
+}
+
+// ociReference returns the name an image listed in the index is imported
+// as.
+func ociReference(desc ociDescriptor, repository reference.Named) (reference.Named, error) {
+	refName := desc.Annotations[ociRefNameAnnotation]
+
+	named, err := reference.ParseNamed(refName)
+	tagged, isTagged := named.(reference.Tagged)
+	if err == nil && isTagged {
+		if repository == nil {
+			return named, nil
+		}
+		return reference.WithTag(repository, tagged.Tag())
+	}
+
+	if repository == nil {
+		return nil, fmt.Errorf("manifest %s has no fully qualified %s annotation", desc.Digest, ociRefNameAnnotation)
+	}
+
+	if refName == "" {
+		return repository, nil
+	}
+	return reference.WithTag(repository, refName)
+}
+
+// ociImporter reads the files of an archived OCI image layout.
+type ociImporter struct {
+	ctx context.Context
+
+	// files maps the name of each regular file in the archive to its data.
+	files map[string]*io.SectionReader
+}
+
+// offsetReader counts the bytes read from a reader.
+type offsetReader struct {
+	r      io.Reader
+	offset int64
+}
+
+func (or *offsetReader) Read(p []byte) (int, error) {
+	n, err := or.r.Read(p)
+	or.offset += int64(n)
+	return n, err
+}
+
+// indexArchive records the location of each regular file in the archive,
+// so that files may later be read in any order.
+func (oi *ociImporter) indexArchive(r io.ReaderAt, size int64) error {
+	or := &offsetReader{r: io.NewSectionReader(r, 0, size)}
+	tr := tar.NewReader(or)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image layout archive: %v", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "/")
+		oi.files[name] = io.NewSectionReader(r, or.offset, hdr.Size)
+	}
+}
+
+// open returns a reader for the named file of the layout.
+func (oi *ociImporter) open(name string) (*io.SectionReader, error) {
+	f, ok := oi.files[name]
+	if !ok {
+		return nil, fmt.Errorf("image layout is missing %s", name)
+	}
+	return io.NewSectionReader(f, 0, f.Size()), nil
+}
+
+func (oi *ociImporter) readJSON(name string, v interface{}) error {
+	f, err := oi.open(name)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", name, err)
+	}
+	return nil
+}
+
+// importManifest pushes the manifest identified by dgst, after the blobs
+// and manifests it references, returning the digest it was stored under.
+func (oi *ociImporter) importManifest(repo distribution.Repository, manifests distribution.ManifestService, mediaType string, dgst digest.Digest) (digest.Digest, error) {
+	f, err := oi.open(ociBlobPath(dgst))
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	if digest.FromBytes(payload) != dgst {
+		return "", fmt.Errorf("manifest %s does not match its digest", dgst)
+	}
+
+	manifest, _, err := distribution.UnmarshalManifest(mediaType, payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal manifest %s: %v", dgst, err)
+	}
+
+	if _, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		for _, child := range manifest.References() {
+			if _, err := oi.importManifest(repo, manifests, child.MediaType, child.Digest); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		for _, blob := range manifestBlobs(manifest) {
+			if err := oi.importBlob(repo, blob.Digest); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	revision, err := manifests.Put(oi.ctx, manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to put manifest %s: %v", dgst, err)
+	}
+
+	// Schema1 manifests are stored under the digest of their unsigned
+	// payload.
+	if _, ok := manifest.(*schema1.SignedManifest); !ok && revision != dgst {
+		return "", fmt.Errorf("manifest %s was stored as %s", dgst, revision)
+	}
+
+	return revision, nil
+}
+
+// importBlob pushes the blob identified by dgst, unless the repository
+// already holds it.
+func (oi *ociImporter) importBlob(repo distribution.Repository, dgst digest.Digest) error {
+	blobs := repo.Blobs(oi.ctx)
+	if _, err := blobs.Stat(oi.ctx, dgst); err == nil {
+		return nil
+	} else if err != distribution.ErrBlobUnknown {
+		return err
+	}
+
+	f, err := oi.open(ociBlobPath(dgst))
+	if err != nil {
+		return err
+	}
+
+	bw, err := blobs.Create(oi.ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(bw, f); err != nil {
+		bw.Cancel(oi.ctx)
+		return err
+	}
+
+	if _, err := bw.Commit(oi.ctx, distribution.Descriptor{Digest: dgst, Size: f.Size()}); err != nil {
+		bw.Cancel(oi.ctx)
+		return fmt.Errorf("failed to push blob %s: %v", dgst, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+)
+
+func TestOCILayoutExportImport(t *testing.T) {
+	src := newGCTestEnv(t)
+
+	first := src.repository(t, "foo/bar")
+	layers := uploadRandomLayers(t, first, 2)
+	firstDigest, _ := uploadSchema2Manifest(t, first, layers)
+	tagManifest(t, src, first, "latest", firstDigest)
+	tagManifest(t, src, first, "stable", firstDigest)
+
+	second := src.repository(t, "baz")
+	secondDigest := uploadSchema1Manifest(t, second, uploadRandomLayers(t, second, 2))
+	tagManifest(t, src, second, "v1", secondDigest)
+	tagManifest(t, src, second, "v2", secondDigest)
+
+	firstName, _ := reference.ParseNamed("foo/bar")
+	secondName, _ := reference.ParseNamed("baz:v1")
+
+	var archive bytes.Buffer
+	if err := ExportOCILayout(src.ctx, src.registry, &archive, []reference.Named{firstName, secondName}); err != nil {
+		t.Fatalf("unexpected error exporting: %v", err)
+	}
+
+	dst := newGCTestEnv(t)
+	imported, err := ImportOCILayout(dst.ctx, dst.registry, bytes.NewReader(archive.Bytes()), int64(archive.Len()), nil)
+	if err != nil {
+		t.Fatalf("unexpected error importing: %v", err)
+	}
+
+	var importedNames []string
+	for _, named := range imported {
+		importedNames = append(importedNames, named.String())
+	}
+	if len(importedNames) != 3 || importedNames[0] != "foo/bar:latest" || importedNames[1] != "foo/bar:stable" || importedNames[2] != "baz:v1" {
+		t.Fatalf("unexpected references imported: %v", importedNames)
+	}
+
+	checkTags(t, dst, dst.repository(t, "foo/bar"), "latest", "stable")
+	checkTags(t, dst, dst.repository(t, "baz"), "v1")
+	if !manifestExists(t, dst, dst.repository(t, "foo/bar"), firstDigest) {
+		t.Fatalf("manifest %s was not imported", firstDigest)
+	}
+	if !manifestExists(t, dst, dst.repository(t, "baz"), secondDigest) {
+		t.Fatalf("manifest %s was not imported", secondDigest)
+	}
+	for _, layer := range layers {
+		if _, err := dst.repository(t, "foo/bar").Blobs(dst.ctx).Stat(dst.ctx, layer.Digest); err != nil {
+			t.Fatalf("layer %s was not imported: %v", layer.Digest, err)
+		}
+	}
+	checkFsck(t, dst, FsckOpts{Verify: true})
+
+	// Importing again is a no-op
+	if _, err := ImportOCILayout(dst.ctx, dst.registry, bytes.NewReader(archive.Bytes()), int64(archive.Len()), nil); err != nil {
+		t.Fatalf("unexpected error importing again: %v", err)
+	}
+
+	// All images may be imported into a single repository
+	other := newGCTestEnv(t)
+	otherName, _ := reference.ParseNamed("other/repo")
+	if _, err := ImportOCILayout(other.ctx, other.registry, bytes.NewReader(archive.Bytes()), int64(archive.Len()), otherName); err != nil {
+		t.Fatalf("unexpected error importing into repository: %v", err)
+	}
+	checkTags(t, other, other.repository(t, "other/repo"), "latest", "stable", "v1")
+}
+
+func TestOCILayoutImportInvalid(t *testing.T) {
+	env := newGCTestEnv(t)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	index := []byte(`{"schemaVersion": 2, "manifests": []}`)
+	if err := tw.WriteHeader(&tar.Header{Name: ociIndexFile, Mode: 0644, Size: int64(len(index))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ImportOCILayout(env.ctx, env.registry, bytes.NewReader(archive.Bytes()), int64(archive.Len()), nil); err == nil {
+		t.Fatalf("expected error importing layout without %s", ociLayoutFile)
+	}
+}
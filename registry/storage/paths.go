@@ -42,8 +42,11 @@ const (
 // 						data
 // 						startedat
 // 						hashstates/<algorithm>/<offset>
+// 						chunks/<offset>
 //			-> blob/<algorithm>
 //				<split directory content addressable storage>
+//			-> referrers/<algorithm>
+//				<split directory index of the repositories referencing a blob>
 //
 // The storage backend layout is broken up into a content-addressable blob
 // store and repositories. The content-addressable blob store holds most data
@@ -74,6 +77,8 @@ const (
 //
 //	Manifests:
 //
+// 	manifestsPathSpec:             <root>/v2/repositories/<name>/_manifests/
+// 	manifestRevisionsPathSpec:     <root>/v2/repositories/<name>/_manifests/revisions/
 // 	manifestRevisionPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/
 // 	manifestRevisionLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/link
 // 	manifestSignaturesPathSpec:    <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/signatures/
@@ -90,20 +95,37 @@ const (
 //
 // 	Blobs:
 //
+// 	layersPathSpec:               <root>/v2/repositories/<name>/_layers/
 // 	layerLinkPathSpec:            <root>/v2/repositories/<name>/_layers/<algorithm>/<hex digest>/link
 //
 //	Uploads:
 //
+// 	uploadsPathSpec:                <root>/v2/repositories/<name>/_uploads/
 // 	uploadDataPathSpec:             <root>/v2/repositories/<name>/_uploads/<id>/data
 // 	uploadStartedAtPathSpec:        <root>/v2/repositories/<name>/_uploads/<id>/startedat
 // 	uploadHashStatePathSpec:        <root>/v2/repositories/<name>/_uploads/<id>/hashstates/<algorithm>/<offset>
+// 	uploadChunkPathSpec:            <root>/v2/repositories/<name>/_uploads/<id>/chunks/<offset>
+//
+//	Usage:
+//
+// 	repositoryUsagePathSpec:        <root>/v2/repositories/<name>/_usage/repository
+// 	namespaceUsagePathSpec:         <root>/v2/repositories/<namespace>/_usage/namespace
 //
 //	Blob Store:
 //
+// 	blobsPathSpec:                  <root>/v2/blobs/
 // 	blobPathSpec:                   <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>
 // 	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
+// 	blobFencedPathSpec:             <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/fenced
 // 	blobMediaTypePathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //
+//	Referrers:
+//
+// 	referrersRootPathSpec:          <root>/v2/referrers
+// 	referrersPathSpec:              <root>/v2/referrers/<algorithm>/<first two hex bytes of digest>/<hex digest>
+// 	referrerLinkPathSpec:           <root>/v2/referrers/<algorithm>/<first two hex bytes of digest>/<hex digest>/<name>/_link
+// 	referrerManifestLinkPathSpec:   <root>/v2/referrers/<algorithm>/<first two hex bytes of digest>/<hex digest>/<name>/_manifests/<algorithm>/<hex digest>/link
+//
 // For more information on the semantic meaning of each path and their
 // contents, please see the path spec documentation.
 func pathFor(spec pathSpec) (string, error) {
@@ -125,6 +147,11 @@ func pathFor(spec pathSpec) (string, error) {
 
 	switch v := spec.(type) {
 
+	case manifestsPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_manifests")...), nil
+	case manifestRevisionsPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_manifests", "revisions")...), nil
+
 	case manifestRevisionPathSpec:
 		components, err := digestPathComponents(v.revision, false)
 		if err != nil {
@@ -232,6 +259,8 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, path.Join(components...)), nil
+	case layersPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_layers")...), nil
 	case layerLinkPathSpec:
 		components, err := digestPathComponents(v.digest, false)
 		if err != nil {
@@ -246,6 +275,9 @@ func pathFor(spec pathSpec) (string, error) {
 		blobLinkPathComponents := append(repoPrefix, v.name, "_layers")
 
 		return path.Join(path.Join(append(blobLinkPathComponents, components...)...), "link"), nil
+	case blobsPathSpec:
+		blobsPathPrefix := append(rootPrefix, "blobs")
+		return path.Join(blobsPathPrefix...), nil
 	case blobDataPathSpec:
 		components, err := digestPathComponents(v.digest, true)
 		if err != nil {
@@ -255,7 +287,47 @@ func pathFor(spec pathSpec) (string, error) {
 		components = append(components, "data")
 		blobPathPrefix := append(rootPrefix, "blobs")
 		return path.Join(append(blobPathPrefix, components...)...), nil
+	case blobFencedPathSpec:
+		components, err := digestPathComponents(v.digest, true)
+		if err != nil {
+			return "", err
+		}
+
+		components = append(components, "fenced")
+		blobPathPrefix := append(rootPrefix, "blobs")
+		return path.Join(append(blobPathPrefix, components...)...), nil
+
+	case referrersRootPathSpec:
+		return path.Join(append(rootPrefix, "referrers")...), nil
+	case referrersPathSpec:
+		components, err := digestPathComponents(v.digest, true)
+		if err != nil {
+			return "", err
+		}
 
+		return path.Join(append(append(rootPrefix, "referrers"), components...)...), nil
+	case referrerLinkPathSpec:
+		root, err := pathFor(referrersPathSpec{digest: v.digest})
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, v.name, "_link"), nil
+	case referrerManifestLinkPathSpec:
+		root, err := pathFor(referrersPathSpec{digest: v.digest})
+		if err != nil {
+			return "", err
+		}
+
+		components, err := digestPathComponents(v.manifest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append([]string{root, v.name, "_manifests"}, components...), "link")...), nil
+
+	case uploadsPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_uploads")...), nil
 	case uploadDataPathSpec:
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "data")...), nil
 	case uploadStartedAtPathSpec:
@@ -266,6 +338,16 @@ func pathFor(spec pathSpec) (string, error) {
 			offset = "" // Limit to the prefix for listing offsets.
 		}
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "hashstates", string(v.alg), offset)...), nil
+	case uploadChunkPathSpec:
+		offset := fmt.Sprintf("%d", v.offset)
+		if v.list {
+			offset = "" // Limit to the prefix for listing offsets.
+		}
+		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "chunks", offset)...), nil
+	case repositoryUsagePathSpec:
+		return path.Join(append(repoPrefix, v.name, "_usage", "repository")...), nil
+	case namespaceUsagePathSpec:
+		return path.Join(append(repoPrefix, v.namespace, "_usage", "namespace")...), nil
 	case repositoriesRootPathSpec:
 		return path.Join(repoPrefix...), nil
 	default:
@@ -281,6 +363,22 @@ type pathSpec interface {
 	pathSpec()
 }
 
+// manifestsPathSpec describes the directory path for the manifest store of
+// a repository, holding both revisions and tags.
+type manifestsPathSpec struct {
+	name string
+}
+
+func (manifestsPathSpec) pathSpec() {}
+
+// manifestRevisionsPathSpec describes the directory path for the
+// revisions of all manifests in a repository.
+type manifestRevisionsPathSpec struct {
+	name string
+}
+
+func (manifestRevisionsPathSpec) pathSpec() {}
+
 // manifestRevisionPathSpec describes the components of the directory path for
 // a manifest revision.
 type manifestRevisionPathSpec struct {
@@ -376,6 +474,14 @@ type manifestTagIndexEntryLinkPathSpec struct {
 
 func (manifestTagIndexEntryLinkPathSpec) pathSpec() {}
 
+// layersPathSpec describes the directory containing the layer links of a
+// repository.
+type layersPathSpec struct {
+	name string
+}
+
+func (layersPathSpec) pathSpec() {}
+
 // blobLinkPathSpec specifies a path for a blob link, which is a file with a
 // blob id. The blob link will contain a content addressable blob id reference
 // into the blob store. The format of the contents is as follows:
@@ -411,6 +517,11 @@ var blobAlgorithmReplacer = strings.NewReplacer(
 
 // func (blobPathSpec) pathSpec() {}
 
+// blobsPathSpec contains the path for the blobs directory
+type blobsPathSpec struct{}
+
+func (blobsPathSpec) pathSpec() {}
+
 // blobDataPathSpec contains the path for the registry global blob store. For
 // now, this contains layer data, exclusively.
 type blobDataPathSpec struct {
@@ -419,6 +530,55 @@ type blobDataPathSpec struct {
 
 func (blobDataPathSpec) pathSpec() {}
 
+// blobFencedPathSpec contains the path the data of a blob is moved to while
+// an online garbage collection decides whether to remove it.
+type blobFencedPathSpec struct {
+	digest digest.Digest
+}
+
+func (blobFencedPathSpec) pathSpec() {}
+
+// referrersRootPathSpec returns the root of the referrer index.
+type referrersRootPathSpec struct{}
+
+func (referrersRootPathSpec) pathSpec() {}
+
+// referrersPathSpec describes the directory indexing the repositories which
+// link the blob or have manifests referencing it.
+type referrersPathSpec struct {
+	digest digest.Digest
+}
+
+func (referrersPathSpec) pathSpec() {}
+
+// referrerLinkPathSpec describes the index entry recording that the named
+// repository links the blob. The contents are the digest of the blob.
+type referrerLinkPathSpec struct {
+	digest digest.Digest
+	name   string
+}
+
+func (referrerLinkPathSpec) pathSpec() {}
+
+// referrerManifestLinkPathSpec describes the index entry recording that a
+// manifest revision of the named repository references the blob. The
+// contents are the digest of the manifest.
+type referrerManifestLinkPathSpec struct {
+	digest   digest.Digest
+	name     string
+	manifest digest.Digest
+}
+
+func (referrerManifestLinkPathSpec) pathSpec() {}
+
+// uploadsPathSpec describes the directory path for the uploads of a
+// repository.
+type uploadsPathSpec struct {
+	name string
+}
+
+func (uploadsPathSpec) pathSpec() {}
+
 // uploadDataPathSpec defines the path parameters of the data file for
 // uploads.
 type uploadDataPathSpec struct {
@@ -456,6 +616,35 @@ type uploadHashStatePathSpec struct {
 
 func (uploadHashStatePathSpec) pathSpec() {}
 
+// uploadChunkPathSpec defines the path parameters for the file that stores a
+// chunk of an upload written out of order, starting at a specific byte
+// offset. If `list` is set, then the path mapper will generate a list prefix
+// for all chunks of the upload identified by the name and id.
+type uploadChunkPathSpec struct {
+	name   string
+	id     string
+	offset int64
+	list   bool
+}
+
+func (uploadChunkPathSpec) pathSpec() {}
+
+// repositoryUsagePathSpec describes the path of the usage record of a
+// repository.
+type repositoryUsagePathSpec struct {
+	name string
+}
+
+func (repositoryUsagePathSpec) pathSpec() {}
+
+// namespaceUsagePathSpec describes the path of the usage record of a
+// top-level namespace, summing the usage of the repositories below it.
+type namespaceUsagePathSpec struct {
+	namespace string
+}
+
+func (namespaceUsagePathSpec) pathSpec() {}
+
 // repositoriesRootPathSpec returns the root of repositories
 type repositoriesRootPathSpec struct {
 }
@@ -10,6 +10,18 @@ func TestPathMapper(t *testing.T) {
 		expected string
 		err      error
 	}{
+		{
+			spec: manifestsPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests",
+		},
+		{
+			spec: manifestRevisionsPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/revisions",
+		},
 		{
 			spec: manifestRevisionPathSpec{
 				name:     "foo/bar",
@@ -82,7 +94,47 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/index/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
 		},
-
+		{
+			spec: layersPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_layers",
+		},
+		{
+			spec:     repositoryUsagePathSpec{name: "foo/bar"},
+			expected: "/docker/registry/v2/repositories/foo/bar/_usage/repository",
+		},
+		{
+			spec:     namespaceUsagePathSpec{namespace: "foo"},
+			expected: "/docker/registry/v2/repositories/foo/_usage/namespace",
+		},
+		{
+			spec: referrersPathSpec{
+				digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/referrers/sha256/ab/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+		},
+		{
+			spec: referrerLinkPathSpec{
+				digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				name:   "foo/bar",
+			},
+			expected: "/docker/registry/v2/referrers/sha256/ab/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/foo/bar/_link",
+		},
+		{
+			spec: referrerManifestLinkPathSpec{
+				digest:   "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				name:     "foo/bar",
+				manifest: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+			expected: "/docker/registry/v2/referrers/sha256/ab/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/foo/bar/_manifests/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef/link",
+		},
+		{
+			spec: uploadsPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_uploads",
+		},
 		{
 			spec: uploadDataPathSpec{
 				name: "foo/bar",
@@ -97,6 +149,22 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/asdf-asdf-asdf-adsf/startedat",
 		},
+		{
+			spec: uploadChunkPathSpec{
+				name:   "foo/bar",
+				id:     "asdf-asdf-asdf-adsf",
+				offset: 1024,
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/asdf-asdf-asdf-adsf/chunks/1024",
+		},
+		{
+			spec: uploadChunkPathSpec{
+				name: "foo/bar",
+				id:   "asdf-asdf-asdf-adsf",
+				list: true,
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/asdf-asdf-asdf-adsf/chunks",
+		},
 	} {
 		p, err := pathFor(testcase.spec)
 		if err != nil {
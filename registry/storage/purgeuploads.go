@@ -2,6 +2,7 @@ package storage
 
 import (
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -53,6 +54,53 @@ func PurgeUploads(ctx context.Context, driver storageDriver.StorageDriver, older
 	return deleted, errors
 }
 
+// Upload describes an upload in progress.
+type Upload struct {
+	// Name is the name of the repository the upload is for.
+	Name string `json:"name"`
+
+	// ID identifies the upload.
+	ID string `json:"id"`
+
+	// StartedAt is the time the upload was started.
+	StartedAt time.Time `json:"startedAt"`
+}
+
+type uploadsByStartedAt []Upload
+
+func (u uploadsByStartedAt) Len() int           { return len(u) }
+func (u uploadsByStartedAt) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u uploadsByStartedAt) Less(i, j int) bool { return u[i].StartedAt.Before(u[j].StartedAt) }
+
+// OutstandingUploads returns the uploads in progress, oldest first, along
+// with the errors encountered while walking the upload directories.
+func OutstandingUploads(ctx context.Context, driver storageDriver.StorageDriver) ([]Upload, []error) {
+	uploadData, errors := getOutstandingUploads(ctx, driver)
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, append(errors, err)
+	}
+
+	uploads := make([]Upload, 0, len(uploadData))
+	for id, ud := range uploadData {
+		if ud.containingDir == "" {
+			continue
+		}
+
+		// The containing directory is <root>/<name>/_uploads/<id>.
+		name := strings.TrimPrefix(path.Dir(path.Dir(ud.containingDir)), root+"/")
+		uploads = append(uploads, Upload{
+			Name:      name,
+			ID:        id,
+			StartedAt: ud.startedAt,
+		})
+	}
+	sort.Sort(uploadsByStartedAt(uploads))
+
+	return uploads, errors
+}
+
 // getOutstandingUploads walks the upload directory, collecting files
 // which could be eligible for deletion.  The only reliable way to
 // classify the age of a file is with the date stored in the startedAt
@@ -67,7 +115,7 @@ func getOutstandingUploads(ctx context.Context, driver storageDriver.StorageDriv
 		return uploads, append(errors, err)
 	}
 
-	err = Walk(ctx, driver, root, func(fileInfo storageDriver.FileInfo) error {
+	err = walkAll(ctx, driver, root, func(fileInfo storageDriver.FileInfo) error {
 		filePath := fileInfo.Path()
 		_, file := path.Split(filePath)
 		if file[0] == '_' {
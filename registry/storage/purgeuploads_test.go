@@ -53,6 +53,34 @@ func TestPurgeGather(t *testing.T) {
 	}
 }
 
+func TestOutstandingUploads(t *testing.T) {
+	oneHourAgo := time.Now().Add(-1 * time.Hour).Truncate(time.Second)
+	fs, ctx := testUploadFS(t, 0, "", oneHourAgo)
+
+	oldID := uuid.Generate().String()
+	addUploads(ctx, t, fs, oldID, "library/test-repo", oneHourAgo)
+	newID := uuid.Generate().String()
+	addUploads(ctx, t, fs, newID, "test-repo", oneHourAgo.Add(30*time.Minute))
+
+	uploads, errs := OutstandingUploads(ctx, fs)
+	if len(errs) != 0 {
+		t.Errorf("Unexepected errors: %q", errs)
+	}
+
+	expected := []Upload{
+		{Name: "library/test-repo", ID: oldID, StartedAt: oneHourAgo},
+		{Name: "test-repo", ID: newID, StartedAt: oneHourAgo.Add(30 * time.Minute)},
+	}
+	if len(uploads) != len(expected) {
+		t.Fatalf("Unexpected uploads: %v != %v", uploads, expected)
+	}
+	for i := range expected {
+		if uploads[i].Name != expected[i].Name || uploads[i].ID != expected[i].ID || !uploads[i].StartedAt.Equal(expected[i].StartedAt) {
+			t.Errorf("Unexpected upload %d: %v != %v", i, uploads[i], expected[i])
+		}
+	}
+}
+
 func TestPurgeNone(t *testing.T) {
 	fs, ctx := testUploadFS(t, 10, "test-repo", time.Now())
 	oneHourAgo := time.Now().Add(-1 * time.Hour)
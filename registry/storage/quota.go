@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"path"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+)
+
+// QuotaRule limits the number of bytes linked into the repositories, or
+// namespaces, whose name matches Pattern.
+type QuotaRule struct {
+	// Pattern is matched against names, in the syntax of path.Match.
+	Pattern string
+
+	// Limit is the maximum number of bytes which may be linked.
+	Limit int64
+}
+
+// Quotas returns a functional option for NewRegistry. It limits the bytes
+// linked into each repository to the limit of the first matching repository
+// rule, and the bytes linked into all repositories of a top-level namespace
+// to the limit of the first matching namespace rule. A repository without a
+// namespace component is only subject to repository rules.
+//
+// Blob uploads, blob mounts and manifest puts which would exceed a limit fail
+// with distribution.ErrQuotaExceeded. A blob counts once towards the usage of
+// each repository it is linked into. Usage is read from the records kept in
+// storage, so registry instances sharing the storage enforce the same limits.
+// As concurrent pushes are not serialized, limits may be exceeded by the
+// content of the pushes in flight, and concurrent pushes to the same
+// repository through several instances may leave its record short.
+func Quotas(repositories, namespaces []QuotaRule) RegistryOption {
+	return func(registry *registry) error {
+		for _, rule := range append(repositories, namespaces...) {
+			if _, err := path.Match(rule.Pattern, ""); err != nil {
+				return err
+			}
+		}
+
+		registry.repositoryQuotas = repositories
+		registry.namespaceQuotas = namespaces
+		return nil
+	}
+}
+
+// matchQuotaRule returns the first rule matching name.
+func matchQuotaRule(rules []QuotaRule, name string) (QuotaRule, bool) {
+	for _, rule := range rules {
+		if matched, _ := path.Match(rule.Pattern, name); matched {
+			return rule, true
+		}
+	}
+	return QuotaRule{}, false
+}
+
+// checkQuota returns distribution.ErrQuotaExceeded if linking desc into the
+// repository would exceed its quota, or the quota of its namespace. Content
+// already linked into the repository is not counted twice.
+func (lbs *linkedBlobStore) checkQuota(ctx context.Context, desc distribution.Descriptor) error {
+	if lbs.registry == nil || (len(lbs.registry.repositoryQuotas) == 0 && len(lbs.registry.namespaceQuotas) == 0) {
+		return nil
+	}
+
+	switch _, err := lbs.blobAccessController.Stat(ctx, desc.Digest); err {
+	case nil:
+		return nil // already linked
+	case distribution.ErrBlobUnknown:
+		break
+	default:
+		return err
+	}
+
+	name := lbs.repository.Name().Name()
+	if rule, ok := matchQuotaRule(lbs.registry.repositoryQuotas, name); ok {
+		usage, err := lbs.registry.usage.repositoryLinkedBytes(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if usage+desc.Size > rule.Limit {
+			return distribution.ErrQuotaExceeded{
+				Name:  name,
+				Limit: rule.Limit,
+				Usage: usage,
+				Size:  desc.Size,
+			}
+		}
+	}
+
+	namespace, ok := namespaceOf(name)
+	if !ok {
+		return nil
+	}
+
+	if rule, ok := matchQuotaRule(lbs.registry.namespaceQuotas, namespace); ok {
+		usage, err := lbs.registry.usage.namespaceLinkedBytes(ctx, namespace)
+		if err != nil {
+			return err
+		}
+
+		if usage+desc.Size > rule.Limit {
+			return distribution.ErrQuotaExceeded{
+				Name:      namespace,
+				Namespace: true,
+				Limit:     rule.Limit,
+				Usage:     usage,
+				Size:      desc.Size,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func newQuotaTestEnv(t *testing.T, repositories, namespaces []QuotaRule) *gcTestEnv {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry, err := NewRegistry(ctx, d, Quotas(repositories, namespaces))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	return &gcTestEnv{
+		ctx:      ctx,
+		driver:   d,
+		registry: registry,
+	}
+}
+
+func checkQuotaExceeded(t *testing.T, err error, name string, namespace bool) {
+	eqe, ok := err.(distribution.ErrQuotaExceeded)
+	if !ok {
+		t.Fatalf("expected ErrQuotaExceeded, got %#v", err)
+	}
+	if eqe.Name != name || eqe.Namespace != namespace {
+		t.Fatalf("unexpected quota error: %v", eqe)
+	}
+}
+
+func TestRepositoryQuota(t *testing.T) {
+	env := newQuotaTestEnv(t, []QuotaRule{{Pattern: "ci/*", Limit: 1000}}, nil)
+	repo := env.repository(t, "ci/app")
+
+	layer, err := pushBytes(env.ctx, repo, 'a', 600)
+	if err != nil {
+		t.Fatalf("unexpected error pushing first layer: %v", err)
+	}
+
+	_, err = pushBytes(env.ctx, repo, 'b', 600)
+	checkQuotaExceeded(t, err, "ci/app", false)
+
+	// Pushing a blob already linked into the repository is not counted twice.
+	if _, err := pushBytes(env.ctx, repo, 'a', 600); err != nil {
+		t.Fatalf("unexpected error pushing linked layer: %v", err)
+	}
+
+	// The same blob in another repository counts towards its own quota.
+	other := env.repository(t, "ci/other")
+	if _, err := pushBytes(env.ctx, other, 'a', 600); err != nil {
+		t.Fatalf("unexpected error pushing layer into other repository: %v", err)
+	}
+
+	// Repositories matching no rule are unlimited.
+	unlimited := env.repository(t, "library/app")
+	if _, err := pushBytes(env.ctx, unlimited, 'c', 2000); err != nil {
+		t.Fatalf("unexpected error pushing into unlimited repository: %v", err)
+	}
+
+	// Mounting counts towards the quota of the target repository.
+	source, err := reference.WithDigest(unlimited.Name(), digest.FromBytes(bytes.Repeat([]byte{'c'}, 2000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.Blobs(env.ctx).Create(env.ctx, WithMountFrom(source))
+	checkQuotaExceeded(t, err, "ci/app", false)
+
+	// Manifests are counted, too.
+	config, err := repo.Blobs(env.ctx).Put(env.ctx, schema2.MediaTypeConfig, bytes.Repeat([]byte{' '}, 390))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 2,
+			MediaType:     schema2.MediaTypeManifest,
+		},
+		Config: config,
+		Layers: []distribution.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building manifest: %v", err)
+	}
+
+	manifests, err := repo.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = manifests.Put(env.ctx, m)
+	checkQuotaExceeded(t, err, "ci/app", false)
+}
+
+func TestNamespaceQuota(t *testing.T) {
+	env := newQuotaTestEnv(t, nil, []QuotaRule{{Pattern: "*", Limit: 1000}})
+	first := env.repository(t, "team/first")
+	second := env.repository(t, "team/second")
+
+	if _, err := pushBytes(env.ctx, first, 'a', 600); err != nil {
+		t.Fatalf("unexpected error pushing first layer: %v", err)
+	}
+
+	// A blob counts once per repository it is linked into.
+	_, err := pushBytes(env.ctx, second, 'a', 600)
+	checkQuotaExceeded(t, err, "team", true)
+
+	if _, err := pushBytes(env.ctx, second, 'b', 400); err != nil {
+		t.Fatalf("unexpected error pushing layer within quota: %v", err)
+	}
+
+	// Other namespaces have a quota of their own.
+	if _, err := pushBytes(env.ctx, env.repository(t, "other/app"), 'a', 600); err != nil {
+		t.Fatalf("unexpected error pushing into other namespace: %v", err)
+	}
+
+	// Repositories without a namespace are not subject to namespace quotas.
+	if _, err := pushBytes(env.ctx, env.repository(t, "app"), 'c', 2000); err != nil {
+		t.Fatalf("unexpected error pushing into repository without namespace: %v", err)
+	}
+}
+
+func TestQuotaSharedByInstances(t *testing.T) {
+	env := newQuotaTestEnv(t, []QuotaRule{{Pattern: "ci/*", Limit: 1000}}, []QuotaRule{{Pattern: "*", Limit: 1500}})
+	if _, err := pushBytes(env.ctx, env.repository(t, "ci/app"), 'a', 600); err != nil {
+		t.Fatalf("unexpected error pushing first layer: %v", err)
+	}
+
+	// Another instance using the same storage, such as a replica or the
+	// same registry after a restart, sees the usage of the first.
+	replica, err := NewRegistry(env.ctx, env.driver, Quotas(
+		[]QuotaRule{{Pattern: "ci/*", Limit: 1000}},
+		[]QuotaRule{{Pattern: "*", Limit: 1500}},
+	))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	replicaEnv := &gcTestEnv{ctx: env.ctx, driver: env.driver, registry: replica}
+
+	_, err = pushBytes(env.ctx, replicaEnv.repository(t, "ci/app"), 'b', 600)
+	checkQuotaExceeded(t, err, "ci/app", false)
+
+	if _, err := pushBytes(env.ctx, replicaEnv.repository(t, "ci/other"), 'b', 600); err != nil {
+		t.Fatalf("unexpected error pushing into other repository: %v", err)
+	}
+
+	_, err = pushBytes(env.ctx, env.repository(t, "ci/third"), 'c', 600)
+	checkQuotaExceeded(t, err, "ci", true)
+}
@@ -0,0 +1,425 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+var _ distribution.BlobReferrerIndexer = &registry{}
+
+// linkKind identifies the link set of a repository a linkedBlobStore writes
+// to, for the purpose of indexing referrers and accounting for usage.
+type linkKind int
+
+const (
+	// untrackedLink links are neither indexed nor accounted for, such as tag
+	// index entries.
+	untrackedLink linkKind = iota
+
+	// layerLink links live under _layers.
+	layerLink
+
+	// manifestLink links live under _manifests/revisions.
+	manifestLink
+)
+
+// The referrer index records, for each blob, the repositories linking it and
+// the manifest revisions referencing it. Entries are written as blobs are
+// linked and manifests are put, and removed when a blob is unlinked. Since
+// other removals, such as manifest deletes and renames, leave entries
+// behind, every entry is checked against the repository when read.
+
+// Referrers returns the repositories which link the blob or have manifests
+// referencing it, according to the referrer index. Content pushed before
+// the index was introduced is only found once IndexReferrers has been run.
+func (reg *registry) Referrers(ctx context.Context, dgst digest.Digest) ([]distribution.BlobReferrer, error) {
+	root, err := pathFor(referrersPathSpec{digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	referrers := make(map[string]*distribution.BlobReferrer)
+	referrer := func(name string) *distribution.BlobReferrer {
+		r, ok := referrers[name]
+		if !ok {
+			r = &distribution.BlobReferrer{Name: name, Manifests: []digest.Digest{}}
+			referrers[name] = r
+		}
+		return r
+	}
+
+	err = walkAll(ctx, reg.blobStore.driver, root, func(fileInfo driver.FileInfo) error {
+		filePath := fileInfo.Path()
+		name, file := path.Split(filePath[len(root)+1:])
+		name = strings.TrimSuffix(name, "/")
+
+		switch {
+		case file == "_link" && !fileInfo.IsDir():
+			linked, err := reg.linked(ctx, name, dgst)
+			if err != nil {
+				return err
+			}
+			if linked {
+				referrer(name).Linked = true
+			}
+		case file == "_manifests" && fileInfo.IsDir():
+			manifests, err := reg.indexedManifests(ctx, name, filePath)
+			if err != nil {
+				return err
+			}
+			if len(manifests) > 0 {
+				r := referrer(name)
+				r.Manifests = append(r.Manifests, manifests...)
+			}
+			return ErrSkipDir
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
+	if len(referrers) == 0 {
+		return nil, distribution.ErrBlobUnknown
+	}
+
+	result := make([]distribution.BlobReferrer, 0, len(referrers))
+	for _, r := range referrers {
+		result = append(result, *r)
+	}
+	sort.Sort(referrersByName(result))
+
+	return result, nil
+}
+
+// linkingRepositories returns the repositories other than exclude which
+// link the blob, according to the referrer index.
+func (reg *registry) linkingRepositories(ctx context.Context, dgst digest.Digest, exclude string) ([]string, error) {
+	root, err := pathFor(referrersPathSpec{digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err = walkAll(ctx, reg.blobStore.driver, root, func(fileInfo driver.FileInfo) error {
+		filePath := fileInfo.Path()
+		name, file := path.Split(filePath[len(root)+1:])
+		name = strings.TrimSuffix(name, "/")
+
+		switch {
+		case file == "_link" && !fileInfo.IsDir():
+			if name == exclude {
+				return nil
+			}
+			linked, err := reg.linked(ctx, name, dgst)
+			if err != nil {
+				return err
+			}
+			if linked {
+				names = append(names, name)
+			}
+		case file == "_manifests" && fileInfo.IsDir():
+			return ErrSkipDir
+		}
+
+		return nil
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+	return names, err
+}
+
+// referencingManifests returns the manifest revisions of the named
+// repository which reference the blob. The referrer index is used when it
+// records that the repository links the blob: the entry is written when the
+// blob is first linked, after which any manifest referencing it is indexed
+// as it is put. Otherwise, as for content pushed before the index was
+// introduced, every manifest revision of the repository is read.
+func (reg *registry) referencingManifests(ctx context.Context, name string, dgst digest.Digest) ([]digest.Digest, error) {
+	linkPath, err := pathFor(referrerLinkPathSpec{digest: dgst, name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	indexed, err := exists(ctx, reg.blobStore.driver, linkPath)
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		return reg.scanReferencingManifests(ctx, name, dgst)
+	}
+
+	root, err := pathFor(referrersPathSpec{digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := reg.indexedManifests(ctx, name, path.Join(root, name, "_manifests"))
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+	return manifests, err
+}
+
+// scanReferencingManifests returns the manifest revisions of the named
+// repository which reference the blob, either as a layer, a schema2
+// configuration or a manifest list entry. Every revision is read, so the
+// cost grows with the number of manifests in the repository.
+func (reg *registry) scanReferencingManifests(ctx context.Context, name string, dgst digest.Digest) ([]digest.Digest, error) {
+	named, err := reference.ParseNamed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := reg.Repository(ctx, named)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestService, err := repo.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+	}
+
+	var manifests []digest.Digest
+	err = manifestEnumerator.Enumerate(ctx, func(manifestDigest digest.Digest) error {
+		manifest, err := manifestService.Get(ctx, manifestDigest)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve manifest for digest %v: %v", manifestDigest, err)
+		}
+
+		for _, descriptor := range manifestReferences(manifest) {
+			if descriptor.Digest == dgst {
+				manifests = append(manifests, manifestDigest)
+				break
+			}
+		}
+
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+
+	return manifests, err
+}
+
+// indexedManifests returns the manifest revisions recorded under dir, the
+// _manifests directory of the named repository in the index of a blob, which
+// still exist in the repository.
+func (reg *registry) indexedManifests(ctx context.Context, name, dir string) ([]digest.Digest, error) {
+	var manifests []digest.Digest
+	err := walkAll(ctx, reg.blobStore.driver, dir, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		manifestDigest, err := reg.blobStore.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		revisionPath, err := manifestRevisionLinkPath(name, manifestDigest)
+		if err != nil {
+			return err
+		}
+
+		ok, err := exists(ctx, reg.blobStore.driver, revisionPath)
+		if err != nil {
+			return err
+		}
+		if ok {
+			manifests = append(manifests, manifestDigest)
+		}
+		return nil
+	})
+
+	return manifests, err
+}
+
+type referrersByName []distribution.BlobReferrer
+
+func (r referrersByName) Len() int           { return len(r) }
+func (r referrersByName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r referrersByName) Less(i, j int) bool { return r[i].Name < r[j].Name }
+
+// IndexReferrers records the layer links and manifest revisions of every
+// repository in the referrer index of the registry, which must be backed by
+// this package. It allows finding content pushed before the index was
+// introduced and may be run while the registry is serving requests.
+func IndexReferrers(ctx context.Context, namespace distribution.Namespace) error {
+	reg, ok := namespace.(*registry)
+	if !ok {
+		return fmt.Errorf("unable to index referrers of %T", namespace)
+	}
+
+	return reg.Enumerate(ctx, func(name string) error {
+		context.GetLogger(ctx).Infof("indexing referrers of %s", name)
+		return reg.indexRepository(ctx, name)
+	})
+}
+
+// indexRepository records the layer links and manifest revisions of the
+// named repository in the referrer index. Manifests are indexed before
+// layers, as the index entry of a layer marks its referencing manifests as
+// indexed.
+func (reg *registry) indexRepository(ctx context.Context, name string) error {
+	named, err := reference.ParseNamed(name)
+	if err != nil {
+		return err
+	}
+
+	repo, err := reg.Repository(ctx, named)
+	if err != nil {
+		return err
+	}
+
+	manifestService, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+
+	manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+	}
+
+	err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		if err := reg.indexLink(ctx, name, dgst); err != nil {
+			return err
+		}
+
+		manifest, err := manifestService.Get(ctx, dgst)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+		}
+
+		return reg.indexManifest(ctx, name, dgst, manifest)
+	})
+	if err != nil {
+		return err
+	}
+
+	layersPath, err := pathFor(layersPathSpec{name: name})
+	if err != nil {
+		return err
+	}
+
+	err = walkAll(ctx, reg.blobStore.driver, layersPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		dgst, err := reg.blobStore.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		return reg.indexLink(ctx, name, dgst)
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// indexLink records that the named repository links the blob.
+func (reg *registry) indexLink(ctx context.Context, name string, dgst digest.Digest) error {
+	linkPath, err := pathFor(referrerLinkPathSpec{digest: dgst, name: name})
+	if err != nil {
+		return err
+	}
+
+	return reg.blobStore.link(ctx, linkPath, dgst)
+}
+
+// unindexLink removes the record that the named repository links the blob,
+// unless the blob is still linked, as a manifest or as a layer.
+func (reg *registry) unindexLink(ctx context.Context, name string, dgst digest.Digest) error {
+	linked, err := reg.linked(ctx, name, dgst)
+	if err != nil || linked {
+		return err
+	}
+
+	linkPath, err := pathFor(referrerLinkPathSpec{digest: dgst, name: name})
+	if err != nil {
+		return err
+	}
+
+	if err := reg.blobStore.driver.Delete(ctx, linkPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexManifest records that the manifest revision of the named repository
+// references each of its dependencies.
+func (reg *registry) indexManifest(ctx context.Context, name string, manifestDigest digest.Digest, manifest distribution.Manifest) error {
+	for _, desc := range manifestReferences(manifest) {
+		linkPath, err := pathFor(referrerManifestLinkPathSpec{
+			digest:   desc.Digest,
+			name:     name,
+			manifest: manifestDigest,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := reg.blobStore.link(ctx, linkPath, manifestDigest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linked reports whether the blob is linked into the named repository,
+// either as a layer or as a manifest revision.
+func (reg *registry) linked(ctx context.Context, name string, dgst digest.Digest) (bool, error) {
+	for _, linkPathFn := range []linkPathFunc{blobLinkPath, manifestRevisionLinkPath} {
+		linkPath, err := linkPathFn(name, dgst)
+		if err != nil {
+			return false, err
+		}
+
+		ok, err := exists(ctx, reg.blobStore.driver, linkPath)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+// manifestReferences returns the blobs the manifest depends on: its
+// references and, for schema2 manifests, the configuration.
+func manifestReferences(manifest distribution.Manifest) []distribution.Descriptor {
+	references := manifest.References()
+	if m, ok := manifest.(*schema2.DeserializedManifest); ok {
+		references = append(references[:len(references):len(references)], m.Config)
+	}
+	return references
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+)
+
+// pushBytes uploads a blob of size n filled with fill into repo.
+func pushBytes(ctx context.Context, repo distribution.Repository, fill byte, n int) (distribution.Descriptor, error) {
+	p := bytes.Repeat([]byte{fill}, n)
+	desc := distribution.Descriptor{Digest: digest.FromBytes(p), Size: int64(n)}
+	return addBlob(ctx, repo.Blobs(ctx), desc, bytes.NewReader(p))
+}
+
+func checkReferrers(t *testing.T, env *gcTestEnv, dgst digest.Digest, expected []distribution.BlobReferrer) {
+	referrers, err := env.registry.(distribution.BlobReferrerIndexer).Referrers(env.ctx, dgst)
+	if len(expected) == 0 {
+		if err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected unknown blob error for %s, got %v, %v", dgst, referrers, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error getting referrers of %s: %v", dgst, err)
+	}
+
+	if !reflect.DeepEqual(referrers, expected) {
+		t.Fatalf("unexpected referrers of %s: %#v != %#v", dgst, referrers, expected)
+	}
+}
+
+func TestReferrers(t *testing.T) {
+	env := newGCTestEnv(t)
+	first := env.repository(t, "foo/first")
+	second := env.repository(t, "foo/second")
+
+	layer, err := pushBytes(env.ctx, first, 'a', 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pushBytes(env.ctx, second, 'a', 100); err != nil {
+		t.Fatal(err)
+	}
+
+	dgst, m := uploadSchema2Manifest(t, first, []distribution.Descriptor{layer})
+
+	checkReferrers(t, env, layer.Digest, []distribution.BlobReferrer{
+		{Name: "foo/first", Linked: true, Manifests: []digest.Digest{dgst}},
+		{Name: "foo/second", Linked: true, Manifests: []digest.Digest{}},
+	})
+	checkReferrers(t, env, m.Config.Digest, []distribution.BlobReferrer{
+		{Name: "foo/first", Linked: true, Manifests: []digest.Digest{dgst}},
+	})
+	checkReferrers(t, env, dgst, []distribution.BlobReferrer{
+		{Name: "foo/first", Linked: true, Manifests: []digest.Digest{}},
+	})
+	checkReferrers(t, env, digest.FromBytes([]byte("unknown")), nil)
+
+	// Unlinked layers and deleted manifests are no longer reported.
+	if err := second.Blobs(env.ctx).Delete(env.ctx, layer.Digest); err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := first.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manifests.Delete(env.ctx, dgst); err != nil {
+		t.Fatal(err)
+	}
+
+	checkReferrers(t, env, layer.Digest, []distribution.BlobReferrer{
+		{Name: "foo/first", Linked: true, Manifests: []digest.Digest{}},
+	})
+	checkReferrers(t, env, dgst, nil)
+}
+
+func TestIndexReferrers(t *testing.T) {
+	env := newGCTestEnv(t)
+	first := env.repository(t, "foo/first")
+
+	layer, err := pushBytes(env.ctx, first, 'a', 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, _ := uploadSchema2Manifest(t, first, []distribution.Descriptor{layer})
+
+	// Content pushed without the index is found once indexed.
+	root, err := pathFor(referrersPathSpec{digest: layer.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.driver.Delete(env.ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	checkReferrers(t, env, layer.Digest, nil)
+
+	if err := IndexReferrers(env.ctx, env.registry); err != nil {
+		t.Fatalf("unexpected error indexing referrers: %v", err)
+	}
+
+	expected := []distribution.BlobReferrer{
+		{Name: "foo/first", Linked: true, Manifests: []digest.Digest{dgst}},
+	}
+	checkReferrers(t, env, layer.Digest, expected)
+
+	// Renamed repositories are indexed under their new name.
+	from, err := reference.ParseNamed("foo/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := reference.ParseNamed("bar/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.registry.(distribution.RepositoryRenamer).Rename(env.ctx, from, to); err != nil {
+		t.Fatalf("unexpected error renaming: %v", err)
+	}
+
+	expected[0].Name = "bar/first"
+	checkReferrers(t, env, layer.Digest, expected)
+}
@@ -17,6 +17,10 @@ type registry struct {
 	blobDescriptorCacheProvider cache.BlobDescriptorCacheProvider
 	deleteEnabled               bool
 	resumableDigestEnabled      bool
+	repositoryQuotas            []QuotaRule
+	namespaceQuotas             []QuotaRule
+	immutableTags               []ImmutableTagRule
+	usage                       *usageTracker
 }
 
 // RegistryOption is the type used for functional options for NewRegistry.
@@ -88,6 +92,7 @@ func NewRegistry(ctx context.Context, driver storagedriver.StorageDriver, option
 		statter:                statter,
 		resumableDigestEnabled: true,
 	}
+	registry.usage = newUsageTracker(driver, registry)
 
 	for _, option := range options {
 		if err := option(registry); err != nil {
@@ -160,9 +165,11 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 
 	blobStore := &linkedBlobStore{
 		ctx:           ctx,
+		registry:      repo.registry,
 		blobStore:     repo.blobStore,
 		repository:    repo,
 		deleteEnabled: repo.registry.deleteEnabled,
+		linkKind:      manifestLink,
 		blobAccessController: &linkedBlobStatter{
 			blobStore:   repo.blobStore,
 			repository:  repo,
@@ -236,6 +243,7 @@ func (repo *repository) Blobs(ctx context.Context) distribution.BlobStore {
 		// TODO(stevvooe): linkPath limits this blob store to only layers.
 		// This instance cannot be used for manifest checks.
 		linkPathFns:            []linkPathFunc{blobLinkPath},
+		linkKind:               layerLink,
 		deleteEnabled:          repo.registry.deleteEnabled,
 		resumableDigestEnabled: repo.resumableDigestEnabled,
 	}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+var _ distribution.RepositoryRenamer = &registry{}
+
+// Rename moves the repository from to the name to. The layer links and the
+// manifest store, including revisions, signatures and tags, are relinked
+// under the new name; no blob data is copied. Uploads in progress in from are
+// discarded. Repositories nested below from, such as from/child, are not
+// affected.
+//
+// As from is removed, renaming fails with distribution.ErrUnsupported unless
+// deletes are enabled. Renaming is not atomic and must not race with pushes
+// to either repository. If it fails, to may be partially populated while
+// from is left intact.
+func (reg *registry) Rename(ctx context.Context, from, to reference.Named) error {
+	if !reg.deleteEnabled {
+		return distribution.ErrUnsupported
+	}
+
+	fromName, toName := from.Name(), to.Name()
+	if fromName == toName {
+		return distribution.ErrRepositoryExists{Name: toName}
+	}
+
+	exists, err := reg.repositoryExists(ctx, fromName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return distribution.ErrRepositoryUnknown{Name: fromName}
+	}
+
+	exists, err = reg.repositoryExists(ctx, toName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return distribution.ErrRepositoryExists{Name: toName}
+	}
+
+	linked := make(map[digest.Digest]struct{})
+	for _, specs := range [][2]pathSpec{
+		{layersPathSpec{name: fromName}, layersPathSpec{name: toName}},
+		{manifestsPathSpec{name: fromName}, manifestsPathSpec{name: toName}},
+	} {
+		if err := reg.relink(ctx, specs[0], specs[1], linked); err != nil {
+			return err
+		}
+	}
+
+	if err := reg.indexRepository(ctx, toName); err != nil {
+		return err
+	}
+
+	for _, spec := range []pathSpec{
+		layersPathSpec{name: fromName},
+		manifestsPathSpec{name: fromName},
+		uploadsPathSpec{name: fromName},
+	} {
+		p, err := pathFor(spec)
+		if err != nil {
+			return err
+		}
+
+		if err := reg.blobStore.driver.Delete(ctx, p); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+		}
+	}
+
+	// Forget the descriptors cached for the old name, so that its content
+	// is no longer served.
+	if reg.blobDescriptorCacheProvider != nil {
+		descriptorCache, err := reg.blobDescriptorCacheProvider.RepositoryScoped(fromName)
+		if err != nil {
+			return err
+		}
+
+		for dgst := range linked {
+			if err := descriptorCache.Clear(ctx, dgst); err != nil && err != distribution.ErrBlobUnknown {
+				context.GetLogger(ctx).Errorf("error clearing cached descriptor %s of %s: %v", dgst, fromName, err)
+			}
+		}
+	}
+
+	// The usage records of both repositories, and of their namespaces, are
+	// counted again when next needed.
+	reg.usage.invalidate(ctx, fromName)
+	reg.usage.invalidate(ctx, toName)
+	return nil
+}
+
+// relink recreates every link found under the path of src at the same
+// relative location under the path of dst, adding the digests they
+// reference to linked.
+func (reg *registry) relink(ctx context.Context, src, dst pathSpec, linked map[digest.Digest]struct{}) error {
+	srcPath, err := pathFor(src)
+	if err != nil {
+		return err
+	}
+
+	dstPath, err := pathFor(dst)
+	if err != nil {
+		return err
+	}
+
+	storageDriver := reg.blobStore.driver
+	err = walkAll(ctx, storageDriver, srcPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+
+		content, err := storageDriver.GetContent(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		if dgst, err := digest.ParseDigest(string(content)); err == nil {
+			linked[dgst] = struct{}{}
+		}
+
+		return storageDriver.PutContent(ctx, dstPath+fileInfo.Path()[len(srcPath):], content)
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
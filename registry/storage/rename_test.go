@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/cache/memory"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestRename(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry, err := NewRegistry(ctx, d, EnableDelete, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	env := &gcTestEnv{ctx: ctx, driver: d, registry: registry}
+
+	from := env.repository(t, "team/app")
+	layers := uploadRandomLayers(t, from, 2)
+	dgst, _ := uploadSchema2Manifest(t, from, layers)
+	tagManifest(t, env, from, "latest", dgst)
+
+	// Populate the descriptor cache of the old name
+	for _, layer := range layers {
+		if _, err := from.Blobs(ctx).Stat(ctx, layer.Digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	child := env.repository(t, "team/app/child")
+	childLayers := uploadRandomLayers(t, child, 1)
+
+	usageReporter := registry.(distribution.UsageReporter)
+	before, err := usageReporter.Usage(ctx, from.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamer := registry.(distribution.RepositoryRenamer)
+	toName, _ := reference.ParseNamed("other/app")
+
+	// Without deletes enabled, from may not be removed
+	noDelete, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	if err := noDelete.(distribution.RepositoryRenamer).Rename(ctx, from.Name(), toName); err != distribution.ErrUnsupported {
+		t.Fatalf("expected ErrUnsupported renaming without deletes, got %v", err)
+	}
+	if !manifestExists(t, env, from, dgst) {
+		t.Fatalf("manifest removed by refused rename")
+	}
+
+	unknown, _ := reference.ParseNamed("team/unknown")
+	if err := renamer.Rename(ctx, unknown, toName); err == nil {
+		t.Fatalf("expected error renaming unknown repository")
+	} else if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Fatalf("unexpected error renaming unknown repository: %v", err)
+	}
+
+	if err := renamer.Rename(ctx, from.Name(), child.Name()); err == nil {
+		t.Fatalf("expected error renaming to existing repository")
+	} else if _, ok := err.(distribution.ErrRepositoryExists); !ok {
+		t.Fatalf("unexpected error renaming to existing repository: %v", err)
+	}
+
+	if err := renamer.Rename(ctx, from.Name(), toName); err != nil {
+		t.Fatalf("unexpected error renaming repository: %v", err)
+	}
+
+	to := env.repository(t, "other/app")
+	desc, err := to.Tags(ctx).Get(ctx, "latest")
+	if err != nil {
+		t.Fatalf("unexpected error getting tag of renamed repository: %v", err)
+	}
+	if desc.Digest != dgst {
+		t.Fatalf("unexpected tag digest: %v != %v", desc.Digest, dgst)
+	}
+	if !manifestExists(t, env, to, dgst) {
+		t.Fatalf("manifest missing from renamed repository")
+	}
+	for _, layer := range layers {
+		if _, err := to.Blobs(ctx).Stat(ctx, layer.Digest); err != nil {
+			t.Fatalf("layer %s missing from renamed repository: %v", layer.Digest, err)
+		}
+		if _, err := from.Blobs(ctx).Stat(ctx, layer.Digest); err != distribution.ErrBlobUnknown {
+			t.Fatalf("layer %s still served by old repository: %v", layer.Digest, err)
+		}
+	}
+
+	if _, err := from.Tags(ctx).All(ctx); err == nil {
+		t.Fatalf("expected old repository to be unknown")
+	}
+
+	// The accounting state follows the repository
+	if _, err := usageReporter.Usage(ctx, from.Name()); err == nil {
+		t.Fatalf("expected error getting usage of old repository")
+	}
+	checkUsage(t, env, "other/app", before)
+
+	// Nested repositories are left in place
+	if _, err := child.Blobs(ctx).Stat(ctx, childLayers[0].Digest); err != nil {
+		t.Fatalf("nested repository lost its layer: %v", err)
+	}
+
+	var repos []string
+	err = registry.(distribution.RepositoryEnumerator).Enumerate(ctx, func(name string) error {
+		repos = append(repos, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 || repos[0] != "other/app" || repos[1] != "team/app/child" {
+		t.Fatalf("unexpected repositories after rename: %v", repos)
+	}
+}
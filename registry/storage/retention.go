@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	storageDriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// RetentionPolicy describes which tags are kept in the repositories whose
+// name matches Repository.
+//
+// Tags matching Keep and the KeepLast most recently updated tags are always
+// kept. When MaxAge is set, the remaining tags are removed once they have not
+// been updated for MaxAge. Otherwise, the remaining tags are removed as soon
+// as KeepLast is exceeded. A policy with neither KeepLast nor MaxAge set
+// removes nothing.
+type RetentionPolicy struct {
+	// Repository is a pattern, in the syntax of path.Match, matched against
+	// repository names.
+	Repository string
+
+	// KeepLast is the number of most recently updated tags which are kept.
+	KeepLast int
+
+	// MaxAge is the age after which a tag is eligible for removal.
+	MaxAge time.Duration
+
+	// Keep, if non-nil, matches tags which are never removed.
+	Keep *regexp.Regexp
+}
+
+// matches reports whether the policy applies to the named repository.
+func (p RetentionPolicy) matches(repoName string) bool {
+	matched, err := path.Match(p.Repository, repoName)
+	return err == nil && matched
+}
+
+// taggedRevision is a tag along with the time it was last updated.
+type taggedRevision struct {
+	tag       string
+	updatedAt time.Time
+}
+
+// EnforceRetention removes the tags selected by policies from every
+// repository in the registry. Each repository is subject to the first policy
+// whose pattern matches its name. Once untagged, a manifest is deleted unless
+// another tag, or a manifest list, still refers to it. Immutable tags are
+// kept, like those matching Keep. The manifests are only deleted if the
+// registry has deletes enabled. The list of removed tags, in the form
+// name:tag, and errors encountered are returned.
+func EnforceRetention(ctx context.Context, driver storageDriver.StorageDriver, registry distribution.Namespace, policies []RetentionPolicy, actuallyDelete bool) ([]string, []error) {
+	log.Infof("EnforceRetention starting: policies=%d, actuallyDelete=%t", len(policies), actuallyDelete)
+
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, []error{fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")}
+	}
+
+	var removed []string
+	var errors []error
+	now := time.Now()
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		for _, policy := range policies {
+			if !policy.matches(repoName) {
+				continue
+			}
+
+			tags, errs := enforceRetentionPolicy(ctx, driver, registry, repoName, policy, now, actuallyDelete)
+			removed = append(removed, tags...)
+			errors = append(errors, errs...)
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		errors = append(errors, err)
+	}
+
+	log.Infof("EnforceRetention finished.  Num removed=%d, num errors=%d", len(removed), len(errors))
+	return removed, errors
+}
+
+// enforceRetentionPolicy applies policy to a single repository.
+func enforceRetentionPolicy(ctx context.Context, driver storageDriver.StorageDriver, registry distribution.Namespace, repoName string, policy RetentionPolicy, now time.Time, actuallyDelete bool) ([]string, []error) {
+	if policy.KeepLast <= 0 && policy.MaxAge <= 0 {
+		return nil, nil
+	}
+
+	named, err := reference.ParseNamed(repoName)
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to parse repo name %s: %v", repoName, err)}
+	}
+
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	tagService := repository.Tags(ctx)
+	tags, err := tagService.All(ctx)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			return nil, nil
+		}
+		return nil, []error{err}
+	}
+
+	revisions := make([]taggedRevision, 0, len(tags))
+	for _, tag := range tags {
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{name: repoName, tag: tag})
+		if err != nil {
+			return nil, []error{err}
+		}
+
+		fi, err := driver.Stat(ctx, currentPath)
+		if err != nil {
+			if _, ok := err.(storageDriver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, []error{err}
+		}
+
+		revisions = append(revisions, taggedRevision{tag: tag, updatedAt: fi.ModTime()})
+	}
+
+	sort.Sort(byUpdatedAtDesc(revisions))
+
+	var removed []string
+	var errors []error
+	kept := 0
+	for _, revision := range revisions {
+		if policy.Keep != nil && policy.Keep.MatchString(revision.tag) {
+			continue
+		}
+
+		if immutableTag(repository, revision.tag) {
+			continue
+		}
+
+		if kept < policy.KeepLast {
+			kept++
+			continue
+		}
+
+		if policy.MaxAge > 0 && now.Sub(revision.updatedAt) < policy.MaxAge {
+			continue
+		}
+
+		log.Infof("Tag %s:%s was last updated at %s.  Removing tag.", repoName, revision.tag, revision.updatedAt)
+		if actuallyDelete {
+			if err := untagAndDelete(ctx, repository, revision.tag); err != nil {
+				errors = append(errors, err)
+				continue
+			}
+		}
+		removed = append(removed, repoName+":"+revision.tag)
+	}
+
+	return removed, errors
+}
+
+// untagAndDelete removes tag from repository, then deletes the manifest it
+// referred to if no other tag, nor another manifest of the repository,
+// refers to it.
+func untagAndDelete(ctx context.Context, repository distribution.Repository, tag string) error {
+	tagService := repository.Tags(ctx)
+	desc, err := tagService.Get(ctx, tag)
+	if err != nil {
+		return err
+	}
+
+	if err := tagService.Untag(ctx, tag); err != nil {
+		return err
+	}
+
+	remaining, err := tagService.Lookup(ctx, desc)
+	if err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return nil
+	}
+
+	// A manifest list referencing the manifest would be broken.
+	referenced, err := referencedByManifest(ctx, repository, desc.Digest)
+	if err != nil || referenced {
+		return err
+	}
+
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch err := manifestService.Delete(ctx, desc.Digest); err {
+	case nil, distribution.ErrBlobUnknown:
+		return nil
+	case distribution.ErrUnsupported:
+		// Without deletes enabled, the untagged manifest remains
+		// available by digest.
+		return nil
+	default:
+		return err
+	}
+}
+
+// referencedByManifest reports whether a manifest of the repository, such as
+// a manifest list, references the manifest dgst.
+func referencedByManifest(ctx context.Context, repo distribution.Repository, dgst digest.Digest) (bool, error) {
+	r, ok := repo.(*repository)
+	if !ok {
+		return false, nil
+	}
+
+	manifests, err := r.referencingManifests(ctx, r.Name().Name(), dgst)
+	return len(manifests) > 0, err
+}
+
+type byUpdatedAtDesc []taggedRevision
+
+func (s byUpdatedAtDesc) Len() int           { return len(s) }
+func (s byUpdatedAtDesc) Less(i, j int) bool { return s[i].updatedAt.After(s[j].updatedAt) }
+func (s byUpdatedAtDesc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
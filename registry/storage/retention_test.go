@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+)
+
+func tagManifest(t *testing.T, env *gcTestEnv, repo distribution.Repository, tag string, dgst digest.Digest) {
+	if err := repo.Tags(env.ctx).Tag(env.ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatalf("failed to tag %s: %v", tag, err)
+	}
+	// Separate the modification times of consecutive tags
+	time.Sleep(5 * time.Millisecond)
+}
+
+func checkTags(t *testing.T, env *gcTestEnv, repo distribution.Repository, expected ...string) {
+	tags, err := repo.Tags(env.ctx).All(env.ctx)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+
+	sort.Strings(tags)
+	sort.Strings(expected)
+	if len(tags) != len(expected) {
+		t.Fatalf("unexpected tags: %v != %v", tags, expected)
+	}
+	for i := range tags {
+		if tags[i] != expected[i] {
+			t.Fatalf("unexpected tags: %v != %v", tags, expected)
+		}
+	}
+}
+
+func manifestExists(t *testing.T, env *gcTestEnv, repo distribution.Repository, dgst digest.Digest) bool {
+	manifests, err := repo.Manifests(env.ctx)
+	if err != nil {
+		t.Fatalf("failed to construct manifest service: %v", err)
+	}
+
+	exists, err := manifests.Exists(env.ctx, dgst)
+	if err != nil {
+		t.Fatalf("failed to check manifest existence: %v", err)
+	}
+	return exists
+}
+
+func TestRetentionKeepLast(t *testing.T) {
+	env := newGCTestEnv(t)
+	ci := env.repository(t, "ci/app")
+	other := env.repository(t, "other/app")
+
+	var dgsts []digest.Digest
+	for _, tag := range []string{"v1.0", "pr-1", "pr-2", "pr-3", "pr-4", "pr-5"} {
+		dgst, _ := uploadSchema2Manifest(t, ci, uploadRandomLayers(t, ci, 1))
+		tagManifest(t, env, ci, tag, dgst)
+		dgsts = append(dgsts, dgst)
+	}
+
+	otherDigest, _ := uploadSchema2Manifest(t, other, uploadRandomLayers(t, other, 1))
+	tagManifest(t, env, other, "pr-1", otherDigest)
+	tagManifest(t, env, other, "pr-2", otherDigest)
+
+	policies := []RetentionPolicy{{
+		Repository: "ci/*",
+		KeepLast:   2,
+		Keep:       regexp.MustCompile(`^v`),
+	}}
+
+	removed, errs := EnforceRetention(env.ctx, env.driver, env.registry, policies, true)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(removed) != 3 {
+		t.Fatalf("expected 3 tags to be removed, got %v", removed)
+	}
+
+	checkTags(t, env, ci, "v1.0", "pr-4", "pr-5")
+	checkTags(t, env, other, "pr-1", "pr-2")
+
+	for i, dgst := range dgsts {
+		expected := i == 0 || i > 3
+		if manifestExists(t, env, ci, dgst) != expected {
+			t.Errorf("manifest %s: expected existence %t", dgst, expected)
+		}
+	}
+}
+
+func TestRetentionMaxAge(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "ci/app")
+
+	sharedDigest, _ := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 1))
+	expiredDigest, _ := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 1))
+	recentDigest, _ := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 1))
+
+	tagManifest(t, env, repo, "pr-1", sharedDigest)
+	tagManifest(t, env, repo, "release", sharedDigest)
+	tagManifest(t, env, repo, "pr-2", expiredDigest)
+	time.Sleep(100 * time.Millisecond)
+	tagManifest(t, env, repo, "pr-3", recentDigest)
+
+	policies := []RetentionPolicy{
+		{
+			Repository: "ci/app",
+			MaxAge:     50 * time.Millisecond,
+			Keep:       regexp.MustCompile(`^release$`),
+		},
+		{
+			// Only the first matching policy applies
+			Repository: "ci/*",
+			MaxAge:     time.Nanosecond,
+		},
+	}
+
+	// A dry run reports the tags without removing them
+	removed, errs := EnforceRetention(env.ctx, env.driver, env.registry, policies, false)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 tags to be reported, got %v", removed)
+	}
+	checkTags(t, env, repo, "pr-1", "release", "pr-2", "pr-3")
+
+	removed, errs = EnforceRetention(env.ctx, env.driver, env.registry, policies, true)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 tags to be removed, got %v", removed)
+	}
+	checkTags(t, env, repo, "release", "pr-3")
+
+	if !manifestExists(t, env, repo, sharedDigest) {
+		t.Errorf("manifest %s still tagged by release was deleted", sharedDigest)
+	}
+	if manifestExists(t, env, repo, expiredDigest) {
+		t.Errorf("manifest %s should have been deleted", expiredDigest)
+	}
+	if !manifestExists(t, env, repo, recentDigest) {
+		t.Errorf("recent manifest %s was deleted", recentDigest)
+	}
+}
+
+func TestRetentionKeepsImmutableTags(t *testing.T) {
+	env := newGCTestEnv(t)
+	registry, err := NewRegistry(env.ctx, env.driver, EnableDelete, ImmutableTags([]ImmutableTagRule{{Tag: "v*"}}))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	env.registry = registry
+	repo := env.repository(t, "ci/app")
+
+	releaseDigest, _ := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 1))
+	prDigest, _ := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 1))
+	tagManifest(t, env, repo, "v1.0", releaseDigest)
+	tagManifest(t, env, repo, "pr-1", prDigest)
+	tagManifest(t, env, repo, "pr-2", releaseDigest)
+
+	policies := []RetentionPolicy{{Repository: "ci/*", MaxAge: time.Nanosecond}}
+
+	for _, actuallyDelete := range []bool{false, true} {
+		removed, errs := EnforceRetention(env.ctx, env.driver, env.registry, policies, actuallyDelete)
+		if len(errs) != 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if len(removed) != 2 {
+			t.Fatalf("expected 2 tags to be removed, got %v", removed)
+		}
+	}
+
+	checkTags(t, env, repo, "v1.0")
+	if !manifestExists(t, env, repo, releaseDigest) {
+		t.Errorf("manifest %s tagged by an immutable tag was deleted", releaseDigest)
+	}
+	if manifestExists(t, env, repo, prDigest) {
+		t.Errorf("manifest %s should have been deleted", prDigest)
+	}
+}
+
+func TestRetentionKeepsManifestListChildren(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "ci/app")
+
+	childDigest, child := uploadSchema2Manifest(t, repo, uploadRandomLayers(t, repo, 1))
+	tagManifest(t, env, repo, "pr-1", childDigest)
+
+	_, payload, err := child.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{{
+		Descriptor: distribution.Descriptor{Digest: childDigest, Size: int64(len(payload)), MediaType: schema2.MediaTypeManifest},
+		Platform:   manifestlist.PlatformSpec{Architecture: "amd64", OS: "linux"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repo.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listDigest, err := manifests.Put(env.ctx, list)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest list: %v", err)
+	}
+	tagManifest(t, env, repo, "multi", listDigest)
+
+	policies := []RetentionPolicy{{Repository: "ci/app", KeepLast: 1}}
+	removed, errs := EnforceRetention(env.ctx, env.driver, env.registry, policies, true)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("expected 1 tag to be removed, got %v", removed)
+	}
+	checkTags(t, env, repo, "multi")
+
+	if !manifestExists(t, env, repo, childDigest) {
+		t.Errorf("manifest %s referenced by a tagged manifest list was deleted", childDigest)
+	}
+	if !manifestExists(t, env, repo, listDigest) {
+		t.Errorf("manifest list %s was deleted", listDigest)
+	}
+}
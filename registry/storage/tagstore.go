@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"io"
 	"path"
+	"sort"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
@@ -50,6 +52,71 @@ func (ts *tagStore) All(ctx context.Context) ([]string, error) {
 	return tags, nil
 }
 
+// List fills tags with the tags following last. Drivers implementing
+// storagedriver.PagedLister list the tags of the page, along with the next
+// one telling whether more follow. Otherwise, the names of every tag are
+// listed and sorted before the page is filled. Only the tag names are read,
+// not their links.
+func (ts *tagStore) List(ctx context.Context, tags []string, last string) (int, error) {
+	if lister, ok := ts.blobStore.driver.(storagedriver.PagedLister); ok {
+		// Wrappers such as base.Base implement the interface whether or
+		// not the driver they wrap does, reporting ErrUnsupportedMethod.
+		n, err := ts.listFrom(ctx, lister, tags, last)
+		if _, ok := err.(storagedriver.ErrUnsupportedMethod); !ok {
+			return n, err
+		}
+	}
+
+	all, err := ts.All(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(all)
+
+	i := sort.SearchStrings(all, last)
+	if i < len(all) && all[i] == last {
+		i++
+	}
+
+	n := copy(tags, all[i:])
+	if i+n == len(all) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// listFrom fills tags with the tags following last, listed by lister.
+func (ts *tagStore) listFrom(ctx context.Context, lister storagedriver.PagedLister, tags []string, last string) (int, error) {
+	pathSpec, err := pathFor(manifestTagPathSpec{
+		name: ts.repository.Name().Name(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := lister.ListFrom(ctx, pathSpec, last, len(tags)+1)
+	if err != nil {
+		switch err := err.(type) {
+		case storagedriver.PathNotFoundError:
+			return 0, distribution.ErrRepositoryUnknown{Name: ts.repository.Name().Name()}
+		default:
+			return 0, err
+		}
+	}
+
+	n := 0
+	for _, entry := range entries {
+		if n == len(tags) {
+			return n, nil
+		}
+		_, filename := path.Split(entry)
+		tags[n] = filename
+		n++
+	}
+
+	return n, io.EOF
+}
+
 // exists returns true if the specified manifest tag exists in the repository.
 func (ts *tagStore) exists(ctx context.Context, tag string) (bool, error) {
 	tagPath, err := pathFor(manifestTagCurrentPathSpec{
@@ -81,6 +148,36 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 		return err
 	}
 
+	name := ts.repository.Name().Name()
+	tagPath, err := pathFor(manifestTagPathSpec{name: name, tag: tag})
+	if err != nil {
+		return err
+	}
+
+	// Serialize the changes to the tag, so that it is only counted once and
+	// an immutable tag cannot be moved by a concurrent push.
+	unlock := ts.repository.usage.lock(tagPath)
+	defer unlock()
+
+	if ts.repository.tagImmutable(name, tag) {
+		current, err := ts.Get(ctx, tag)
+		switch err.(type) {
+		case nil:
+			if current.Digest != desc.Digest {
+				return distribution.ErrTagImmutable{Tag: tag, Digest: current.Digest}
+			}
+		case distribution.ErrTagUnknown:
+			// a new tag may be created
+		default:
+			return err
+		}
+	}
+
+	tagged, err := exists(ctx, ts.blobStore.driver, tagPath)
+	if err != nil {
+		return err
+	}
+
 	lbs := ts.linkedBlobStore(ctx, tag)
 
 	// Link into the index
@@ -89,7 +186,17 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 	}
 
 	// Overwrite the current link
-	return ts.blobStore.link(ctx, currentPath, desc.Digest)
+	if err := ts.blobStore.link(ctx, currentPath, desc.Digest); err != nil {
+		return err
+	}
+
+	if !tagged {
+		if err := ts.repository.usage.updateRepository(ctx, name, usageRecord{Tags: 1}); err != nil {
+			context.GetLogger(ctx).Errorf("usage: unable to account for tag %s of %s: %v", tag, name, err)
+		}
+	}
+
+	return nil
 }
 
 // resolve the current revision for name and tag.
@@ -116,7 +223,7 @@ func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descripto
 	return distribution.Descriptor{Digest: revision}, nil
 }
 
-// Untag removes the tag association
+// Untag removes the tag association. Immutable tags may not be removed.
 func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 	tagPath, err := pathFor(manifestTagPathSpec{
 		name: ts.repository.Name().Name(),
@@ -132,7 +239,31 @@ func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 		return err
 	}
 
-	return ts.blobStore.driver.Delete(ctx, tagPath)
+	unlock := ts.repository.usage.lock(tagPath)
+	defer unlock()
+
+	if ts.repository.tagImmutable(ts.repository.Name().Name(), tag) {
+		current, err := ts.Get(ctx, tag)
+		if err != nil {
+			return err
+		}
+		return distribution.ErrTagImmutable{Tag: tag, Digest: current.Digest}
+	}
+
+	if err := ts.blobStore.driver.Delete(ctx, tagPath); err != nil {
+		switch err.(type) {
+		case storagedriver.PathNotFoundError:
+			return distribution.ErrTagUnknown{Tag: tag}
+		}
+		return err
+	}
+
+	name := ts.repository.Name().Name()
+	if err := ts.repository.usage.updateRepository(ctx, name, usageRecord{Tags: -1}); err != nil {
+		context.GetLogger(ctx).Errorf("usage: unable to account for removing tag %s of %s: %v", tag, name, err)
+	}
+
+	return nil
 }
 
 // linkedBlobStore returns the linkedBlobStore for the named tag, allowing one
@@ -189,3 +320,72 @@ func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([
 
 	return tags, nil
 }
+
+// History returns the manifests the tag has referred to, read from the tag
+// index. The time each was last tagged is the modification time of its index
+// entry.
+func (ts *tagStore) History(ctx context.Context, tag string) ([]distribution.TagHistoryEntry, error) {
+	current, err := ts.Get(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	indexPath, err := pathFor(manifestTagIndexPathSpec{
+		name: ts.repository.Name().Name(),
+		tag:  tag,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var history []distribution.TagHistoryEntry
+	err = walkAll(ctx, ts.blobStore.driver, indexPath, func(fileInfo storagedriver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		dgst, err := ts.blobStore.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		history = append(history, distribution.TagHistoryEntry{
+			Digest:  dgst,
+			Tagged:  fileInfo.ModTime(),
+			Current: dgst == current.Digest,
+		})
+		return nil
+	})
+
+	switch err.(type) {
+	case nil:
+	case storagedriver.PathNotFoundError:
+		// tags created before the index was maintained
+	default:
+		return nil, err
+	}
+
+	found := false
+	for _, entry := range history {
+		found = found || entry.Current
+	}
+	if !found {
+		history = append(history, distribution.TagHistoryEntry{Digest: current.Digest, Current: true})
+	}
+
+	sort.Sort(tagHistoryByTime(history))
+	return history, nil
+}
+
+// tagHistoryByTime sorts tag history entries from the most to the least
+// recently tagged, the current entry first.
+type tagHistoryByTime []distribution.TagHistoryEntry
+
+func (h tagHistoryByTime) Len() int      { return len(h) }
+func (h tagHistoryByTime) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h tagHistoryByTime) Less(i, j int) bool {
+	if h[i].Current != h[j].Current {
+		return h[i].Current
+	}
+	return h[i].Tagged.After(h[j].Tagged)
+}
@@ -1,11 +1,16 @@
 package storage
 
 import (
+	"fmt"
+	"io"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/reference"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
 )
 
@@ -84,8 +89,8 @@ func TestTagStoreUnTag(t *testing.T) {
 	desc := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
 
 	err := tags.Untag(ctx, "latest")
-	if err == nil {
-		t.Errorf("Expected error untagging non-existant tag")
+	if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Errorf("Expected ErrTagUnknown untagging non-existant tag, got %v", err)
 	}
 
 	err = tags.Tag(ctx, "latest", desc)
@@ -151,6 +156,98 @@ func TestTagStoreAll(t *testing.T) {
 
 }
 
+// unpagedDriver hides the storagedriver.PagedLister implementation of the
+// driver it wraps.
+type unpagedDriver struct {
+	storagedriver.StorageDriver
+}
+
+// pagedOnlyDriver fails to list a directory in full.
+type pagedOnlyDriver struct {
+	*inmemory.Driver
+}
+
+func (d pagedOnlyDriver) List(ctx context.Context, path string) ([]string, error) {
+	return nil, fmt.Errorf("unexpected listing of %s", path)
+}
+
+func TestTagStoreList(t *testing.T) {
+	for _, wrap := range []func(*inmemory.Driver) storagedriver.StorageDriver{
+		func(d *inmemory.Driver) storagedriver.StorageDriver { return d },
+		func(d *inmemory.Driver) storagedriver.StorageDriver { return unpagedDriver{d} },
+		func(d *inmemory.Driver) storagedriver.StorageDriver { return pagedOnlyDriver{d} },
+	} {
+		testTagStoreList(t, wrap)
+	}
+}
+
+// testTagStoreList tags manifests, then lists the tags through the driver
+// returned by wrap.
+func testTagStoreList(t *testing.T, wrap func(*inmemory.Driver) storagedriver.StorageDriver) {
+	ctx := context.Background()
+	d := inmemory.New()
+	repoRef, _ := reference.ParseNamed("a/b")
+
+	reg, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := distribution.Descriptor{Digest: "sha256:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"}
+	for _, tag := range []string{"e", "b", "d", "a", "c"} {
+		if err := repo.Tags(ctx).Tag(ctx, tag, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listing := wrap(d)
+	reg, err = NewRegistry(ctx, listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err = reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagStore := repo.Tags(ctx)
+
+	for _, tc := range []struct {
+		last     string
+		size     int
+		expected []string
+		eof      bool
+	}{
+		{last: "", size: 2, expected: []string{"a", "b"}},
+		{last: "b", size: 2, expected: []string{"c", "d"}},
+		{last: "d", size: 2, expected: []string{"e"}, eof: true},
+		{last: "c", size: 2, expected: []string{"d", "e"}, eof: true},
+		{last: "bb", size: 10, expected: []string{"c", "d", "e"}, eof: true},
+		{last: "e", size: 2, expected: []string{}, eof: true},
+	} {
+		tags := make([]string, tc.size)
+		n, err := tagStore.List(ctx, tags, tc.last)
+		if tc.eof && err != io.EOF || !tc.eof && err != nil {
+			t.Fatalf("%T: unexpected error listing tags after %q: %v", listing, tc.last, err)
+		}
+		if !reflect.DeepEqual(tags[:n], tc.expected) {
+			t.Fatalf("%T: unexpected tags after %q: %v != %v", listing, tc.last, tags[:n], tc.expected)
+		}
+	}
+
+	unknownRef, _ := reference.ParseNamed("a/unknown")
+	unknown, err := reg.Repository(ctx, unknownRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unknown.Tags(ctx).List(ctx, make([]string, 2), "a"); !reflect.DeepEqual(err, distribution.ErrRepositoryUnknown{Name: "a/unknown"}) {
+		t.Fatalf("%T: unexpected error listing tags of an unknown repository: %v", listing, err)
+	}
+}
+
 func TestTagLookup(t *testing.T) {
 	env := testTagStore(t)
 	tagStore := env.ts
@@ -206,3 +303,56 @@ func TestTagLookup(t *testing.T) {
 	}
 
 }
+
+func TestTagHistory(t *testing.T) {
+	env := testTagStore(t)
+	tagStore := env.ts
+	ctx := env.ctx
+
+	if _, err := tagStore.History(ctx, "latest"); err == nil {
+		t.Fatalf("expected error getting history of unknown tag")
+	} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("unexpected error getting history of unknown tag: %v", err)
+	}
+
+	descA := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	descB := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+	descC := distribution.Descriptor{Digest: "sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"}
+
+	checkHistory := func(expected ...distribution.Descriptor) {
+		history, err := tagStore.History(ctx, "latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(history) != len(expected) {
+			t.Fatalf("unexpected history length: %d != %d", len(history), len(expected))
+		}
+
+		for i, entry := range history {
+			if entry.Digest != expected[i].Digest {
+				t.Errorf("unexpected digest at %d: %v != %v", i, entry.Digest, expected[i].Digest)
+			}
+			if entry.Current != (i == 0) {
+				t.Errorf("unexpected current flag at %d: %v", i, entry.Current)
+			}
+			if entry.Tagged.IsZero() {
+				t.Errorf("missing tagged time at %d", i)
+			}
+		}
+	}
+
+	for _, desc := range []distribution.Descriptor{descA, descB, descC} {
+		if err := tagStore.Tag(ctx, "latest", desc); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkHistory(descC, descB, descA)
+
+	// Rolling back moves the restored digest to the front
+	if err := tagStore.Tag(ctx, "latest", descA); err != nil {
+		t.Fatal(err)
+	}
+	checkHistory(descA, descC, descB)
+}
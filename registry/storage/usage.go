@@ -0,0 +1,548 @@
+package storage
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// usageRecord is the usage of a repository, or of a namespace, as stored.
+type usageRecord struct {
+	// LinkedBytes is the size of the blobs linked into the repository,
+	// counting each blob once, or the sum for the repositories of the
+	// namespace.
+	LinkedBytes int64 `json:"linkedBytes"`
+
+	// UniqueBytes is the size of the blobs linked into the repository and
+	// into no other repository. Not kept for namespaces.
+	UniqueBytes int64 `json:"uniqueBytes,omitempty"`
+
+	// Manifests is the number of manifest revisions of the repository. Not
+	// kept for namespaces.
+	Manifests int `json:"manifests,omitempty"`
+
+	// Tags is the number of tags of the repository. Not kept for
+	// namespaces.
+	Tags int `json:"tags,omitempty"`
+}
+
+// add adds the figures of delta to the record, which are not allowed to go
+// below zero.
+func (r *usageRecord) add(delta usageRecord) {
+	r.LinkedBytes += delta.LinkedBytes
+	if r.LinkedBytes < 0 {
+		r.LinkedBytes = 0
+	}
+	r.UniqueBytes += delta.UniqueBytes
+	if r.UniqueBytes < 0 {
+		r.UniqueBytes = 0
+	}
+	r.Manifests += delta.Manifests
+	if r.Manifests < 0 {
+		r.Manifests = 0
+	}
+	r.Tags += delta.Tags
+	if r.Tags < 0 {
+		r.Tags = 0
+	}
+}
+
+// usageTracker accounts for the storage used by each repository and
+// top-level namespace, in records kept in storage next to the repositories,
+// so that every registry instance sharing the storage sees the same usage.
+// Records are updated as blobs are linked and unlinked and as tags are added
+// and removed. A missing record is counted from the links in storage when
+// first needed, so that removing the record of a repository, and that of its
+// namespace, repairs it after out of band changes.
+//
+// Whether a blob is linked into other repositories, which decides the unique
+// bytes, is read from the referrer index. Changes to the links of a blob are
+// serialized within a process by the lock of the blob, and updates by the
+// lock of each record. Updates made to the same record at the same time by
+// several registry instances may be lost.
+type usageTracker struct {
+	registry *registry
+	driver   driver.StorageDriver
+
+	mu    sync.Mutex
+	locks map[string]*usageLock
+}
+
+// usageLock serializes the updates of a usage record.
+type usageLock struct {
+	sync.Mutex
+	refs int // number of holders and waiters
+}
+
+// newUsageTracker returns a tracker of the records kept in storageDriver.
+// The registry is used to count missing records, and may be nil for a tracker
+// only used to invalidate records.
+func newUsageTracker(storageDriver driver.StorageDriver, registry *registry) *usageTracker {
+	return &usageTracker{
+		registry: registry,
+		driver:   storageDriver,
+		locks:    make(map[string]*usageLock),
+	}
+}
+
+// lock acquires the lock of the usage record at p and returns the function
+// releasing it. ut.mu is only held while looking the lock up.
+func (ut *usageTracker) lock(p string) func() {
+	ut.mu.Lock()
+	l, ok := ut.locks[p]
+	if !ok {
+		l = &usageLock{}
+		ut.locks[p] = l
+	}
+	l.refs++
+	ut.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		ut.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(ut.locks, p)
+		}
+		ut.mu.Unlock()
+	}
+}
+
+// lockBlob acquires the lock of the links to the blob. Callers hold it while
+// linking the blob into a repository or unlinking it, so that whether the
+// blob was already linked, there or elsewhere, is known when accounting for
+// it. The locks of records may be acquired while holding it, not the other
+// way around.
+func (ut *usageTracker) lockBlob(dgst digest.Digest) (func(), error) {
+	p, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+	return ut.lock(p), nil
+}
+
+// linkChanged accounts for a change to the links of the named repository to
+// the blob. delta holds the change to the number of manifests and, if the
+// repository started or stopped linking the blob, the size of the blob,
+// positive or negative, as linked bytes. The caller must hold the lock of the
+// blob.
+func (ut *usageTracker) linkChanged(ctx context.Context, name string, dgst digest.Digest, delta usageRecord) error {
+	var others []string
+	if delta.LinkedBytes != 0 {
+		var err error
+		others, err = ut.registry.linkingRepositories(ctx, dgst, name)
+		if err != nil {
+			return err
+		}
+
+		if len(others) == 0 {
+			delta.UniqueBytes = delta.LinkedBytes
+		}
+	}
+
+	if delta != (usageRecord{}) {
+		if err := ut.updateRepository(ctx, name, delta); err != nil {
+			return err
+		}
+	}
+
+	// The blob is no longer, or is now, unique to the only other
+	// repository linking it.
+	if len(others) == 1 {
+		return ut.updateRepository(ctx, others[0], usageRecord{UniqueBytes: -delta.LinkedBytes})
+	}
+	return nil
+}
+
+// updateRepository adds delta to the record of the named repository, and its
+// linked bytes to the record of its namespace. The records are removed on
+// failure, to be counted again from storage.
+func (ut *usageTracker) updateRepository(ctx context.Context, name string, delta usageRecord) error {
+	repositoryPath, err := pathFor(repositoryUsagePathSpec{name: name})
+	if err != nil {
+		return err
+	}
+
+	unlock := ut.lock(repositoryPath)
+	err = ut.update(ctx, repositoryPath, delta, func() (usageRecord, error) {
+		return ut.countRepository(ctx, name)
+	})
+	unlock()
+	if err != nil {
+		ut.invalidate(ctx, name)
+		return err
+	}
+
+	namespace, ok := namespaceOf(name)
+	if !ok || delta.LinkedBytes == 0 {
+		return nil
+	}
+
+	namespacePath, err := pathFor(namespaceUsagePathSpec{namespace: namespace})
+	if err != nil {
+		return err
+	}
+
+	unlock = ut.lock(namespacePath)
+	defer unlock()
+
+	err = ut.update(ctx, namespacePath, usageRecord{LinkedBytes: delta.LinkedBytes}, func() (usageRecord, error) {
+		linkedBytes, err := ut.countNamespace(ctx, namespace)
+		return usageRecord{LinkedBytes: linkedBytes}, err
+	})
+	if err != nil {
+		ut.driver.Delete(ctx, namespacePath)
+		return err
+	}
+
+	return nil
+}
+
+// update adds delta to the record at p, or stores the count if there is no
+// record yet. The caller must hold the lock of the record.
+func (ut *usageTracker) update(ctx context.Context, p string, delta usageRecord, count func() (usageRecord, error)) error {
+	record, err := ut.readRecord(ctx, p)
+	switch err.(type) {
+	case nil:
+		record.add(delta)
+	case driver.PathNotFoundError:
+		// The count reflects the change, which has already been made.
+		record, err = count()
+		if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	return ut.writeRecord(ctx, p, record)
+}
+
+// repositoryRecord returns the record of the named repository, counting and
+// storing it if there is no record yet.
+func (ut *usageTracker) repositoryRecord(ctx context.Context, name string) (usageRecord, error) {
+	p, err := pathFor(repositoryUsagePathSpec{name: name})
+	if err != nil {
+		return usageRecord{}, err
+	}
+
+	unlock := ut.lock(p)
+	defer unlock()
+
+	return ut.readOrCount(ctx, p, func() (usageRecord, error) {
+		return ut.countRepository(ctx, name)
+	})
+}
+
+// repositoryLinkedBytes returns the linked bytes of the named repository,
+// counting and storing them if there is no record yet.
+func (ut *usageTracker) repositoryLinkedBytes(ctx context.Context, name string) (int64, error) {
+	record, err := ut.repositoryRecord(ctx, name)
+	return record.LinkedBytes, err
+}
+
+// namespaceLinkedBytes returns the sum of the linked bytes of the
+// repositories in the namespace, counting and storing it if there is no
+// record yet.
+func (ut *usageTracker) namespaceLinkedBytes(ctx context.Context, namespace string) (int64, error) {
+	p, err := pathFor(namespaceUsagePathSpec{namespace: namespace})
+	if err != nil {
+		return 0, err
+	}
+
+	unlock := ut.lock(p)
+	defer unlock()
+
+	record, err := ut.readOrCount(ctx, p, func() (usageRecord, error) {
+		linkedBytes, err := ut.countNamespace(ctx, namespace)
+		return usageRecord{LinkedBytes: linkedBytes}, err
+	})
+	return record.LinkedBytes, err
+}
+
+// readOrCount returns the record at p, storing the count if there is no
+// record yet. The caller must hold the lock of the record.
+func (ut *usageTracker) readOrCount(ctx context.Context, p string, count func() (usageRecord, error)) (usageRecord, error) {
+	record, err := ut.readRecord(ctx, p)
+	switch err.(type) {
+	case nil:
+		return record, nil
+	case driver.PathNotFoundError:
+	default:
+		return usageRecord{}, err
+	}
+
+	record, err = count()
+	if err != nil {
+		return usageRecord{}, err
+	}
+
+	return record, ut.writeRecord(ctx, p, record)
+}
+
+// invalidate removes the records of the named repository and of its
+// namespace, which are counted again from storage when next needed. It is
+// called after the links of the repository are changed out of band, and
+// errors are only logged.
+func (ut *usageTracker) invalidate(ctx context.Context, name string) {
+	specs := []pathSpec{repositoryUsagePathSpec{name: name}}
+	if namespace, ok := namespaceOf(name); ok {
+		specs = append(specs, namespaceUsagePathSpec{namespace: namespace})
+	}
+
+	for _, spec := range specs {
+		p, err := pathFor(spec)
+		if err != nil {
+			context.GetLogger(ctx).Errorf("usage: %v", err)
+			continue
+		}
+
+		unlock := ut.lock(p)
+		if err := ut.driver.Delete(ctx, p); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				context.GetLogger(ctx).Errorf("usage: unable to remove %s: %v", p, err)
+			}
+		}
+		unlock()
+	}
+}
+
+func (ut *usageTracker) readRecord(ctx context.Context, p string) (usageRecord, error) {
+	var record usageRecord
+
+	content, err := ut.driver.GetContent(ctx, p)
+	if err != nil {
+		return record, err
+	}
+
+	return record, json.Unmarshal(content, &record)
+}
+
+func (ut *usageTracker) writeRecord(ctx context.Context, p string, record usageRecord) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return ut.driver.PutContent(ctx, p, content)
+}
+
+// countRepository returns the usage of the named repository, counted from
+// its links and tags. Blobs linked as layers or manifests count once.
+func (ut *usageTracker) countRepository(ctx context.Context, name string) (usageRecord, error) {
+	var record usageRecord
+
+	manifests := make(map[digest.Digest]struct{})
+	if err := ut.scanLinks(ctx, manifestRevisionsPathSpec{name: name}, manifests); err != nil {
+		return usageRecord{}, err
+	}
+	record.Manifests = len(manifests)
+
+	tagsPath, err := pathFor(manifestTagsPathSpec{name: name})
+	if err != nil {
+		return usageRecord{}, err
+	}
+	tags, err := ut.driver.List(ctx, tagsPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return usageRecord{}, err
+		}
+	}
+	record.Tags = len(tags)
+
+	linked := manifests
+	if err := ut.scanLinks(ctx, layersPathSpec{name: name}, linked); err != nil {
+		return usageRecord{}, err
+	}
+
+	for dgst := range linked {
+		size, err := ut.blobSize(ctx, dgst)
+		if err != nil {
+			return usageRecord{}, err
+		}
+		record.LinkedBytes += size
+
+		others, err := ut.registry.linkingRepositories(ctx, dgst, name)
+		if err != nil {
+			return usageRecord{}, err
+		}
+		if len(others) == 0 {
+			record.UniqueBytes += size
+		}
+	}
+
+	return record, nil
+}
+
+// countNamespace returns the sum of the linked bytes of the repositories
+// below the namespace. The records of the repositories are read without
+// their lock, and counted without being stored if missing.
+func (ut *usageTracker) countNamespace(ctx context.Context, namespace string) (int64, error) {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	err = walkAll(ctx, ut.driver, path.Join(root, namespace), func(fileInfo driver.FileInfo) error {
+		filePath := fileInfo.Path()
+		dir, file := path.Split(filePath)
+		if !strings.HasPrefix(file, "_") {
+			return nil
+		}
+
+		name := strings.TrimSuffix(dir[len(root)+1:], "/")
+		if file != "_layers" || name == namespace {
+			// The repository named after the namespace is not part of it.
+			return ErrSkipDir
+		}
+
+		p, err := pathFor(repositoryUsagePathSpec{name: name})
+		if err != nil {
+			return err
+		}
+
+		record, err := ut.readRecord(ctx, p)
+		switch err.(type) {
+		case nil:
+		case driver.PathNotFoundError:
+			record, err = ut.countRepository(ctx, name)
+			if err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		total += record.LinkedBytes
+		return ErrSkipDir
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return 0, nil
+	}
+	return total, err
+}
+
+// scanLinks adds the digest of every link found under spec to linked.
+// Signature links are skipped.
+func (ut *usageTracker) scanLinks(ctx context.Context, spec pathSpec, linked map[digest.Digest]struct{}) error {
+	root, err := pathFor(spec)
+	if err != nil {
+		return err
+	}
+
+	err = walkAll(ctx, ut.driver, root, func(fileInfo driver.FileInfo) error {
+		_, fileName := path.Split(fileInfo.Path())
+		if fileInfo.IsDir() {
+			if fileName == "signatures" {
+				return ErrSkipDir
+			}
+			return nil
+		}
+
+		if fileName != "link" {
+			return nil
+		}
+
+		content, err := ut.driver.GetContent(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		dgst, err := digest.ParseDigest(string(content))
+		if err != nil {
+			return err
+		}
+
+		linked[dgst] = struct{}{}
+		return nil
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// blobSize returns the size of the blob data of dgst. Dangling links count
+// as zero bytes.
+func (ut *usageTracker) blobSize(ctx context.Context, dgst digest.Digest) (int64, error) {
+	blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return 0, err
+	}
+
+	fi, err := ut.driver.Stat(ctx, blobPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+// repositoryExists reports whether the named repository holds any layer
+// links or manifests.
+func (reg *registry) repositoryExists(ctx context.Context, name string) (bool, error) {
+	for _, spec := range []pathSpec{layersPathSpec{name: name}, manifestsPathSpec{name: name}} {
+		p, err := pathFor(spec)
+		if err != nil {
+			return false, err
+		}
+
+		ok, err := exists(ctx, reg.blobStore.driver, p)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+// namespaceOf returns the top-level namespace of the repository name, if it
+// has one.
+func namespaceOf(name string) (string, bool) {
+	i := strings.Index(name, "/")
+	if i < 0 {
+		return "", false
+	}
+	return name[:i], true
+}
+
+// Usage returns the storage used by the named repository, as read from its
+// usage record.
+func (reg *registry) Usage(ctx context.Context, name reference.Named) (distribution.RepositoryUsage, error) {
+	repoName := name.Name()
+
+	exists, err := reg.repositoryExists(ctx, repoName)
+	if err != nil {
+		return distribution.RepositoryUsage{}, err
+	}
+	if !exists {
+		return distribution.RepositoryUsage{}, distribution.ErrRepositoryUnknown{Name: repoName}
+	}
+
+	record, err := reg.usage.repositoryRecord(ctx, repoName)
+	if err != nil {
+		return distribution.RepositoryUsage{}, err
+	}
+
+	return distribution.RepositoryUsage{
+		LinkedBytes: record.LinkedBytes,
+		UniqueBytes: record.UniqueBytes,
+		Manifests:   record.Manifests,
+		Tags:        record.Tags,
+	}, nil
+}
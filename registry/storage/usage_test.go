@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+)
+
+func checkUsage(t *testing.T, env *gcTestEnv, name string, expected distribution.RepositoryUsage) {
+	named, err := reference.ParseNamed(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := env.registry.(distribution.UsageReporter).Usage(env.ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting usage of %s: %v", name, err)
+	}
+
+	if usage != expected {
+		t.Fatalf("unexpected usage of %s: %#v != %#v", name, usage, expected)
+	}
+
+	// The record kept up to date as links change matches the links in
+	// storage.
+	counted, err := env.registry.(*registry).usage.countRepository(env.ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error counting usage of %s: %v", name, err)
+	}
+	if counted != (usageRecord{
+		LinkedBytes: expected.LinkedBytes,
+		UniqueBytes: expected.UniqueBytes,
+		Manifests:   expected.Manifests,
+		Tags:        expected.Tags,
+	}) {
+		t.Fatalf("unexpected count of usage of %s: %#v", name, counted)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	env := newGCTestEnv(t)
+	first := env.repository(t, "foo/first")
+	second := env.repository(t, "foo/second")
+
+	if _, err := env.registry.(distribution.UsageReporter).Usage(env.ctx, first.Name()); err == nil {
+		t.Fatalf("expected error getting usage of unknown repository")
+	}
+
+	shared, err := pushBytes(env.ctx, first, 'a', 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pushBytes(env.ctx, second, 'a', 100); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := pushBytes(env.ctx, first, 'b', 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkUsage(t, env, "foo/first", distribution.RepositoryUsage{LinkedBytes: 150, UniqueBytes: 50})
+	checkUsage(t, env, "foo/second", distribution.RepositoryUsage{LinkedBytes: 100})
+
+	dgst, m := uploadSchema2Manifest(t, first, []distribution.Descriptor{shared, layer})
+	_, payload, err := m.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configSize := m.Config.Size
+	manifestSize := int64(len(payload))
+
+	tagManifest(t, env, first, "latest", dgst)
+	tagManifest(t, env, first, "stable", dgst)
+
+	expected := distribution.RepositoryUsage{
+		LinkedBytes: 150 + configSize + manifestSize,
+		UniqueBytes: 50 + configSize + manifestSize,
+		Manifests:   1,
+		Tags:        2,
+	}
+	checkUsage(t, env, "foo/first", expected)
+
+	// The usage records are shared by the registry instances using the
+	// storage.
+	reloaded, err := NewRegistry(env.ctx, env.driver, EnableDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadedEnv := &gcTestEnv{ctx: env.ctx, driver: env.driver, registry: reloaded}
+	checkUsage(t, reloadedEnv, "foo/first", expected)
+
+	if _, err := pushBytes(env.ctx, reloadedEnv.repository(t, "foo/second"), 'c', 25); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, env, "foo/second", distribution.RepositoryUsage{LinkedBytes: 125, UniqueBytes: 25})
+
+	// Removed records are counted again from the links in storage.
+	env.registry.(*registry).usage.invalidate(env.ctx, "foo/first")
+	checkUsage(t, env, "foo/first", expected)
+
+	// Unlinking updates the accounting state.
+	if err := first.Tags(env.ctx).Untag(env.ctx, "stable"); err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := first.Manifests(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manifests.Delete(env.ctx, dgst); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Blobs(env.ctx).Delete(env.ctx, layer.Digest); err != nil {
+		t.Fatal(err)
+	}
+
+	checkUsage(t, env, "foo/first", distribution.RepositoryUsage{
+		LinkedBytes: 100 + configSize,
+		UniqueBytes: configSize,
+		Tags:        1,
+	})
+
+	if err := first.Blobs(env.ctx).Delete(env.ctx, shared.Digest); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, env, "foo/second", distribution.RepositoryUsage{LinkedBytes: 125, UniqueBytes: 125})
+
+	namespaceBytes, err := env.registry.(*registry).usage.namespaceLinkedBytes(env.ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespaceBytes != configSize+125 {
+		t.Fatalf("unexpected usage of namespace foo: %d", namespaceBytes)
+	}
+}
+
+func TestUsageReadsRecord(t *testing.T) {
+	env := newGCTestEnv(t)
+	repo := env.repository(t, "foo/bar")
+	if _, err := pushBytes(env.ctx, repo, 'a', 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// Usage is read from the record, without counting the links.
+	p, err := pathFor(repositoryUsagePathSpec{name: "foo/bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := usageRecord{LinkedBytes: 1, UniqueBytes: 2, Manifests: 3, Tags: 4}
+	if err := env.registry.(*registry).usage.writeRecord(env.ctx, p, record); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := env.registry.(distribution.UsageReporter).Usage(env.ctx, repo.Name())
+	if err != nil {
+		t.Fatalf("unexpected error getting usage: %v", err)
+	}
+	if usage != (distribution.RepositoryUsage{LinkedBytes: 1, UniqueBytes: 2, Manifests: 3, Tags: 4}) {
+		t.Fatalf("unexpected usage: %#v", usage)
+	}
+}
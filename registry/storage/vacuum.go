@@ -44,6 +44,17 @@ func (v Vacuum) RemoveBlob(dgst string) error {
 		return err
 	}
 
+	referrersPath, err := pathFor(referrersPathSpec{digest: d})
+	if err != nil {
+		return err
+	}
+	err = v.driver.Delete(v.ctx, referrersPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+
 	return nil
 }
 
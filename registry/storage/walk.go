@@ -3,7 +3,9 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"path"
 	"sort"
+	"strings"
 
 	"github.com/docker/distribution/context"
 	storageDriver "github.com/docker/distribution/registry/storage/driver"
@@ -21,13 +23,18 @@ var ErrSkipDir = errors.New("skip this directory")
 type WalkFn func(fileInfo storageDriver.FileInfo) error
 
 // Walk traverses a filesystem defined within driver, starting
-// from the given path, calling f on each file
+// from the given path, calling f on each file. Each directory is listed
+// with one List call: the directories skipped with ErrSkipDir are not
+// listed at all, but walking the whole tree takes one call per directory.
+// The entries of a directory are visited in lexical order of their paths
+// followed by a slash, as the files of a recursive listing: "a-b" precedes
+// "a" and the entries below it.
 func Walk(ctx context.Context, driver storageDriver.StorageDriver, from string, f WalkFn) error {
 	children, err := driver.List(ctx, from)
 	if err != nil {
 		return err
 	}
-	sort.Stable(sort.StringSlice(children))
+	sort.Stable(byDirectoryPath(children))
 	for _, child := range children {
 		// TODO(stevvooe): Calling driver.Stat for every entry is quite
 		// expensive when running against backends with a slow Stat
@@ -52,6 +59,86 @@ func Walk(ctx context.Context, driver storageDriver.StorageDriver, from string,
 	return nil
 }
 
+// walkAll traverses the filesystem like Walk, but with a single recursive
+// listing when the driver supports it, in which directories containing no
+// file are not visited. Every file below from is listed, including those of
+// skipped directories, which are filtered out of the listing: a listing
+// returns many files per call instead of one List call per directory and
+// one Stat call per entry.
+func walkAll(ctx context.Context, driver storageDriver.StorageDriver, from string, f WalkFn) error {
+	if lister, ok := driver.(storageDriver.RecursiveLister); ok {
+		// Wrappers such as base.Base implement the interface whether or
+		// not the driver they wrap does, reporting ErrUnsupportedMethod.
+		err := walkRecursive(ctx, lister, from, f)
+		if _, ok := err.(storageDriver.ErrUnsupportedMethod); !ok {
+			return err
+		}
+	}
+
+	return Walk(ctx, driver, from, f)
+}
+
+// walkRecursive traverses the filesystem with a recursive listing. The
+// directories are not listed, so they are visited when their first file is
+// listed.
+func walkRecursive(ctx context.Context, lister storageDriver.RecursiveLister, from string, f WalkFn) error {
+	var (
+		dirs    []string // directories entered, innermost last
+		skipped string   // directory skipped, whose files are ignored
+	)
+
+	return lister.ListRecursive(ctx, from, func(fileInfo storageDriver.FileInfo) error {
+		filePath := fileInfo.Path()
+		if skipped != "" && strings.HasPrefix(filePath, skipped+"/") {
+			return nil
+		}
+		skipped = ""
+
+		// The files of a directory are listed contiguously: leave the
+		// directories this file is not in.
+		for len(dirs) > 0 && !strings.HasPrefix(filePath, dirs[len(dirs)-1]+"/") {
+			dirs = dirs[:len(dirs)-1]
+		}
+
+		parent := from
+		if len(dirs) > 0 {
+			parent = dirs[len(dirs)-1]
+		}
+
+		// Enter the directories between the innermost one entered and the
+		// file.
+		components := strings.Split(strings.TrimPrefix(strings.TrimPrefix(filePath, parent), "/"), "/")
+		for _, component := range components[:len(components)-1] {
+			parent = path.Join(parent, component)
+
+			err := f(storageDriver.FileInfoInternal{FileInfoFields: storageDriver.FileInfoFields{
+				Path:  parent,
+				IsDir: true,
+			}})
+			if err == ErrSkipDir {
+				skipped = parent
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			dirs = append(dirs, parent)
+		}
+
+		if err := f(fileInfo); err != nil && err != ErrSkipDir {
+			return err
+		}
+		return nil
+	})
+}
+
+// byDirectoryPath sorts paths as if each was followed by a slash.
+type byDirectoryPath []string
+
+func (p byDirectoryPath) Len() int           { return len(p) }
+func (p byDirectoryPath) Less(i, j int) bool { return p[i]+"/" < p[j]+"/" }
+func (p byDirectoryPath) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
 // pushError formats an error type given a path and an error
 // and pushes it to a slice of errors
 func pushError(errors []error, path string, err error) []error {
@@ -150,3 +150,64 @@ func TestWalkSkipDir(t *testing.T) {
 	}
 
 }
+
+// listOnlyDriver hides the RecursiveLister implementation of the wrapped
+// driver.
+type listOnlyDriver struct {
+	driver.StorageDriver
+}
+
+// unsupportedListerDriver implements RecursiveLister without supporting it,
+// as base.Base does for drivers which do not.
+type unsupportedListerDriver struct {
+	driver.StorageDriver
+}
+
+func (d unsupportedListerDriver) ListRecursive(ctx context.Context, path string, f func(driver.FileInfo) error) error {
+	return driver.ErrUnsupportedMethod{DriverName: d.Name()}
+}
+
+func TestWalkRecursiveListing(t *testing.T) {
+	d, _, ctx := testFS(t)
+	if _, ok := d.(driver.RecursiveLister); !ok {
+		t.Fatalf("expected %s to implement RecursiveLister", d.Name())
+	}
+
+	// Directories whose names are prefixes of their siblings' are visited
+	// after them.
+	for _, p := range []string{"/a-b/x", "/a.c/y"} {
+		if err := d.PutContent(ctx, p, []byte(p)); err != nil {
+			t.Fatalf("unable to put content into fixture: %v", err)
+		}
+	}
+
+	walk := func(d driver.StorageDriver, skip string) []string {
+		var traversed []string
+		err := walkAll(ctx, d, "/", func(fileInfo driver.FileInfo) error {
+			traversed = append(traversed, fmt.Sprintf("%s %v", fileInfo.Path(), fileInfo.IsDir()))
+			if fileInfo.Path() == skip {
+				return ErrSkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error walking: %v", err)
+		}
+		return traversed
+	}
+
+	// Walking with a recursive listing visits the same entries, in the same
+	// order, as walking directory by directory.
+	for _, skip := range []string{"", "/a-b", "/a/b", "/a/b/c", "/a/b/f/g", "/z"} {
+		recursive, listed := walk(d, skip), walk(listOnlyDriver{d}, skip)
+		if fmt.Sprint(recursive) != fmt.Sprint(listed) {
+			t.Fatalf("unexpected walk skipping %q: %v != %v", skip, recursive, listed)
+		}
+
+		// Drivers reporting the recursive listing as unsupported are
+		// walked directory by directory.
+		if unsupported := walk(unsupportedListerDriver{d}, skip); fmt.Sprint(unsupported) != fmt.Sprint(listed) {
+			t.Fatalf("unexpected walk of unsupported lister skipping %q: %v != %v", skip, unsupported, listed)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package distribution
 
 import (
+	"time"
+
 	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
 )
 
 // TagService provides access to information about tagged objects.
@@ -22,6 +25,29 @@ type TagService interface {
 	// All returns the set of tags managed by this tag service
 	All(ctx context.Context) ([]string, error)
 
+	// List fills tags with the tags lexically following last, in lexical
+	// order, up to the size of tags, and returns the number of entries
+	// filled. err is set to io.EOF if there are no more tags to obtain.
+	// It bounds the number of tags returned, not necessarily the number
+	// read from storage.
+	List(ctx context.Context, tags []string, last string) (n int, err error)
+
 	// Lookup returns the set of tags referencing the given digest.
 	Lookup(ctx context.Context, digest Descriptor) ([]string, error)
+
+	// History returns the manifests the tag has referred to, most recently
+	// tagged first.
+	History(ctx context.Context, tag string) ([]TagHistoryEntry, error)
+}
+
+// TagHistoryEntry describes a manifest a tag has referred to.
+type TagHistoryEntry struct {
+	// Digest identifies the manifest.
+	Digest digest.Digest `json:"digest"`
+
+	// Tagged is the last time the tag was made to refer to the manifest.
+	Tagged time.Time `json:"tagged"`
+
+	// Current is true if the tag refers to the manifest.
+	Current bool `json:"current"`
 }